@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"Powerc20Worker/miner"
+)
+
+var benchLog = newSubsystemLogger("benchmark")
+
+// hasherCalibration is how long each backend is measured when -hasher is
+// auto.
+const hasherCalibration = 200 * time.Millisecond
+
+// formatRates lists backend rates for logs, fastest first.
+func formatRates(rates []miner.HasherRate) string {
+	parts := make([]string, len(rates))
+	for i, r := range rates {
+		parts[i] = fmt.Sprintf("%s %.0f K/s", r.Hasher.Name(), r.Rate/1000)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// resolveHasher returns the backend called name, or with auto the fastest
+// on this machine.
+func resolveHasher(name string) (miner.Hasher, error) {
+	if name != "auto" {
+		return miner.HasherByName(name)
+	}
+	rates := miner.BenchmarkHashers(hasherCalibration)
+	if len(rates) == 0 {
+		return nil, fmt.Errorf("no hasher backend works on this machine")
+	}
+	withEvent(benchLog, "hasher_selected").Infof("Selected the %s hasher (%s)", rates[0].Hasher.Name(), formatRates(rates))
+	return rates[0].Hasher, nil
+}
+
+// hasherResult is the single-core speed of a backend.
+type hasherResult struct {
+	Hasher string  `json:"hasher"`
+	Rate   float64 `json:"rate"`
+}
+
+// scalingResult is the speed of the worker pool at one worker count.
+type scalingResult struct {
+	Hasher  string  `json:"hasher"`
+	Workers int     `json:"workers"`
+	Rate    float64 `json:"rate"`
+	// PerCore is the rate divided by the cores the workers can occupy.
+	PerCore float64 `json:"perCore"`
+	// Efficiency is PerCore relative to the rate of a single worker.
+	Efficiency float64 `json:"efficiency"`
+}
+
+// benchmarkRun is one run of the `benchmark` subcommand as stored in the
+// results file.
+type benchmarkRun struct {
+	Time       time.Time       `json:"time"`
+	Version    string          `json:"version"`
+	Host       string          `json:"host"`
+	CPU        string          `json:"cpu"`
+	GOOS       string          `json:"goos"`
+	GOARCH     string          `json:"goarch"`
+	NumCPU     int             `json:"numCPU"`
+	Duration   string          `json:"duration"`
+	Hashers    []hasherResult  `json:"hashers"`
+	Scaling    []scalingResult `json:"scaling"`
+	Difficulty int64           `json:"difficulty"`
+	// ExpectedSeconds is the mean time to a solution at Difficulty with
+	// the fastest configuration.
+	ExpectedSeconds float64 `json:"expectedSeconds"`
+}
+
+// peak returns the fastest scaling result.
+func (r *benchmarkRun) peak() *scalingResult {
+	var best *scalingResult
+	for i := range r.Scaling {
+		if best == nil || r.Scaling[i].Rate > best.Rate {
+			best = &r.Scaling[i]
+		}
+	}
+	return best
+}
+
+// buildVersion identifies the build: the module version and, when built
+// from a checkout, the commit.
+func buildVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	version := info.Main.Version
+	var revision, modified string
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			if s.Value == "true" {
+				modified = "+dirty"
+			}
+		}
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	// Newer toolchains already stamp the revision into a pseudo-version.
+	if revision != "" && !strings.Contains(version, revision) {
+		version += " " + revision + modified
+	}
+	return version
+}
+
+// cpuModel returns the CPU model name where the OS tells it.
+func cpuModel() string {
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return runtime.GOARCH
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if ok && strings.TrimSpace(key) == "model name" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return runtime.GOARCH
+}
+
+// defaultWorkerCounts are the powers of two below the number of available
+// CPUs and that number itself.
+func defaultWorkerCounts() []int {
+	cpus := miner.AvailableCPUs()
+	var counts []int
+	for n := 1; n < cpus; n *= 2 {
+		counts = append(counts, n)
+	}
+	return append(counts, cpus)
+}
+
+func parseIntList(list string) ([]int, error) {
+	var out []int
+	for _, item := range strings.Split(list, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid count %q", item)
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+// loadBenchmarkRuns reads the results file; a missing file has no runs.
+func loadBenchmarkRuns(path string) ([]*benchmarkRun, error) {
+	var runs []*benchmarkRun
+	if err := readJSONFile(path, &runs); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return runs, nil
+}
+
+// printBenchmarkRuns lists stored runs to compare machines and releases.
+func printBenchmarkRuns(runs []*benchmarkRun) {
+	fmt.Printf("%-20s %-16s %-40s %5s %-44s %14s %-14s %8s\n", "TIME", "HOST", "CPU", "CPUS", "VERSION", "PEAK", "HASHER", "WORKERS")
+	for _, r := range runs {
+		peak := r.peak()
+		if peak == nil {
+			continue
+		}
+		fmt.Printf("%-20s %-16s %-40s %5d %-44s %14s %-14s %8d\n", r.Time.Local().Format("2006-01-02 15:04:05"), truncate(r.Host, 16), truncate(r.CPU, 40), r.NumCPU, truncate(r.Version, 44), formatRate(peak.Rate), peak.Hasher, peak.Workers)
+	}
+}
+
+// runBenchmark implements the `benchmark` subcommand. It measures every
+// hashing backend on one core, then runs the worker pool at several worker
+// counts, and appends the results to a file so that machines and releases
+// can be compared.
+func runBenchmark(args []string) {
+	fs := flag.NewFlagSet("benchmark", flag.ExitOnError)
+	duration := fs.Duration("duration", 3*time.Second, "How long each backend and worker count is measured")
+	workerList := fs.String("workers", "", "Comma-separated worker counts to run the pool with (default powers of two up to the number of available CPUs)")
+	hasherList := fs.String("hasher", "", "Comma-separated backends to run the pool with (default the fastest on one core)")
+	difficulty := fs.Int64("difficulty", 32, "PoWERC20 difficulty to estimate the time to a solution for")
+	out := fs.String("out", "benchmark.json", "File the results are appended to; empty keeps them out of any file")
+	list := fs.Bool("list", false, "Print the runs stored in -out and exit")
+	parseCommand(fs, args)
+
+	if *list {
+		runs, err := loadBenchmarkRuns(*out)
+		if err != nil {
+			benchLog.Fatalf("%v", err)
+		}
+		printBenchmarkRuns(runs)
+		return
+	}
+	workers := defaultWorkerCounts()
+	if *workerList != "" {
+		var err error
+		if workers, err = parseIntList(*workerList); err != nil {
+			benchLog.Fatalf("Invalid -workers: %v", err)
+		}
+	}
+	if *difficulty < 0 || *difficulty > 256 {
+		benchLog.Fatalf("Invalid -difficulty %d, expected 0 to 256", *difficulty)
+	}
+
+	run := &benchmarkRun{
+		Time:       time.Now().UTC(),
+		Version:    buildVersion(),
+		CPU:        cpuModel(),
+		GOOS:       runtime.GOOS,
+		GOARCH:     runtime.GOARCH,
+		NumCPU:     runtime.NumCPU(),
+		Duration:   duration.String(),
+		Difficulty: *difficulty,
+	}
+	run.Host, _ = os.Hostname()
+	fmt.Printf("%s, %d CPUs, %s\n\n", run.CPU, run.NumCPU, run.Version)
+
+	rates := miner.BenchmarkHashers(*duration)
+	if len(rates) == 0 {
+		benchLog.Fatalf("No hasher backend works on this machine")
+	}
+	// Speeds are shown relative to the reference backend.
+	reference := rates[len(rates)-1].Rate
+	for _, r := range rates {
+		if r.Hasher.Name() == "keccak256" {
+			reference = r.Rate
+		}
+	}
+	fmt.Printf("%-14s %14s %9s\n", "HASHER", "RATE/CORE", "RELATIVE")
+	for _, r := range rates {
+		fmt.Printf("%-14s %14s %8.0f%%\n", r.Hasher.Name(), formatRate(r.Rate), r.Rate/reference*100)
+		run.Hashers = append(run.Hashers, hasherResult{Hasher: r.Hasher.Name(), Rate: r.Rate})
+	}
+
+	hashers := []miner.Hasher{rates[0].Hasher}
+	if *hasherList != "" {
+		hashers = nil
+		for _, name := range strings.Split(*hasherList, ",") {
+			h, err := miner.HasherByName(strings.TrimSpace(name))
+			if err != nil {
+				benchLog.Fatalf("Invalid -hasher: %v", err)
+			}
+			hashers = append(hashers, h)
+		}
+	}
+	for _, h := range hashers {
+		fmt.Printf("\nWorker pool with %s:\n", h.Name())
+		fmt.Printf("%-8s %14s %14s %10s %8s\n", "WORKERS", "HASHRATE", "PER CORE", "EFFICIENCY", "SPEEDUP")
+		var single float64
+		for _, n := range workers {
+			rate, err := miner.BenchmarkPool(context.Background(), h, n, *duration)
+			if err != nil {
+				benchLog.Fatalf("Benchmark failed: %v", err)
+			}
+			perCore := rate / float64(min(n, runtime.NumCPU()))
+			if single == 0 {
+				// The first count is the baseline when 1 is not measured.
+				single = perCore
+			}
+			res := scalingResult{Hasher: h.Name(), Workers: n, Rate: rate, PerCore: perCore, Efficiency: perCore / single}
+			run.Scaling = append(run.Scaling, res)
+			fmt.Printf("%-8d %14s %14s %9.0f%% %7.2fx\n", n, formatRate(rate), formatRate(perCore), res.Efficiency*100, rate/single)
+		}
+	}
+
+	peak := run.peak()
+	// The time to a solution is exponentially distributed around the mean.
+	run.ExpectedSeconds = miner.ExpectedHashes(miner.BitsTarget(big.NewInt(*difficulty))) / peak.Rate
+	fmt.Printf("\nPeak: %s with %s and %d workers\n", strings.TrimSpace(formatRate(peak.Rate)), peak.Hasher, peak.Workers)
+	fmt.Printf("Time to a solution at difficulty %d: mean %s, median %s, 95%% within %s\n", *difficulty,
+		formatSeconds(run.ExpectedSeconds), formatSeconds(run.ExpectedSeconds*math.Ln2), formatSeconds(run.ExpectedSeconds*math.Log(20)))
+
+	if *out == "" {
+		return
+	}
+	runs, err := loadBenchmarkRuns(*out)
+	if err != nil {
+		benchLog.Fatalf("%v", err)
+	}
+	if err := writeJSONFile(*out, append(runs, run)); err != nil {
+		benchLog.Fatalf("Failed to store results: %v", err)
+	}
+	fmt.Printf("Results appended to %s, compare runs with `benchmark -list`\n", *out)
+}
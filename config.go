@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"Powerc20Worker/miner"
+)
+
+// reloadableFlags are the flags a SIGHUP applies to the running miner.
+// Other flags in the config file take effect on the next start.
+var reloadableFlags = map[string]bool{
+	"log-level":   true,
+	"workerCount": true,
+	"cpuBudget":   true,
+	"dutyCycle":   true,
+	"schedule":    true,
+	"nice":        true,
+	"maxGasPrice": true,
+}
+
+// readConfigFile reads a JSON object of flag names to values, for example
+// {"workerCount": "auto", "cpuBudget": 50, "schedule": "22:00-07:00"}.
+func readConfigFile(path string) (map[string]string, error) {
+	var raw map[string]interface{}
+	if err := readJSONFile(path, &raw); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	values := make(map[string]string, len(raw))
+	for name, v := range raw {
+		if name == "config" || flag.Lookup(name) == nil {
+			return nil, fmt.Errorf("%s: unknown flag %q", path, name)
+		}
+		switch v := v.(type) {
+		case string:
+			values[name] = v
+		case float64:
+			values[name] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			values[name] = strconv.FormatBool(v)
+		default:
+			return nil, fmt.Errorf("%s: flag %q must be a string, number or boolean", path, name)
+		}
+	}
+	return values, nil
+}
+
+// commandLineFlags returns the flags given on the command line; they take
+// precedence over the config file.
+func commandLineFlags() map[string]bool {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set
+}
+
+// applyConfigFile sets the flags in path that were not given on the
+// command line.
+func applyConfigFile(path string, explicit map[string]bool) error {
+	values, err := readConfigFile(path)
+	if err != nil {
+		return err
+	}
+	for name, v := range values {
+		if explicit[name] {
+			continue
+		}
+		if err := flag.Set(name, v); err != nil {
+			return fmt.Errorf("%s: invalid %s: %v", path, name, err)
+		}
+	}
+	return nil
+}
+
+// reloader applies a changed config file to the running miner on SIGHUP.
+type reloader struct {
+	path     string
+	explicit map[string]bool
+	ctrl     *controller
+}
+
+// reload reads the config file again and applies the reloadable flags that
+// changed. Nothing is applied when a value is invalid.
+func (r *reloader) reload() error {
+	if r.path == "" {
+		return errors.New("the miner was started without -config")
+	}
+	values, err := readConfigFile(r.path)
+	if err != nil {
+		return err
+	}
+	previous := make(map[string]string)
+	restore := func() {
+		for name, v := range previous {
+			flag.Set(name, v)
+		}
+	}
+	var changed, ignored []string
+	for name, v := range values {
+		if r.explicit[name] {
+			continue
+		}
+		f := flag.Lookup(name)
+		old := f.Value.String()
+		if err := flag.Set(name, v); err != nil {
+			restore()
+			return fmt.Errorf("invalid %s: %v", name, err)
+		}
+		if f.Value.String() == old {
+			continue
+		}
+		previous[name] = old
+		if !reloadableFlags[name] {
+			ignored = append(ignored, name)
+			continue
+		}
+		changed = append(changed, name)
+	}
+	// Flags that only apply on start keep their running values so that
+	// the status reflects what is in effect.
+	for _, name := range ignored {
+		flag.Set(name, previous[name])
+	}
+	if len(ignored) > 0 {
+		sort.Strings(ignored)
+		withEvent(logger, "config_restart_needed").Warnf("Changed %s in %s take effect after a restart", strings.Join(ignored, ", "), r.path)
+	}
+	if len(changed) == 0 {
+		withEvent(logger, "config_reloaded").Infof("Reloaded %s, nothing to change", r.path)
+		return nil
+	}
+	if err := r.apply(changed); err != nil {
+		restore()
+		return err
+	}
+	sort.Strings(changed)
+	withEvent(logger, "config_reloaded").Infof("Reloaded %s, applied %s", r.path, strings.Join(changed, ", "))
+	return nil
+}
+
+// apply pushes the named flags to the running miner after checking all of
+// them.
+func (r *reloader) apply(changed []string) error {
+	has := make(map[string]bool)
+	for _, name := range changed {
+		has[name] = true
+	}
+	workers, auto, err := parseWorkerCount(workerCount)
+	if err != nil {
+		return fmt.Errorf("invalid workerCount: %v", err)
+	}
+	throttle, err := buildThrottle(cpuBudget, dutyCycle, mineSchedule, miner.AvailableCPUs())
+	if err != nil {
+		return err
+	}
+	limit, err := parseGwei(maxGasPrice)
+	if err != nil {
+		return fmt.Errorf("invalid maxGasPrice: %v", err)
+	}
+	if has["nice"] && (niceLevel < 0 || niceLevel > 19) {
+		return fmt.Errorf("invalid nice %d, expected 0 to 19", niceLevel)
+	}
+	if has["log-level"] {
+		if err := setLogLevels(logCfg.levels); err != nil {
+			return fmt.Errorf("invalid log-level: %v", err)
+		}
+	}
+
+	if has["cpuBudget"] || has["dutyCycle"] || has["schedule"] {
+		r.ctrl.engine.SetThrottle(throttle)
+	}
+	if has["workerCount"] || has["cpuBudget"] {
+		if auto {
+			r.ctrl.tuner.setMax(budgetWorkers(workers, throttle))
+			r.ctrl.tuner.enable()
+		} else {
+			r.ctrl.setWorkers(workers)
+		}
+	}
+	if has["nice"] && niceLevel > 0 {
+		if err := lowerPriority(niceLevel); err != nil {
+			logger.Warnf("Failed to change the process priority: %v", err)
+		}
+	}
+	if has["maxGasPrice"] && r.ctrl.sub != nil {
+		r.ctrl.sub.setMaxGasPrice(limit)
+	}
+	return nil
+}
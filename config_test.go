@@ -0,0 +1,175 @@
+package main
+
+import (
+	"flag"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"Powerc20Worker/miner"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// keepFlags restores the command-line flags when the test ends.
+func keepFlags(t *testing.T) {
+	values := make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) { values[f.Name] = f.Value.String() })
+	t.Cleanup(func() {
+		flag.VisitAll(func(f *flag.Flag) {
+			if f.Value.String() != values[f.Name] {
+				flag.Set(f.Name, values[f.Name])
+			}
+		})
+	})
+}
+
+// testController is a controller for a miner of one token on chain that
+// has not been started, with one worker.
+func testController(t *testing.T, chain *simChain, token, account common.Address) *controller {
+	t.Helper()
+	scheme, err := miner.LoadScheme("powerc20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine, err := miner.New(miner.Options{
+		Backend:      chain.dial(),
+		Scheme:       scheme,
+		Contracts:    []miner.ContractSpec{{Address: token, Decimals: 18}},
+		Sender:       account,
+		Workers:      1,
+		PollInterval: 100 * time.Millisecond,
+		Logger:       schedLog,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	luck, err := newLuckTracker(engine.Contracts(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &controller{
+		account: account,
+		engine:  engine,
+		sites:   engine.Contracts(),
+		luck:    luck,
+		tuner:   newWorkerTuner(engine, 1, false, 0, 15),
+		started: time.Now(),
+		drain:   make(chan struct{}),
+	}
+}
+
+// reloadController is a controller with a submitter and a reloader for a
+// config file in a temporary directory.
+func reloadController(t *testing.T, explicit map[string]bool) (*controller, *reloader) {
+	t.Helper()
+	chain, err := newSimChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctrl := testController(t, chain, chain.deploy("sim", 60, 1), common.Address{0x01})
+	ctrl.sub = &submitter{}
+	path := filepath.Join(t.TempDir(), "config.json")
+	return ctrl, &reloader{path: path, explicit: explicit, ctrl: ctrl}
+}
+
+func writeConfig(t *testing.T, path string, values map[string]interface{}) {
+	t.Helper()
+	if err := writeJSONFile(path, values); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadAppliesReloadableFlags(t *testing.T) {
+	keepFlags(t)
+	ctrl, r := reloadController(t, map[string]bool{})
+	poll := flag.Lookup("pollInterval").Value.String()
+	writeConfig(t, r.path, map[string]interface{}{
+		"workerCount":  "3",
+		"cpuBudget":    50,
+		"maxGasPrice":  "40",
+		"pollInterval": "1m",
+	})
+	if err := r.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := ctrl.engine.Workers(); got != 3 {
+		t.Errorf("%d workers after reload, want 3", got)
+	}
+	if want := 0.5 * float64(miner.AvailableCPUs()); ctrl.engine.Throttle().Cores != want {
+		t.Errorf("throttle %v after reload, want %.2f cores", ctrl.engine.Throttle(), want)
+	}
+	if limit := ctrl.sub.maxGasPrice; limit == nil || limit.Int64() != 40e9 {
+		t.Errorf("gas price limit %v after reload, want 40 gwei", limit)
+	}
+	// pollInterval only applies on start and keeps its running value.
+	if got := flag.Lookup("pollInterval").Value.String(); got != poll {
+		t.Errorf("pollInterval is %s after reload, want %s", got, poll)
+	}
+}
+
+func TestReloadInvalidRestores(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		values map[string]interface{}
+	}{
+		{"invalid flag value", map[string]interface{}{"workerCount": "4", "cpuBudget": 50, "nice": "many"}},
+		{"invalid duty cycle", map[string]interface{}{"workerCount": "4", "cpuBudget": 50, "dutyCycle": "bogus"}},
+		{"invalid nice", map[string]interface{}{"workerCount": "4", "cpuBudget": 50, "nice": 25}},
+		{"invalid worker count", map[string]interface{}{"workerCount": "none", "cpuBudget": 50}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			keepFlags(t)
+			ctrl, r := reloadController(t, map[string]bool{})
+			before := make(map[string]string)
+			for name := range c.values {
+				before[name] = flag.Lookup(name).Value.String()
+			}
+			writeConfig(t, r.path, c.values)
+			if err := r.reload(); err == nil {
+				t.Fatal("invalid config reloaded")
+			}
+			for name, want := range before {
+				if got := flag.Lookup(name).Value.String(); got != want {
+					t.Errorf("%s is %q after a failed reload, want %q", name, got, want)
+				}
+			}
+			if got := ctrl.engine.Workers(); got != 1 {
+				t.Errorf("%d workers after a failed reload, want 1", got)
+			}
+			if th := ctrl.engine.Throttle(); th.Cores != 0 || th.Period != 0 {
+				t.Errorf("throttle %v after a failed reload, want none", th)
+			}
+		})
+	}
+}
+
+func TestConfigCommandLinePrecedence(t *testing.T) {
+	keepFlags(t)
+	// -workerCount 2 was given on the command line.
+	if err := flag.Set("workerCount", "2"); err != nil {
+		t.Fatal(err)
+	}
+	explicit := map[string]bool{"workerCount": true}
+	ctrl, r := reloadController(t, explicit)
+
+	writeConfig(t, r.path, map[string]interface{}{"workerCount": "7", "cpuBudget": 25})
+	if err := applyConfigFile(r.path, explicit); err != nil {
+		t.Fatal(err)
+	}
+	if workerCount != "2" || cpuBudget != 25 {
+		t.Errorf("workerCount %s and cpuBudget %g on start, want 2 and 25", workerCount, cpuBudget)
+	}
+
+	// A reload keeps the command line value too.
+	writeConfig(t, r.path, map[string]interface{}{"workerCount": "9", "cpuBudget": 30})
+	if err := r.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if workerCount != "2" || cpuBudget != 30 {
+		t.Errorf("workerCount %s and cpuBudget %g after reload, want 2 and 30", workerCount, cpuBudget)
+	}
+	if got := ctrl.engine.Workers(); got != 2 {
+		t.Errorf("%d workers after reload, want the 2 from the command line", got)
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"Powerc20Worker/miner"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// workersPerCPU bounds the worker count the control API accepts, so one
+// request cannot start millions of goroutines.
+const workersPerCPU = 4
+
+// maxWorkers is the largest worker count the control API accepts: a few per
+// CPU, or the configured count if that is higher.
+func (c *controller) maxWorkers() int {
+	return max(workersPerCPU*runtime.NumCPU(), int(c.tuner.max.Load()))
+}
+
+// parseWorkersParam parses the count of POST /workers, which is auto or a
+// number of workers from 0 to limit.
+func parseWorkersParam(count string, limit int) (n int, auto bool, err error) {
+	if count == "auto" {
+		return 0, true, nil
+	}
+	n, err = strconv.Atoi(count)
+	if err != nil || n < 0 {
+		return 0, false, errors.New("count must be a non-negative integer or auto")
+	}
+	if n > limit {
+		return 0, false, fmt.Errorf("count %d is above the limit of %d workers", n, limit)
+	}
+	return n, false, nil
+}
+
+// controller exposes a running miner to the control API.
+type controller struct {
+	account common.Address
+	engine  *miner.Miner
+	sites   []*miner.Contract
+	luck    *luckTracker
+	queue   *solutionQueue // nil when solutions are not submitted
+	sub     *submitter     // nil when solutions are not submitted
+	tuner   *workerTuner
+	started time.Time
+
+	draining atomic.Bool
+	drain    chan struct{} // closed when a drain is requested
+	once     sync.Once
+}
+
+// contractStatus is the state of one mined contract.
+type contractStatus struct {
+	Address    common.Address `json:"address"`
+	Name       string         `json:"name"`
+	Challenge  *hexutil.Big   `json:"challenge,omitempty"`
+	Difficulty *hexutil.Big   `json:"difficulty,omitempty"`
+	State      string         `json:"state"`
+	Workers    int            `json:"workers"`
+	Hashes     uint64         `json:"hashes"`
+}
+
+// minerStatus is the response of GET /status.
+type minerStatus struct {
+	Account    common.Address    `json:"account"`
+	Uptime     string            `json:"uptime"`
+	Workers    int               `json:"workers"`
+	AutoTuned  bool              `json:"autoTuned"`
+	Paused     bool              `json:"paused"`
+	Throttle   string            `json:"throttle,omitempty"`
+	InWindow   bool              `json:"inWindow"`
+	Hasher     string            `json:"hasher"`
+	Restarts   uint64            `json:"workerRestarts"`
+	Draining   bool              `json:"draining"`
+	Hashrate   float64           `json:"hashrate"`
+	Hashes     uint64            `json:"hashes"`
+	Contracts  []*contractStatus `json:"contracts"`
+	Queued     []*queuedSolution `json:"queued"`
+	PendingTxs []*pendingTx      `json:"pendingTxs"`
+	Luck       *luckSummary      `json:"luck"`
+}
+
+func (c *controller) status() *minerStatus {
+	stats := c.engine.Stats()
+	st := &minerStatus{
+		Account:  c.account,
+		Uptime:   time.Since(c.started).Round(time.Second).String(),
+		Workers:  stats.Workers,
+		Paused:   stats.Paused,
+		Throttle: stats.Throttle.String(),
+		InWindow: stats.InWindow,
+		Hasher:   stats.Hasher,
+		Restarts: stats.Restarts,
+		Draining: c.draining.Load(),
+		Hashrate: stats.Hashrate,
+		Hashes:   stats.Hashes,
+		Luck:     c.luck.summary(),
+	}
+	st.AutoTuned = c.tuner.enabled.Load()
+	for _, site := range stats.Contracts {
+		cs := &contractStatus{
+			Address: site.Contract.Address(),
+			Name:    site.Contract.Name(),
+			State:   site.State,
+			Workers: site.Workers,
+			Hashes:  site.Hashes,
+		}
+		if site.Job != nil {
+			cs.Challenge = (*hexutil.Big)(site.Job.Challenge)
+			cs.Difficulty = (*hexutil.Big)(site.Job.Difficulty)
+		}
+		st.Contracts = append(st.Contracts, cs)
+	}
+	if c.queue != nil {
+		st.Queued = c.queue.pending()
+	}
+	if c.sub != nil {
+		st.PendingTxs = c.sub.pendingTxs()
+	}
+	return st
+}
+
+// setWorkers changes the number of mining workers; a fixed count turns
+// automatic tuning off.
+func (c *controller) setWorkers(n int) {
+	c.tuner.disable()
+	c.engine.SetWorkers(n)
+}
+
+// requestDrain asks the miner to stop hashing, submit what is queued and
+// exit.
+func (c *controller) requestDrain() {
+	c.once.Do(func() {
+		c.draining.Store(true)
+		close(c.drain)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// handler returns the control API. Every request must carry token as a
+// bearer token.
+func (c *controller) handler(token string) http.Handler {
+	mux := http.NewServeMux()
+	post := func(path string, fn func(r *http.Request) (string, error)) {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+				return
+			}
+			msg, err := fn(r)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			controlLog.Infof("Control API: %s", msg)
+			writeJSON(w, http.StatusOK, map[string]string{"result": msg})
+		})
+	}
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, c.status())
+	})
+	post("/pause", func(r *http.Request) (string, error) {
+		c.engine.SetPaused(true)
+		return "hashing paused", nil
+	})
+	post("/resume", func(r *http.Request) (string, error) {
+		c.engine.SetPaused(false)
+		return "hashing resumed", nil
+	})
+	post("/workers", func(r *http.Request) (string, error) {
+		if c.draining.Load() {
+			return "", errors.New("miner is draining")
+		}
+		n, auto, err := parseWorkersParam(r.URL.Query().Get("count"), c.maxWorkers())
+		if err != nil {
+			return "", err
+		}
+		if auto {
+			c.tuner.enable()
+			return "worker count tuning resumed", nil
+		}
+		c.setWorkers(n)
+		return fmt.Sprintf("worker count set to %d", n), nil
+	})
+	post("/refresh", func(r *http.Request) (string, error) {
+		for _, site := range c.sites {
+			site.RequestRefresh()
+		}
+		return "job refresh requested", nil
+	})
+	post("/drain", func(r *http.Request) (string, error) {
+		c.requestDrain()
+		return "draining", nil
+	})
+
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing or wrong token"})
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// listenControl listens on addr, either host:port or unix:PATH. Unix
+// sockets are only accessible to the owner.
+func listenControl(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		os.Remove(path)
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(path, 0600); err != nil {
+			l.Close()
+			return nil, err
+		}
+		return l, nil
+	}
+	return net.Listen("tcp", addr)
+}
+
+// controlToken returns the token from -controlToken, or generates one and
+// stores it in file for `ctl` to pick up.
+func controlToken(token, file string) (string, error) {
+	if token != "" {
+		return token, nil
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token = hex.EncodeToString(buf)
+	if err := os.WriteFile(file, []byte(token+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("failed to write control token: %v", err)
+	}
+	return token, nil
+}
+
+// serve starts the control API on addr.
+func (c *controller) serve(addr, token string) error {
+	l, err := listenControl(addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := http.Serve(l, c.handler(token)); err != nil {
+			controlLog.Errorf("Control API stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// runCtl implements the `ctl` subcommand, which talks to a running miner's
+// control API.
+func runCtl(args []string) {
+	fs := flag.NewFlagSet("ctl", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8551", "Control API address of the miner, host:port or unix:PATH")
+	token := fs.String("token", "", "Control API token (default: read from -tokenFile)")
+	tokenFile := fs.String("tokenFile", "control.token", "File the miner wrote its control token to")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ctl [flags] status|pause|resume|workers N|auto|refresh|drain")
+		fs.PrintDefaults()
+	}
+	parseCommand(fs, args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	if *token == "" {
+		data, err := os.ReadFile(*tokenFile)
+		if err != nil {
+			controlLog.Fatalf("Failed to read control token: %v", err)
+		}
+		*token = strings.TrimSpace(string(data))
+	}
+
+	method, path := http.MethodPost, "/"+fs.Arg(0)
+	switch fs.Arg(0) {
+	case "status":
+		method = http.MethodGet
+	case "pause", "resume", "refresh", "drain":
+	case "workers":
+		if fs.NArg() != 2 {
+			controlLog.Fatalf("Usage: ctl workers N|auto")
+		}
+		path += "?count=" + fs.Arg(1)
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	base := "http://" + *addr
+	if sock, ok := strings.CutPrefix(*addr, "unix:"); ok {
+		base = "http://unix"
+		client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+			},
+		}
+	}
+	req, err := http.NewRequest(method, base+path, nil)
+	if err != nil {
+		controlLog.Fatalf("%v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+*token)
+	resp, err := client.Do(req)
+	if err != nil {
+		controlLog.Fatalf("Failed to reach the miner: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		controlLog.Fatalf("Failed to read response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		controlLog.Fatalf("Miner returned %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	os.Stdout.Write(body)
+}
@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestParseWorkersParam(t *testing.T) {
+	for _, c := range []struct {
+		count string
+		n     int
+		auto  bool
+		ok    bool
+	}{
+		{"auto", 0, true, true},
+		{"0", 0, false, true},
+		{"16", 16, false, true},
+		{"17", 0, false, false},
+		{"100000000", 0, false, false},
+		{"-1", 0, false, false},
+		{"many", 0, false, false},
+	} {
+		n, auto, err := parseWorkersParam(c.count, 16)
+		if (err == nil) != c.ok || n != c.n || auto != c.auto {
+			t.Errorf("parseWorkersParam(%q) = %d, %v, %v", c.count, n, auto, err)
+		}
+	}
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"Powerc20Worker/abi"
+	"Powerc20Worker/miner"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/fatih/color"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/term"
+)
+
+const (
+	// sparkWidth is how many samples of history each sparkline shows.
+	sparkWidth = 30
+	// eventLines is how many log entries the dashboard keeps.
+	eventLines = 12
+	// plainStatusInterval is how often the hashrate is printed when stdout
+	// is not a terminal.
+	plainStatusInterval = 10 * time.Second
+)
+
+var sparkRunes = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline renders values scaled to their maximum.
+func sparkline(values []float64) string {
+	var max float64
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	var b strings.Builder
+	for _, v := range values {
+		idx := 0
+		if max > 0 {
+			idx = int(v / max * float64(len(sparkRunes)-1))
+		}
+		b.WriteRune(sparkRunes[idx])
+	}
+	return b.String()
+}
+
+// accountInfo is the on-chain state of the mining account, refreshed in
+// the background.
+type accountInfo struct {
+	balance *big.Int
+	tokens  map[common.Address]*big.Int
+	times   map[common.Address]*big.Int
+	limits  map[common.Address]*big.Int
+}
+
+// dashboard is a full-screen view of the miner, redrawn every second. Log
+// entries are shown in its event pane instead of being printed.
+type dashboard struct {
+	ctrl   *controller
+	client *ethclient.Client
+	out    io.Writer
+
+	rates     [][]float64 // per worker history
+	lastSite  []uint64
+	siteRates []float64
+
+	mu      sync.Mutex
+	events  []string
+	account *accountInfo
+
+	once     sync.Once
+	stopped  atomic.Bool
+	silenced bool // whether log output was discarded while shown
+}
+
+func newDashboard(ctrl *controller, client *ethclient.Client) *dashboard {
+	return &dashboard{
+		ctrl:      ctrl,
+		client:    client,
+		out:       os.Stdout,
+		lastSite:  make([]uint64, len(ctrl.sites)),
+		siteRates: make([]float64, len(ctrl.sites)),
+	}
+}
+
+// Levels and Fire make the dashboard a logrus hook feeding the event pane.
+func (d *dashboard) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (d *dashboard) Fire(e *logrus.Entry) error {
+	line := fmt.Sprintf("%s %-5s %s", e.Time.Format("15:04:05"), strings.ToUpper(e.Level.String()), e.Message)
+	switch {
+	case e.Level <= logrus.ErrorLevel:
+		line = color.RedString("%s", line)
+	case e.Level == logrus.WarnLevel:
+		line = color.YellowString("%s", line)
+	}
+	d.mu.Lock()
+	d.events = append(d.events, line)
+	if len(d.events) > eventLines {
+		d.events = d.events[len(d.events)-eventLines:]
+	}
+	d.mu.Unlock()
+	return nil
+}
+
+// start switches to the alternate screen and routes logs into the event
+// pane. Logs still go to -log-file if one is set.
+func (d *dashboard) start(ctx context.Context, keepLogOutput bool) {
+	for _, l := range subsystemLoggers {
+		l.AddHook(d)
+		if !keepLogOutput {
+			l.SetOutput(io.Discard)
+		}
+	}
+	d.silenced = !keepLogOutput
+	// Restore the terminal when a fatal error exits the process and show
+	// what happened.
+	logrus.RegisterExitHandler(d.stop)
+	fmt.Fprint(d.out, "\x1b[?1049h\x1b[?25l")
+	go d.pollAccount(ctx)
+}
+
+// stop leaves the alternate screen, prints the latest events and sends
+// further log output to the terminal again.
+func (d *dashboard) stop() {
+	d.once.Do(func() {
+		d.stopped.Store(true)
+		fmt.Fprint(d.out, "\x1b[?25h\x1b[?1049l")
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		for _, line := range d.events {
+			fmt.Fprintln(os.Stderr, line)
+		}
+		if d.silenced {
+			for _, l := range subsystemLoggers {
+				l.SetOutput(os.Stderr)
+			}
+		}
+	})
+}
+
+// pollAccount refreshes balances and mining limits every poll interval.
+func (d *dashboard) pollAccount(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		info := &accountInfo{
+			tokens: make(map[common.Address]*big.Int),
+			times:  make(map[common.Address]*big.Int),
+			limits: make(map[common.Address]*big.Int),
+		}
+		info.balance, _ = d.client.BalanceAt(ctx, d.ctrl.account, nil)
+		opts := &bind.CallOpts{Context: ctx}
+		for _, site := range d.ctrl.sites {
+			token, err := abi.NewPoWERC20Caller(site.Address(), d.client)
+			if err != nil {
+				continue
+			}
+			if v, err := token.BalanceOf(opts, d.ctrl.account); err == nil {
+				info.tokens[site.Address()] = v
+			}
+			if v, err := token.MiningTimes(opts, d.ctrl.account); err == nil {
+				info.times[site.Address()] = v
+			}
+			if v, err := token.MiningLimit(opts); err == nil {
+				info.limits[site.Address()] = v
+			}
+		}
+		d.mu.Lock()
+		d.account = info
+		d.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// formatUnits renders an integer token amount with the given decimals.
+func formatUnits(v *big.Int, decimals uint8) string {
+	if v == nil {
+		return "-"
+	}
+	return new(big.Rat).SetFrac(v, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)).FloatString(4)
+}
+
+func formatRate(rate float64) string {
+	return fmt.Sprintf("%8.2f K/s", rate/1000)
+}
+
+// render redraws the dashboard; it is called once per stats sample.
+func (d *dashboard) render(now time.Time, elapsed time.Duration) {
+	if d.stopped.Load() {
+		return
+	}
+	st := d.ctrl.status()
+	workerRates := d.ctrl.engine.Stats().WorkerRates
+	for len(d.rates) < len(workerRates) {
+		d.rates = append(d.rates, nil)
+	}
+	d.rates = d.rates[:len(workerRates)]
+	for i, rate := range workerRates {
+		d.rates[i] = append(d.rates[i], rate)
+		if len(d.rates[i]) > sparkWidth {
+			d.rates[i] = d.rates[i][1:]
+		}
+	}
+	for i, site := range d.ctrl.sites {
+		count := site.Hashes()
+		if elapsed > 0 {
+			d.siteRates[i] = float64(count-d.lastSite[i]) / elapsed.Seconds()
+		}
+		d.lastSite[i] = count
+	}
+
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		width, height = 120, 40
+	}
+	var lines []string
+	add := func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+	heading := func(title string) {
+		add("")
+		add("%s", color.BlueString(title))
+	}
+
+	state := "mining"
+	switch {
+	case st.Draining:
+		state = "draining"
+	case st.Paused:
+		state = "paused"
+	case !st.InWindow:
+		state = "outside mining windows"
+	}
+	add("%s  %s  up %s  %s  workers %d  %s", color.BlueString("PoWERC20 Miner"), now.Format("2006-01-02 15:04:05"), st.Uptime, state, st.Workers, color.GreenString("total %s", formatRate(st.Hashrate)))
+
+	heading("Contracts")
+	add("%-32s %-14s %5s %-8s %12s %10s %7s  %s", "NAME", "CHALLENGE", "DIFF", "TARGET", "HASHRATE", "ETA", "EFFORT", "STATE")
+	for i, site := range d.ctrl.sites {
+		cs := st.Contracts[i]
+		challenge, difficulty, target, eta := "-", "-", "-", "-"
+		if job := site.CurrentJob(); job != nil {
+			challenge = shortHex(job.Challenge)
+			difficulty = job.Difficulty.String()
+			// A zero target cannot be met and has no expected time.
+			if t := site.Scheme().Target(job); t.Sign() > 0 {
+				target = fmt.Sprintf("2^%d", t.BitLen()-1)
+				if d.siteRates[i] > 0 {
+					eta = formatSeconds(miner.ExpectedHashes(t) / d.siteRates[i])
+				}
+			}
+		}
+		effort := "-"
+		if i < len(st.Luck.Current) {
+			effort = fmt.Sprintf("%.0f%%", st.Luck.Current[i]*100)
+		}
+		add("%-32s %-14s %5s %-8s %12s %10s %7s  %s", truncate(site.Name(), 32), challenge, difficulty, target, formatRate(d.siteRates[i]), eta, effort, cs.State)
+	}
+
+	heading("Luck")
+	add("session: %d solutions found, %.2f expected from the hashes done", st.Luck.Found, st.Luck.Expected)
+	if st.Luck.Rounds == 0 {
+		add("no finished rounds yet")
+	} else {
+		add("%d rounds  mean effort %.0f%%  median %.0f%%", st.Luck.Rounds, st.Luck.MeanEffort*100, st.Luck.MedianEffort*100)
+		var max int
+		for _, b := range st.Luck.Distribution {
+			if b.Count > max {
+				max = b.Count
+			}
+		}
+		for _, b := range st.Luck.Distribution {
+			bar := strings.Repeat("█", b.Count*sparkWidth/max)
+			add("%-9s %5d %s", b.Label, b.Count, color.GreenString(bar))
+		}
+	}
+
+	heading("Account " + st.Account.Hex())
+	d.mu.Lock()
+	info := d.account
+	d.mu.Unlock()
+	if info == nil {
+		add("loading...")
+	} else {
+		add("ETH balance %s", formatUnits(info.balance, 18))
+		for _, site := range d.ctrl.sites {
+			mined := "-"
+			if times := info.times[site.Address()]; times != nil {
+				mined = times.String()
+				if limit := info.limits[site.Address()]; limit != nil {
+					mined += "/" + limit.String()
+				}
+			}
+			add("%-32s balance %s  mints %s", truncate(site.Name(), 32), formatUnits(info.tokens[site.Address()], site.Decimals()), mined)
+		}
+	}
+
+	heading(fmt.Sprintf("Pending transactions (%d queued solutions)", len(st.Queued)))
+	if len(st.PendingTxs) == 0 {
+		add("none")
+	}
+	for _, tx := range st.PendingTxs {
+		add("%-8s %s  max fee %s ETH  age %s", tx.Kind, tx.Hash.Hex(), tx.MaxFee, now.Sub(tx.SentAt).Round(time.Second))
+	}
+
+	heading("Workers")
+	for i, rate := range workerRates {
+		add("#%-3d %s %s", i, formatRate(rate), color.GreenString(sparkline(d.rates[i])))
+	}
+
+	heading("Events")
+	d.mu.Lock()
+	events := append([]string(nil), d.events...)
+	d.mu.Unlock()
+
+	// Keep the event pane at the bottom and cut the worker list if the
+	// screen is too small.
+	room := height - len(events) - 1
+	if room < len(lines) {
+		keep := room - 1
+		if keep < 0 {
+			keep = 0
+		}
+		lines = append(lines[:keep], fmt.Sprintf("... %d more lines", len(lines)-keep))
+	}
+	lines = append(lines, events...)
+
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	for i, line := range lines {
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString(truncateANSI(line, width))
+	}
+	io.WriteString(d.out, b.String())
+}
+
+// shortHex abbreviates a large number as hex.
+func shortHex(v *big.Int) string {
+	s := fmt.Sprintf("%x", v)
+	if len(s) > 10 {
+		s = s[:6] + "…" + s[len(s)-4:]
+	}
+	return "0x" + s
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
+
+// truncateANSI cuts s to width visible characters, keeping escape
+// sequences intact.
+func truncateANSI(s string, width int) string {
+	var b strings.Builder
+	visible := 0
+	escape := false
+	for _, r := range s {
+		switch {
+		case escape:
+			b.WriteRune(r)
+			if r >= '@' && r <= '~' && r != '[' {
+				escape = false
+			}
+		case r == '\x1b':
+			escape = true
+			b.WriteRune(r)
+		case visible < width:
+			b.WriteRune(r)
+			visible++
+		}
+	}
+	return b.String()
+}
+
+// printPlainStatus writes hashrate lines for logs that are not a terminal.
+func printPlainStatus(w io.Writer, now time.Time, ctrl *controller, siteRates []float64) {
+	fmt.Fprintf(w, "Mining[%s] Total hashes per second: %8.2f K/s\n", now.Format("2006-01-02 15:04:05"), ctrl.engine.Hashrate()/1000)
+	if len(ctrl.sites) > 1 {
+		for i, site := range ctrl.sites {
+			fmt.Fprintf(w, "    %-40s %8.2f K/s\n", site.Name(), siteRates[i]/1000)
+		}
+	}
+}
+
+// useDashboard reports whether the full-screen dashboard can be shown.
+func useDashboard(enabled bool) bool {
+	return enabled && term.IsTerminal(int(os.Stdout.Fd()))
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/fatih/color"
+	"github.com/sirupsen/logrus"
+)
+
+func TestSparkline(t *testing.T) {
+	for _, c := range []struct {
+		values []float64
+		want   string
+	}{
+		{nil, ""},
+		{[]float64{0, 0}, "▁▁"},
+		{[]float64{0, 1, 2, 4}, "▁▂▄█"},
+	} {
+		if got := sparkline(c.values); got != c.want {
+			t.Errorf("sparkline(%v) = %q, want %q", c.values, got, c.want)
+		}
+	}
+}
+
+func TestTruncateANSI(t *testing.T) {
+	for _, c := range []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{"hello", 10, "hello"},
+		{"hello", 3, "hel"},
+		{"\x1b[31mhello\x1b[0m world", 4, "\x1b[31mhell\x1b[0m"},
+		{"héllo", 2, "hé"},
+	} {
+		if got := truncateANSI(c.s, c.width); got != c.want {
+			t.Errorf("truncateANSI(%q, %d) = %q, want %q", c.s, c.width, got, c.want)
+		}
+	}
+}
+
+// renderDashboard renders the dashboard of a started miner of a token
+// with the given difficulty once its job is known.
+func renderDashboard(t *testing.T, difficulty int64, events ...string) string {
+	t.Helper()
+	chain, err := newSimChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctrl := testController(t, chain, chain.deploy("sim", difficulty, 1), common.Address{0x01})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := ctrl.engine.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer ctrl.engine.Stop()
+	for deadline := time.Now().Add(10 * time.Second); ctrl.sites[0].CurrentJob() == nil; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("no job was read in time")
+		}
+	}
+
+	var out bytes.Buffer
+	d := newDashboard(ctrl, nil)
+	d.out = &out
+	for _, msg := range events {
+		d.Fire(&logrus.Entry{Time: time.Now(), Level: logrus.WarnLevel, Message: msg})
+	}
+	d.render(time.Now(), time.Second)
+	return out.String()
+}
+
+// contractRow returns the first row of the contracts table.
+func contractRow(lines []string) string {
+	for i, line := range lines {
+		if strings.HasPrefix(line, "NAME ") && i+1 < len(lines) {
+			return lines[i+1]
+		}
+	}
+	return ""
+}
+
+func TestDashboardRender(t *testing.T) {
+	noColor := color.NoColor
+	color.NoColor = true
+	t.Cleanup(func() { color.NoColor = noColor })
+
+	screen := renderDashboard(t, 60, "something happened")
+	if !strings.HasPrefix(screen, "\x1b[H\x1b[2J") {
+		t.Errorf("screen %q does not start by clearing the terminal", screen)
+	}
+	lines := strings.Split(strings.TrimPrefix(screen, "\x1b[H\x1b[2J"), "\r\n")
+	for _, want := range []string{"Contracts", "Luck", "Account 0x0100000000000000000000000000000000000000", "Pending transactions (0 queued solutions)", "Workers", "Events"} {
+		found := false
+		for _, line := range lines {
+			found = found || line == want
+		}
+		if !found {
+			t.Errorf("no %q heading in %q", want, lines)
+		}
+	}
+	for _, want := range []string{
+		"no finished rounds yet",
+		"loading...",
+		"WARNING something happened",
+	} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("screen does not show %q:\n%s", want, screen)
+		}
+	}
+	row := contractRow(lines)
+	// Difficulty 60 is a target of 2^196, and the effort is shown.
+	if fields := strings.Fields(row); len(fields) < 4 || fields[2] != "60" || fields[3] != "2^196" || !strings.HasSuffix(fields[len(fields)-2], "%") {
+		t.Errorf("contract row %q, want difficulty 60, target 2^196 and an effort", row)
+	}
+	if last := lines[len(lines)-1]; !strings.HasSuffix(last, "something happened") {
+		t.Errorf("last line %q, want the event pane at the bottom", last)
+	}
+}
+
+func TestDashboardRenderZeroTarget(t *testing.T) {
+	noColor := color.NoColor
+	color.NoColor = true
+	t.Cleanup(func() { color.NoColor = noColor })
+
+	// Difficulties beyond 256 bits leave no hash that meets the target.
+	screen := renderDashboard(t, 300)
+	if strings.Contains(screen, "2^-1") {
+		t.Errorf("zero target rendered as 2^-1:\n%s", screen)
+	}
+	row := contractRow(strings.Split(screen, "\r\n"))
+	if fields := strings.Fields(row); len(fields) < 4 || fields[2] != "300" || fields[3] != "-" {
+		t.Errorf("contract row %q, want difficulty 300 and target -", row)
+	}
+}
+
+func TestDashboardStopped(t *testing.T) {
+	var out bytes.Buffer
+	d := &dashboard{out: &out}
+	d.stop()
+	out.Reset()
+	d.render(time.Now(), time.Second)
+	if out.Len() != 0 {
+		t.Errorf("stopped dashboard rendered %q", out.String())
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/external"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// errSignerRejected is returned when the external signer refuses to sign,
+// either because the operator denied the request or a rule rejected it.
+var errSignerRejected = errors.New("external signer rejected the request")
+
+// newExternalTransactor returns transact options whose Signer delegates to a
+// Clef-compatible signer at endpoint instead of holding the key in memory.
+// If from is the zero address the first account exposed by the signer is used.
+func newExternalTransactor(endpoint string, from common.Address, chainID *big.Int) (*bind.TransactOpts, error) {
+	clef, err := external.NewExternalSigner(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to external signer: %v", err)
+	}
+	available := clef.Accounts()
+	if len(available) == 0 {
+		return nil, errors.New("external signer exposes no accounts")
+	}
+	account := available[0]
+	if from != (common.Address{}) {
+		account = accounts.Account{Address: from}
+		if !clef.Contains(account) {
+			return nil, fmt.Errorf("external signer does not manage account %s", from.Hex())
+		}
+	}
+
+	signer := types.LatestSignerForChainID(chainID)
+	return &bind.TransactOpts{
+		From: account.Address,
+		Signer: func(address common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			if address != account.Address {
+				return nil, bind.ErrNotAuthorized
+			}
+			signed, err := clef.SignTx(account, tx, chainID)
+			if err != nil {
+				return nil, wrapSignerError(err)
+			}
+			// The signer returns a full transaction; make sure it signed
+			// what we asked for and not something else.
+			sender, err := types.Sender(signer, signed)
+			if err != nil {
+				return nil, fmt.Errorf("external signer returned an invalid signature: %v", err)
+			}
+			if sender != account.Address {
+				return nil, fmt.Errorf("external signer signed with %s instead of %s", sender.Hex(), account.Address.Hex())
+			}
+			if !sameTransaction(signed, tx) {
+				return nil, errors.New("external signer modified the transaction")
+			}
+			return signed, nil
+		},
+		Context: context.Background(),
+	}, nil
+}
+
+// sameTransaction reports whether signed carries the fields of tx that
+// decide what it does and what it may cost.
+func sameTransaction(signed, tx *types.Transaction) bool {
+	return signed.Nonce() == tx.Nonce() && signed.Gas() == tx.Gas() && signed.Value().Cmp(tx.Value()) == 0 &&
+		signed.GasFeeCap().Cmp(tx.GasFeeCap()) == 0 && signed.GasTipCap().Cmp(tx.GasTipCap()) == 0 &&
+		sameAddress(signed.To(), tx.To()) && bytes.Equal(signed.Data(), tx.Data())
+}
+
+// sameAddress compares optional addresses; nil is a contract creation.
+func sameAddress(a, b *common.Address) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// wrapSignerError turns a denial from the signer into errSignerRejected while
+// keeping the signer's own message.
+func wrapSignerError(err error) error {
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && strings.Contains(strings.ToLower(rpcErr.Error()), "denied") {
+		return fmt.Errorf("%w: %v", errSignerRejected, err)
+	}
+	return fmt.Errorf("external signer failed: %v", err)
+}
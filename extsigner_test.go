@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// standinSigner is a minimal in-process implementation of the Clef
+// account_* API backed by a single key, so the external signing path can be
+// tested without running Clef.
+type standinSigner struct {
+	key     *ecdsa.PrivateKey
+	address common.Address
+	chainID *big.Int
+	// approve decides whether a request is signed; nil approves everything.
+	approve func(args *apitypes.SendTxArgs) bool
+	// modify, if set, changes an approved request before it is signed, to
+	// test that callers notice.
+	modify func(args *apitypes.SendTxArgs)
+}
+
+// signTransactionResult mirrors the object Clef returns from
+// account_signTransaction.
+type signTransactionResult struct {
+	Raw hexutil.Bytes      `json:"raw"`
+	Tx  *types.Transaction `json:"tx"`
+}
+
+func (s *standinSigner) Version() string {
+	return "6.0.0"
+}
+
+func (s *standinSigner) List() []common.Address {
+	return []common.Address{s.address}
+}
+
+func (s *standinSigner) SignTransaction(ctx context.Context, args apitypes.SendTxArgs, methodSelector *string) (*signTransactionResult, error) {
+	if args.From.Address() != s.address {
+		return nil, fmt.Errorf("unknown account %s", args.From.Address().Hex())
+	}
+	if s.approve != nil && !s.approve(&args) {
+		signerLog.Warnf("Stand-in signer denied transaction from %s", args.From.Address().Hex())
+		return nil, errors.New("Request denied")
+	}
+	if s.modify != nil {
+		s.modify(&args)
+	}
+	if args.ChainID == nil {
+		args.ChainID = (*hexutil.Big)(s.chainID)
+	} else if args.ChainID.ToInt().Cmp(s.chainID) != 0 {
+		return nil, fmt.Errorf("requested chainid %v does not match the configured chainid %v", args.ChainID, s.chainID)
+	}
+	signed, err := types.SignTx(args.ToTransaction(), types.LatestSignerForChainID(s.chainID), s.key)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := signed.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return &signTransactionResult{Raw: raw, Tx: signed}, nil
+}
+
+// newStandinSignerHandler returns an HTTP handler serving the stand-in
+// signer's JSON-RPC API.
+func newStandinSignerHandler(s *standinSigner) (http.Handler, error) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("account", s); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+// startStandinSigner serves s over HTTP and returns transact options that
+// sign through it.
+func startStandinSigner(t *testing.T, s *standinSigner) *bind.TransactOpts {
+	t.Helper()
+	handler, err := newStandinSignerHandler(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	opts, err := newExternalTransactor(server.URL, s.address, s.chainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return opts
+}
+
+func newTestStandinSigner(t *testing.T) *standinSigner {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &standinSigner{key: key, address: crypto.PubkeyToAddress(key.PublicKey), chainID: big.NewInt(1337)}
+}
+
+func testMineTx() *types.Transaction {
+	to := common.HexToAddress(contractAddress)
+	return types.NewTx(&types.DynamicFeeTx{
+		ChainID:   big.NewInt(1337),
+		Nonce:     3,
+		GasTipCap: big.NewInt(1e9),
+		GasFeeCap: big.NewInt(3e9),
+		Gas:       100000,
+		To:        &to,
+		Value:     new(big.Int),
+		Data:      []byte{0x12, 0x34, 0x56, 0x78},
+	})
+}
+
+func TestExternalSignerAccepts(t *testing.T) {
+	s := newTestStandinSigner(t)
+	opts := startStandinSigner(t, s)
+	tx := testMineTx()
+	signed, err := opts.Signer(s.address, tx)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	sender, err := types.Sender(types.LatestSignerForChainID(s.chainID), signed)
+	if err != nil || sender != s.address {
+		t.Fatalf("signed by %s (%v), want %s", sender.Hex(), err, s.address.Hex())
+	}
+	if !sameTransaction(signed, tx) {
+		t.Fatal("signed transaction differs from the request")
+	}
+}
+
+func TestExternalSignerRejects(t *testing.T) {
+	s := newTestStandinSigner(t)
+	s.approve = func(*apitypes.SendTxArgs) bool { return false }
+	opts := startStandinSigner(t, s)
+	if _, err := opts.Signer(s.address, testMineTx()); !errors.Is(err, errSignerRejected) {
+		t.Fatalf("got %v, want errSignerRejected", err)
+	}
+}
+
+func TestExternalSignerModified(t *testing.T) {
+	for name, modify := range map[string]func(*apitypes.SendTxArgs){
+		"value": func(args *apitypes.SendTxArgs) { args.Value = hexutil.Big(*big.NewInt(1)) },
+		"to": func(args *apitypes.SendTxArgs) {
+			other := common.NewMixedcaseAddress(common.HexToAddress("0x000000000000000000000000000000000000dEaD"))
+			args.To = &other
+		},
+		"data": func(args *apitypes.SendTxArgs) {
+			data := hexutil.Bytes{0xde, 0xad, 0xbe, 0xef}
+			args.Data, args.Input = &data, nil
+		},
+		// A contract creation has no recipient at all; comparing it used
+		// to dereference nil.
+		"nil to": func(args *apitypes.SendTxArgs) { args.To = nil },
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := newTestStandinSigner(t)
+			s.modify = modify
+			opts := startStandinSigner(t, s)
+			_, err := opts.Signer(s.address, testMineTx())
+			if err == nil || !strings.Contains(err.Error(), "modified the transaction") {
+				t.Fatalf("got %v, want a modified transaction error", err)
+			}
+		})
+	}
+}
+
+func TestSameAddress(t *testing.T) {
+	a, b := common.HexToAddress("0x01"), common.HexToAddress("0x02")
+	for _, c := range []struct {
+		x, y *common.Address
+		want bool
+	}{
+		{nil, nil, true},
+		{&a, nil, false},
+		{nil, &a, false},
+		{&a, &b, false},
+		{&a, &a, true},
+	} {
+		if got := sameAddress(c.x, c.y); got != c.want {
+			t.Errorf("sameAddress(%v, %v) = %v, want %v", c.x, c.y, got, c.want)
+		}
+	}
+}
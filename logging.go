@@ -0,0 +1,334 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+	"github.com/sirupsen/logrus"
+)
+
+// subsystemLoggers holds one logrus logger per subsystem so that each can
+// have its own level. They share output and formatter.
+var subsystemLoggers = make(map[string]*logrus.Logger)
+
+// newSubsystemLogger returns the logger for a subsystem; every entry carries
+// a "subsystem" field.
+func newSubsystemLogger(name string) *logrus.Entry {
+	l := logrus.New()
+	l.SetFormatter(&terminalFormatter{colors: isatty.IsTerminal(os.Stderr.Fd())})
+	subsystemLoggers[name] = l
+	return l.WithField("subsystem", name)
+}
+
+var (
+	logger     = newSubsystemLogger("main")
+	schedLog   = newSubsystemLogger("scheduler")
+	submitLog  = newSubsystemLogger("submit")
+	profitLog  = newSubsystemLogger("profit")
+	sellLog    = newSubsystemLogger("sell")
+	policyLog  = newSubsystemLogger("policy")
+	signerLog  = newSubsystemLogger("signer")
+	verifyLog  = newSubsystemLogger("verify")
+	offlineLog = newSubsystemLogger("offline")
+	controlLog = newSubsystemLogger("control")
+	luckLog    = newSubsystemLogger("luck")
+)
+
+// withEvent tags an entry with a stable event name and key/value fields
+// such as contract, challenge, nonce and tx_hash. Values that implement
+// fmt.Stringer are logged as strings so that addresses, hashes and big
+// numbers render the same in every format.
+func withEvent(l *logrus.Entry, event string, kv ...interface{}) *logrus.Entry {
+	fields := logrus.Fields{"event": event}
+	for i := 0; i+1 < len(kv); i += 2 {
+		value := kv[i+1]
+		if s, ok := value.(fmt.Stringer); ok {
+			value = s.String()
+		}
+		fields[kv[i].(string)] = value
+	}
+	return l.WithFields(fields)
+}
+
+// accountHook adds the mining account to every entry.
+type accountHook string
+
+func (h accountHook) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (h accountHook) Fire(e *logrus.Entry) error {
+	if _, ok := e.Data["account"]; !ok {
+		e.Data["account"] = string(h)
+	}
+	return nil
+}
+
+// setLogAccount makes every subsystem log the given account.
+func setLogAccount(account string) {
+	for _, l := range subsystemLoggers {
+		l.AddHook(accountHook(account))
+	}
+}
+
+// eventColors is the message color of informational events in the
+// terminal; other info messages are green.
+var eventColors = map[string]func(string, ...interface{}) string{
+	"submitting":       color.YellowString,
+	"tx_submitted":     color.YellowString,
+	"tx_broadcast":     color.YellowString,
+	"approve":          color.YellowString,
+	"sell":             color.YellowString,
+	"gas_hold":         color.YellowString,
+	"contract_stopped": color.YellowString,
+	"draining":         color.YellowString,
+	"workers_started":  color.YellowString,
+	"offline_mode":     color.YellowString,
+}
+
+// terminalFormatter is the text format with colors for a terminal. Colors
+// are only ever added here, never in the messages themselves.
+type terminalFormatter struct {
+	colors bool
+}
+
+func (f *terminalFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	inner := &logrus.TextFormatter{
+		FullTimestamp:   true,
+		TimestampFormat: "2006-01-02 15:04:05",
+		DisableColors:   !f.colors,
+		ForceColors:     f.colors,
+	}
+	if !f.colors {
+		return inner.Format(e)
+	}
+	colored := *e
+	colored.Data = make(logrus.Fields, len(e.Data))
+	for k, v := range e.Data {
+		colored.Data[k] = v
+	}
+	if hash, ok := colored.Data["tx_hash"].(string); ok {
+		colored.Data["tx_hash"] = color.CyanString(hash)
+	}
+	paint := color.GreenString
+	switch {
+	case e.Level <= logrus.ErrorLevel:
+		paint = color.RedString
+	case e.Level == logrus.WarnLevel:
+		paint = color.YellowString
+	case e.Level > logrus.InfoLevel:
+		paint = fmt.Sprintf
+	default:
+		if event, ok := e.Data["event"].(string); ok && eventColors[event] != nil {
+			paint = eventColors[event]
+		}
+	}
+	colored.Message = paint("%s", e.Message)
+	return inner.Format(&colored)
+}
+
+// logConfig holds the logging flags.
+type logConfig struct {
+	format     string
+	levels     string
+	file       string
+	maxSize    int
+	maxAge     time.Duration
+	maxBackups int
+}
+
+// registerLogFlags adds the logging flags to fs.
+func registerLogFlags(fs *flag.FlagSet) *logConfig {
+	cfg := new(logConfig)
+	fs.StringVar(&cfg.format, "log-format", "text", "Log format: text or json")
+	fs.StringVar(&cfg.levels, "log-level", "info", "Log level, optionally per subsystem: info,scheduler=debug,policy=warn")
+	fs.StringVar(&cfg.file, "log-file", "", "Write logs to this file instead of the terminal")
+	fs.IntVar(&cfg.maxSize, "log-max-size", 100, "Rotate -log-file when it grows beyond this many MB (0 disables)")
+	fs.DurationVar(&cfg.maxAge, "log-max-age", 24*time.Hour, "Rotate -log-file when it is older than this (0 disables)")
+	fs.IntVar(&cfg.maxBackups, "log-max-backups", 7, "Number of rotated log files to keep (0 keeps all)")
+	return cfg
+}
+
+// setupLogging applies cfg to every subsystem logger.
+func setupLogging(cfg *logConfig) error {
+	var out io.Writer = os.Stderr
+	colors := isatty.IsTerminal(os.Stderr.Fd())
+	if cfg.file != "" {
+		f, err := openRotatingFile(cfg.file, int64(cfg.maxSize)<<20, cfg.maxAge, cfg.maxBackups)
+		if err != nil {
+			return err
+		}
+		out, colors = f, false
+	}
+
+	var formatter logrus.Formatter
+	switch cfg.format {
+	case "text":
+		formatter = &terminalFormatter{colors: colors}
+	case "json":
+		formatter = &logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano}
+	default:
+		return fmt.Errorf("unknown log format %q", cfg.format)
+	}
+
+	for _, l := range subsystemLoggers {
+		l.SetOutput(out)
+		l.SetFormatter(formatter)
+	}
+	return setLogLevels(cfg.levels)
+}
+
+// parseCommand parses the flags of a subcommand together with the logging
+// flags and applies them, so that subcommands log like the miner.
+func parseCommand(fs *flag.FlagSet, args []string) {
+	cfg := registerLogFlags(fs)
+	fs.Parse(args)
+	if err := setupLogging(cfg); err != nil {
+		logger.Fatalf("Invalid logging options: %v", err)
+	}
+}
+
+// setLogLevels applies a -log-level value such as info,scheduler=debug to
+// every subsystem logger.
+func setLogLevels(spec string) error {
+	levels := make(map[string]logrus.Level)
+	base := logrus.InfoLevel
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, levelName, scoped := strings.Cut(item, "=")
+		if !scoped {
+			levelName = name
+		}
+		level, err := logrus.ParseLevel(levelName)
+		if err != nil {
+			return err
+		}
+		if !scoped {
+			base = level
+			continue
+		}
+		if subsystemLoggers[name] == nil {
+			names := make([]string, 0, len(subsystemLoggers))
+			for n := range subsystemLoggers {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			return fmt.Errorf("unknown log subsystem %q, expected one of %s", name, strings.Join(names, ", "))
+		}
+		levels[name] = level
+	}
+
+	for name, l := range subsystemLoggers {
+		if level, ok := levels[name]; ok {
+			l.SetLevel(level)
+		} else {
+			l.SetLevel(base)
+		}
+	}
+	return nil
+}
+
+// rotatingFile is a log file that is renamed with a timestamp suffix and
+// reopened once it exceeds a size or age.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	file    *os.File // nil if reopening after a rotation failed
+	size    int64
+	opened  time.Time
+	lastErr string // last rotation failure reported on stderr
+}
+
+func openRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, maxAge: maxAge, maxBackups: maxBackups, now: time.Now}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file, r.size, r.opened = f, info.Size(), r.now()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	full := r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize
+	old := r.maxAge > 0 && r.now().Sub(r.opened) > r.maxAge
+	if full || old {
+		if err := r.rotate(); err != nil {
+			if r.file == nil {
+				return 0, err
+			}
+			// The entry still goes to the current file and rotation is
+			// tried again on the next write. The logger cannot report on
+			// itself, so the failure goes to stderr once.
+			if err.Error() != r.lastErr {
+				fmt.Fprintf(os.Stderr, "Failed to rotate %s: %v\n", r.path, err)
+				r.lastErr = err.Error()
+			}
+		} else {
+			r.lastErr = ""
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate moves the current file aside and prunes old backups; the caller
+// must hold r.mu. If the file cannot be moved it is reopened, so that
+// logging carries on in it.
+func (r *rotatingFile) rotate() error {
+	r.file.Close()
+	r.file = nil
+	// Nanoseconds keep backups of rotations within the same second apart
+	// and still sort by time.
+	backup := r.path + "." + r.now().Format("20060102-150405.000000000")
+	if err := os.Rename(r.path, backup); err != nil {
+		if reopenErr := r.open(); reopenErr != nil {
+			return fmt.Errorf("%v, and reopening it failed: %v", err, reopenErr)
+		}
+		return err
+	}
+	if r.maxBackups > 0 {
+		backups, _ := filepath.Glob(r.path + ".*")
+		sort.Strings(backups)
+		for len(backups) > r.maxBackups {
+			os.Remove(backups[0])
+			backups = backups[1:]
+		}
+	}
+	return r.open()
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// testRotatingFile opens a rotating file in a temporary directory whose
+// clock only moves when the returned function is called.
+func testRotatingFile(t *testing.T, maxSize int64, maxAge time.Duration, maxBackups int) (*rotatingFile, func(time.Duration)) {
+	t.Helper()
+	r, err := openRotatingFile(filepath.Join(t.TempDir(), "miner.log"), maxSize, maxAge, maxBackups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.file.Close() })
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	r.now = func() time.Time { return now }
+	r.opened = now
+	return r, func(d time.Duration) { now = now.Add(d) }
+}
+
+func writeLines(t *testing.T, r *rotatingFile, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		if _, err := r.Write([]byte(line + "\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// logContents returns the contents of the current file and the backups,
+// oldest first.
+func logContents(t *testing.T, r *rotatingFile) (current string, backups []string) {
+	t.Helper()
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := filepath.Glob(r.path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		backup, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		backups = append(backups, string(backup))
+	}
+	return string(data), backups
+}
+
+func TestRotatingFileSize(t *testing.T) {
+	r, advance := testRotatingFile(t, 10, 0, 3)
+	// Every line fills the file, and all rotations happen within the same
+	// second.
+	for _, line := range []string{"line 0", "line 1", "line 2", "line 3", "line 4"} {
+		writeLines(t, r, line)
+		advance(time.Millisecond)
+	}
+	current, backups := logContents(t, r)
+	if current != "line 4\n" {
+		t.Errorf("current file holds %q, want the last line", current)
+	}
+	// Four rotations, of which the newest three backups are kept.
+	want := []string{"line 1\n", "line 2\n", "line 3\n"}
+	if strings.Join(backups, "|") != strings.Join(want, "|") {
+		t.Errorf("backups hold %q, want %q", backups, want)
+	}
+}
+
+func TestRotatingFileAge(t *testing.T) {
+	r, advance := testRotatingFile(t, 0, time.Hour, 0)
+	writeLines(t, r, "old", "still young")
+	advance(2 * time.Hour)
+	writeLines(t, r, "new")
+	current, backups := logContents(t, r)
+	if current != "new\n" || len(backups) != 1 || backups[0] != "old\nstill young\n" {
+		t.Errorf("current %q and backups %q after the file aged", current, backups)
+	}
+}
+
+func TestRotatingFileRenameFails(t *testing.T) {
+	r, advance := testRotatingFile(t, 10, 0, 0)
+	writeLines(t, r, "line 0")
+	// A directory where the backup would go makes the rename fail.
+	blocked := r.path + "." + r.now().Format("20060102-150405.000000000")
+	if err := os.Mkdir(blocked, 0700); err != nil {
+		t.Fatal(err)
+	}
+	writeLines(t, r, "line 1")
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "line 0\nline 1\n" {
+		t.Fatalf("current file holds %q after a failed rotation, want both lines", data)
+	}
+
+	// Rotation is tried again once the rename can succeed.
+	if err := os.Remove(blocked); err != nil {
+		t.Fatal(err)
+	}
+	advance(time.Millisecond)
+	writeLines(t, r, "line 2")
+	current, backups := logContents(t, r)
+	if current != "line 2\n" || len(backups) != 1 || backups[0] != "line 0\nline 1\n" {
+		t.Errorf("current %q and backups %q after retrying the rotation", current, backups)
+	}
+}
+
+func TestSetLogLevels(t *testing.T) {
+	t.Cleanup(func() { setLogLevels("info") })
+	if err := setLogLevels("warn, scheduler=debug ,policy=error"); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]logrus.Level{
+		"main":      logrus.WarnLevel,
+		"submit":    logrus.WarnLevel,
+		"scheduler": logrus.DebugLevel,
+		"policy":    logrus.ErrorLevel,
+	} {
+		if got := subsystemLoggers[name].GetLevel(); got != want {
+			t.Errorf("%s logs at %s, want %s", name, got, want)
+		}
+	}
+	if err := setLogLevels(""); err != nil {
+		t.Fatal(err)
+	}
+	if got := subsystemLoggers["scheduler"].GetLevel(); got != logrus.InfoLevel {
+		t.Errorf("empty level logs at %s, want info", got)
+	}
+
+	for spec, want := range map[string]string{
+		"loud":           "not a valid logrus Level",
+		"scheduler=loud": "not a valid logrus Level",
+		"nope=debug":     `unknown log subsystem "nope"`,
+	} {
+		if err := setLogLevels(spec); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: got %v, want an error containing %q", spec, err, want)
+		}
+	}
+}
+
+func TestParseCommandLogging(t *testing.T) {
+	t.Cleanup(func() { setupLogging(&logConfig{format: "text", levels: "info"}) })
+	path := filepath.Join(t.TempDir(), "verify.log")
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	contract := fs.String("contractAddress", "", "")
+	parseCommand(fs, []string{"-log-format", "json", "-log-file", path, "-log-level", "warn,verify=info", "-contractAddress", "0x01"})
+	if *contract != "0x01" {
+		t.Errorf("-contractAddress is %q, want the subcommand's own flag parsed", *contract)
+	}
+
+	verifyLog.Info("checked")
+	logger.Info("hidden")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("logged %q, want one line", lines)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("log line %q is not JSON: %v", lines[0], err)
+	}
+	if entry["msg"] != "checked" || entry["subsystem"] != "verify" {
+		t.Errorf("logged %v, want the verify entry", entry)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"Powerc20Worker/miner"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// luckAlpha is the probability below which the observed number of
+// solutions is reported as inconsistent with the hashrate.
+const luckAlpha = 0.001
+
+// maxLuckRounds is how many of the latest rounds are kept in the luck
+// history, so that the file rewritten after every solution stays small.
+const maxLuckRounds = 1000
+
+// luckRound is one finished round: the hashes spent on a contract between
+// two solutions.
+type luckRound struct {
+	Contract common.Address `json:"contract"`
+	Hashes   uint64         `json:"hashes"`
+	// Effort is the work done in units of the expected work for one
+	// solution: 1 is an average round, below 1 is lucky.
+	Effort  float64   `json:"effort"`
+	EndedAt time.Time `json:"endedAt"`
+}
+
+// luckBucket counts rounds whose effort falls below Max.
+type luckBucket struct {
+	Label string  `json:"label"`
+	Max   float64 `json:"-"`
+	Count int     `json:"count"`
+}
+
+// luckSummary is the luck state shown in the dashboard and control API.
+type luckSummary struct {
+	Rounds       int           `json:"rounds"`
+	MeanEffort   float64       `json:"meanEffort"`
+	MedianEffort float64       `json:"medianEffort"`
+	Distribution []*luckBucket `json:"distribution"`
+	Current      []float64     `json:"currentEffort"` // per contract
+	Found        int           `json:"found"`         // this session
+	Expected     float64       `json:"expected"`      // this session
+}
+
+// luckTracker measures how much work each solution took compared to what
+// the difficulty predicts, and flags sessions whose solution count is
+// statistically implausible for the measured hashrate.
+type luckTracker struct {
+	sites []*miner.Contract
+	path  string
+
+	mu          sync.Mutex
+	last        []uint64  // hash counter at the previous sample
+	roundHashes []uint64  // hashes in the current round per contract
+	effort      []float64 // effort of the current round per contract
+	expected    float64   // expected solutions this session
+	found       int       // solutions found this session
+	rounds      []luckRound
+	lastCheck   time.Time
+	warned      bool
+}
+
+// newLuckTracker loads past rounds from path, if set, so that the luck
+// distribution spans restarts.
+func newLuckTracker(sites []*miner.Contract, path string) (*luckTracker, error) {
+	t := &luckTracker{
+		sites:       sites,
+		path:        path,
+		last:        make([]uint64, len(sites)),
+		roundHashes: make([]uint64, len(sites)),
+		effort:      make([]float64, len(sites)),
+		lastCheck:   time.Now(),
+	}
+	if path != "" {
+		if err := readJSONFile(path, &t.rounds); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to load luck history: %v", err)
+		}
+		t.trimLocked()
+	}
+	return t, nil
+}
+
+// trimLocked drops the rounds beyond the newest maxLuckRounds; the caller
+// must hold t.mu.
+func (t *luckTracker) trimLocked() {
+	if n := len(t.rounds); n > maxLuckRounds {
+		t.rounds = t.rounds[n-maxLuckRounds:]
+	}
+}
+
+// solveProbability is the chance that one hash meets target.
+func solveProbability(target *big.Int) float64 {
+	return 1 / miner.ExpectedHashes(target)
+}
+
+// sampleLocked adds the hashes done since the last sample to the current
+// rounds; the caller must hold t.mu.
+func (t *luckTracker) sampleLocked() {
+	for i, site := range t.sites {
+		count := site.Hashes()
+		delta := count - t.last[i]
+		t.last[i] = count
+		target := site.Target()
+		if delta == 0 || target == nil {
+			continue
+		}
+		work := float64(delta) * solveProbability(target)
+		t.roundHashes[i] += delta
+		t.effort[i] += work
+		t.expected += work
+	}
+}
+
+// sample updates the rounds and checks the solution rate once a minute.
+func (t *luckTracker) sample(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sampleLocked()
+	if now.Sub(t.lastCheck) >= time.Minute {
+		t.lastCheck = now
+		t.checkLocked()
+	}
+}
+
+// solved ends the current round on site.
+func (t *luckTracker) solved(site *miner.Contract) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sampleLocked()
+	for i, s := range t.sites {
+		if s != site {
+			continue
+		}
+		round := luckRound{Contract: site.Address(), Hashes: t.roundHashes[i], Effort: t.effort[i], EndedAt: time.Now()}
+		t.rounds = append(t.rounds, round)
+		t.roundHashes[i], t.effort[i] = 0, 0
+		t.found++
+		withEvent(luckLog, "round_luck", "contract", site.Address()).Infof("Round for %s took %.0f%% of the expected work (%d hashes)", site.Name(), round.Effort*100, round.Hashes)
+	}
+	t.trimLocked()
+	if t.path != "" {
+		if err := writeJSONFile(t.path, t.rounds); err != nil {
+			luckLog.Warnf("Failed to persist luck history: %v", err)
+		}
+	}
+}
+
+// poissonCDF returns P(X <= n) for X ~ Poisson(lambda).
+func poissonCDF(n int, lambda float64) float64 {
+	if n < 0 {
+		return 0
+	}
+	if lambda <= 0 {
+		return 1
+	}
+	var sum float64
+	for k := 0; k <= n; k++ {
+		lg, _ := math.Lgamma(float64(k + 1))
+		sum += math.Exp(float64(k)*math.Log(lambda) - lambda - lg)
+	}
+	return math.Min(sum, 1)
+}
+
+// checkLocked warns once when the number of solutions found this session
+// is implausible given the work done; the caller must hold t.mu.
+func (t *luckTracker) checkLocked() {
+	if t.expected <= 0 {
+		return
+	}
+	low := poissonCDF(t.found, t.expected)
+	high := 1 - poissonCDF(t.found-1, t.expected)
+	var msg string
+	switch {
+	case low < luckAlpha:
+		msg = fmt.Sprintf("found %d solutions where %.1f were expected (p=%.2g); hashes may not be computed correctly", t.found, t.expected, low)
+	case high < luckAlpha:
+		msg = fmt.Sprintf("found %d solutions where only %.1f were expected (p=%.2g); the target may be computed wrongly", t.found, t.expected, high)
+	}
+	if msg == "" {
+		t.warned = false
+		return
+	}
+	if !t.warned {
+		withEvent(luckLog, "luck_deviation").Warnf("Solution rate deviates from the hashrate: %s", msg)
+		t.warned = true
+	}
+}
+
+// summary returns the luck statistics.
+func (t *luckTracker) summary() *luckSummary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := &luckSummary{
+		Rounds:   len(t.rounds),
+		Current:  append([]float64(nil), t.effort...),
+		Found:    t.found,
+		Expected: t.expected,
+		Distribution: []*luckBucket{
+			{Label: "<25%", Max: 0.25},
+			{Label: "25-50%", Max: 0.5},
+			{Label: "50-100%", Max: 1},
+			{Label: "100-200%", Max: 2},
+			{Label: "200-400%", Max: 4},
+			{Label: ">400%", Max: math.Inf(1)},
+		},
+	}
+	if len(t.rounds) == 0 {
+		return s
+	}
+	efforts := make([]float64, len(t.rounds))
+	for i, r := range t.rounds {
+		efforts[i] = r.Effort
+		s.MeanEffort += r.Effort
+		for _, b := range s.Distribution {
+			if r.Effort < b.Max {
+				b.Count++
+				break
+			}
+		}
+	}
+	s.MeanEffort /= float64(len(efforts))
+	sort.Float64s(efforts)
+	s.MedianEffort = efforts[len(efforts)/2]
+	if len(efforts)%2 == 0 {
+		s.MedianEffort = (efforts[len(efforts)/2-1] + efforts[len(efforts)/2]) / 2
+	}
+	return s
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"Powerc20Worker/miner"
+)
+
+func TestPoissonCDF(t *testing.T) {
+	for _, c := range []struct {
+		n      int
+		lambda float64
+		want   float64
+	}{
+		{0, 1, 0.36787944117144233}, // e^-1
+		{2, 1, 0.9196986029286058},
+		{5, 10, 0.06708596287903186},
+		{10, 10, 0.5830397501929871},
+		{60, 100, 1.0812218170244307e-05},
+		{139, 100, 0.9999083534857737},
+		{-1, 5, 0},
+		{0, 0, 1},
+		{3, 0, 1},
+	} {
+		if got := poissonCDF(c.n, c.lambda); math.Abs(got-c.want) > 1e-12 {
+			t.Errorf("poissonCDF(%d, %g) = %.17g, want %.17g", c.n, c.lambda, got, c.want)
+		}
+	}
+}
+
+func TestLuckDeviationWarning(t *testing.T) {
+	var out bytes.Buffer
+	subsystemLoggers["luck"].SetOutput(&out)
+	t.Cleanup(func() { subsystemLoggers["luck"].SetOutput(os.Stderr) })
+
+	tracker, err := newLuckTracker(nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(found int, expected float64) string {
+		out.Reset()
+		tracker.found, tracker.expected = found, expected
+		tracker.checkLocked()
+		return out.String()
+	}
+	for _, c := range []struct {
+		found    int
+		expected float64
+		want     string // empty when no warning is due
+	}{
+		{100, 100, ""},
+		{75, 100, ""},  // p = 0.0055
+		{125, 100, ""}, // p = 0.0068
+		{0, 0, ""},
+		{60, 100, "hashes may not be computed correctly"}, // p = 1.1e-5
+		{140, 100, "the target may be computed wrongly"},  // p = 9.2e-5
+		{0, 10, "hashes may not be computed correctly"},   // p = 4.5e-5
+	} {
+		tracker.warned = false
+		got := check(c.found, c.expected)
+		if c.want == "" && got != "" {
+			t.Errorf("%d found of %g expected: warned %q", c.found, c.expected, got)
+		}
+		if c.want != "" && !strings.Contains(got, c.want) {
+			t.Errorf("%d found of %g expected: logged %q, want a warning that %s", c.found, c.expected, got, c.want)
+		}
+	}
+
+	// The warning is logged once until the rate is plausible again.
+	tracker.warned = false
+	if check(60, 100) == "" || check(61, 101) != "" {
+		t.Error("deviation warned about twice in a row")
+	}
+	check(100, 100)
+	if check(60, 100) == "" {
+		t.Error("deviation not warned about again after recovering")
+	}
+}
+
+func TestLuckHistoryCapped(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "luck.json")
+	rounds := make([]luckRound, maxLuckRounds+5)
+	for i := range rounds {
+		rounds[i] = luckRound{Hashes: uint64(i), Effort: 1, EndedAt: time.Unix(int64(i), 0)}
+	}
+	if err := writeJSONFile(path, rounds); err != nil {
+		t.Fatal(err)
+	}
+	site := &miner.Contract{}
+	tracker, err := newLuckTracker([]*miner.Contract{site}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := tracker.summary().Rounds; n != maxLuckRounds {
+		t.Fatalf("loaded %d rounds, want %d", n, maxLuckRounds)
+	}
+
+	tracker.solved(site)
+	var saved []luckRound
+	if err := readJSONFile(path, &saved); err != nil {
+		t.Fatal(err)
+	}
+	// The oldest rounds are dropped and the new one is last.
+	if len(saved) != maxLuckRounds || saved[0].Hashes != 6 || saved[len(saved)-2].Hashes != uint64(len(rounds)-1) {
+		t.Fatalf("saved %d rounds from %d to %d, want the latest %d", len(saved), saved[0].Hashes, saved[len(saved)-2].Hashes, maxLuckRounds)
+	}
+}
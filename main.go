@@ -2,73 +2,139 @@ package main
 
 import (
 	"context"
-	"crypto/rand"
+	"errors"
 	"flag"
 	"fmt"
 	"math/big"
-	"sync"
+	"os"
+	"runtime"
+	"strconv"
 	"time"
 
 	"Powerc20Worker/abi"
+	"Powerc20Worker/miner"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
-	"github.com/ethereum/go-ethereum/ethclient"
-	"github.com/fatih/color"
-	"github.com/gosuri/uilive"
-	"github.com/sirupsen/logrus"
 )
 
+// defaultContractAddress is the PoWERC20 deployment mined when
+// -contractAddress is not given.
+const defaultContractAddress = "0xca9b78435Be8267922E7Ac5cDE70401e7502c9cc"
+
 var (
-	infuraURL       = "https://rpc.ankr.com/eth"
-	privateKey      string
-	contractAddress string
-	workerCount     int
-	logger          = logrus.New()
+	infuraURL         = "https://rpc.ankr.com/eth"
+	privateKey        string
+	contractAddress   string
+	workerCount       string
+	retuneInterval    time.Duration
+	retuneDrop        float64
+	cpuBudget         float64
+	dutyCycle         string
+	niceLevel         int
+	mineSchedule      string
+	minerAddress      string
+	prepareOut        string
+	signerURL         string
+	policyCfg         *policyConfig
+	allowlistFile     string
+	allowUnverified   bool
+	schemeName        string
+	allocationMode    string
+	pollInterval      time.Duration
+	profitMode        string
+	tokenPrice        string
+	pricePairs        string
+	pairType          string
+	priceQuote        string
+	sellRouter        string
+	sellPairs         string
+	sellPercent       float64
+	sellSlippage      float64
+	mintGas           uint64
+	costPerHour       float64
+	minProfit         float64
+	resumeMargin      float64
+	queueFile         string
+	luckFile          string
+	maxGasPrice       string
+	metricsAddr       string
+	controlAddr       string
+	controlTokenValue string
+	controlTokenFile  string
+	showDashboard     bool
+	hasherName        string
+	configFile        string
+	shutdownTimeout   time.Duration
+	restartBackoff    time.Duration
+	maxFailures       int
+	failureWindow     time.Duration
+	logCfg            *logConfig
 )
 
-func init() {
-	flag.StringVar(&privateKey, "privateKey", "", "Private key for the Ethereum account")
-	flag.StringVar(&contractAddress, "contractAddress", "0xca9b78435Be8267922E7Ac5cDE70401e7502c9cc", "Address of the Ethereum contract")
-	flag.IntVar(&workerCount, "workerCount", 10, "Number of concurrent mining workers")
-
-	logger.SetFormatter(&logrus.TextFormatter{
-		FullTimestamp:   true,
-		TimestampFormat: "2006-01-02 15:04:05",
-	})
+// commands maps subcommand names to their entry points. Running the tool
+// without a subcommand starts the miner.
+var commands = map[string]func(args []string){
+	"prepare":   runPrepare,
+	"sign":      runSign,
+	"broadcast": runBroadcast,
+	"verify":    runVerify,
+	"ctl":       runCtl,
+	"price":     runPrice,
+	"selftest":  runSelftest,
+	"benchmark": runBenchmark,
 }
 
-func mineWorker(ctx context.Context, wg *sync.WaitGroup, contract *abi.PoWERC20, fromAddress common.Address, client *ethclient.Client, auth *bind.TransactOpts, resultChan chan<- *big.Int, errorChan chan<- error, challenge *big.Int, target *big.Int, hashCountChan chan<- int) {
-	defer wg.Done()
-
-	var nonce *big.Int
-	var err error
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			nonce, err = rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 256))
-			if err != nil {
-				errorChan <- fmt.Errorf("failed to generate random nonce: %v", err)
-				return
-			}
-
-			noncePadded := common.LeftPadBytes(nonce.Bytes(), 32)
-			challengePadded := common.LeftPadBytes(challenge.Bytes(), 32)
-			addressBytes := fromAddress.Bytes()
-			data := append(challengePadded, append(addressBytes, noncePadded...)...)
-			hash := crypto.Keccak256Hash(data)
-			if hash.Big().Cmp(target) == -1 {
-				resultChan <- nonce
-				return
-			}
-			hashCountChan <- 1
-
-		}
-	}
+func init() {
+	flag.StringVar(&infuraURL, "rpc", infuraURL, "Ethereum RPC endpoint")
+	flag.StringVar(&privateKey, "privateKey", "", "Private key for the Ethereum account")
+	flag.StringVar(&contractAddress, "contractAddress", defaultContractAddress, "Address of the Ethereum contract, or a comma-separated list of ADDRESS[:WEIGHT] to mine several")
+	flag.StringVar(&workerCount, "workerCount", "10", "Number of concurrent mining workers, or auto to calibrate it against the CPUs and cgroup quota")
+	flag.DurationVar(&retuneInterval, "retuneInterval", time.Minute, "With -workerCount auto, how often the hashrate is compared with the calibrated one; 0 calibrates only once")
+	flag.Float64Var(&retuneDrop, "retuneDrop", 15, "With -workerCount auto, how many percent the hashrate may move off the calibrated one before tuning again")
+	flag.Float64Var(&cpuBudget, "cpuBudget", 0, "Percentage of the available CPUs the workers may use together, for example 50; 0 means all")
+	flag.StringVar(&dutyCycle, "dutyCycle", "", "Hash ON out of every PERIOD and leave the CPUs idle otherwise, for example 300ms/1s")
+	flag.IntVar(&niceLevel, "nice", 0, "Lower the process priority to this nice value, 1 to 19")
+	flag.StringVar(&mineSchedule, "schedule", "", "Only hash during these local times of day, for example 22:00-07:00 or 12:00-13:00,20:00-23:00")
+	flag.StringVar(&hasherName, "hasher", "auto", "Keccak-256 backend: keccak256, sha3, unrolled, simd (the widest vector kernel) or auto to pick the fastest at startup")
+	flag.StringVar(&minerAddress, "address", "", "Mine for this address without a private key and write an unsigned transaction instead of submitting")
+	flag.StringVar(&signerURL, "signer", "", "URL of a Clef-compatible external signer to use instead of -privateKey")
+	flag.StringVar(&prepareOut, "prepareOut", "mine-unsigned.json", "File the unsigned transaction is written to when mining with -address")
+	flag.StringVar(&schemeName, "scheme", "powerc20", "Contract family to mine: powerc20, eip918 or the path of a JSON scheme config")
+	flag.StringVar(&allocationMode, "allocation", "weights", "How workers are split across contracts: weights or profit")
+	flag.DurationVar(&pollInterval, "pollInterval", 15*time.Second, "How often each contract's challenge and difficulty are refreshed")
+	flag.StringVar(&profitMode, "profitability", "off", "What to do when mining is unprofitable: off, pause (stop hashing) or hold (queue solutions until profitable)")
+	flag.StringVar(&tokenPrice, "tokenPrice", "", "Price of one whole token in ETH, used by -profitability")
+	flag.StringVar(&pricePairs, "pricePair", "", "Comma-separated Uniswap V2 pairs or V3 pools to price the tokens from when -tokenPrice is not set")
+	flag.StringVar(&pairType, "pairType", "auto", "Type of the -pricePair contracts: auto, v2 or v3")
+	flag.StringVar(&priceQuote, "priceQuote", wethAddress, "Token the -pricePair contracts trade against, normally WETH")
+	flag.StringVar(&sellRouter, "sellRouter", "", "Uniswap V2 router to sell minted tokens for ETH through after every mint; must be allowed with -policyAllowTo")
+	flag.StringVar(&sellPairs, "sellPair", "", "Comma-separated V2 pairs against -priceQuote used to compute the minimum sell output (default -pricePair)")
+	flag.Float64Var(&sellPercent, "sellPercent", 100, "Percentage of each mint's limitPerMint to sell when -sellRouter is set")
+	flag.Float64Var(&sellSlippage, "sellSlippage", 1, "Maximum slippage in percent below the reserve quote when selling")
+	flag.Uint64Var(&mintGas, "mintGas", 100000, "Gas used by a mine transaction until one has been observed")
+	flag.Float64Var(&costPerHour, "costPerHour", 0, "Operating cost of this miner in ETH per hour, used by -profitability")
+	flag.Float64Var(&minProfit, "minProfit", 0, "Minimum expected profit in ETH per mint, used by -profitability")
+	flag.Float64Var(&resumeMargin, "resumeMargin", 5, "Percent of the mint reward the expected profit must exceed -minProfit by before an unprofitable contract resumes")
+	flag.StringVar(&queueFile, "queueFile", "solutions.json", "File where found solutions wait for submission; empty keeps them in memory")
+	flag.StringVar(&luckFile, "luckFile", "luck.json", "File the effort of every found solution is kept in for luck statistics; empty keeps them in memory")
+	flag.StringVar(&maxGasPrice, "maxGasPrice", "", "Hold solutions while base fee plus tip is above this many gwei")
+	flag.StringVar(&metricsAddr, "metricsAddr", "", "Serve Prometheus metrics on this address, for example :9100")
+	flag.StringVar(&controlAddr, "controlAddr", "", "Serve the control API on host:port or unix:PATH, for example 127.0.0.1:8551")
+	flag.StringVar(&controlTokenValue, "controlToken", "", "Bearer token for the control API (default: generate one and write it to -controlTokenFile)")
+	flag.StringVar(&controlTokenFile, "controlTokenFile", "control.token", "File a generated control API token is written to")
+	flag.BoolVar(&showDashboard, "dashboard", true, "Show a full-screen dashboard when stdout is a terminal; otherwise print status lines")
+	flag.StringVar(&allowlistFile, "codeHashAllowlist", "", "JSON file with additional trusted contract code hashes")
+	flag.BoolVar(&allowUnverified, "allowUnverifiedContract", false, "Mine even if the contract code is not a verified PoWERC20 build")
+	flag.StringVar(&configFile, "config", "", "JSON file of flag values, for example {\"workerCount\": \"auto\"}; flags on the command line take precedence and SIGHUP reloads it")
+	flag.DurationVar(&restartBackoff, "restartBackoff", time.Second, "How long a failed worker or submitter waits before it restarts; doubled after every failure in a row up to a minute")
+	flag.IntVar(&maxFailures, "maxWorkerFailures", 10, "Stop mining once workers fail this many times within -failureWindow")
+	flag.DurationVar(&failureWindow, "failureWindow", 10*time.Minute, "Period -maxWorkerFailures is counted over")
+	flag.DurationVar(&shutdownTimeout, "shutdownTimeout", 30*time.Second, "How long a shutdown waits for pending transactions before leaving them to the next start")
+	policyCfg = registerPolicyFlags(flag.CommandLine)
+	logCfg = registerLogFlags(flag.CommandLine)
 }
 
 func main() {
@@ -79,117 +145,496 @@ func main() {
 // |  __/ (_) \ V  V / | |___|  _ <| |___ / __/| |_| | | |  | | | | | |  __/ |   
 // |_|   \___/ \_/\_/  |_____|_| \_\\____|_____|\___/  |_|  |_|_|_| |_|\___|_|   
 	`
+	// Subcommands print only their own output, so it can be piped.
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
+	}
 	fmt.Println(banner)
 	flag.Parse()
-	writer := uilive.New()
-
-	writer.Start()
-	defer writer.Stop()
-
-	logger.Info(color.GreenString("Establishing connection with Ethereum client..."))
-	client, err := ethclient.Dial(infuraURL)
-	if err != nil {
-		logger.Fatalf("Failed to connect to the Ethereum client: %v", err)
+	explicit := commandLineFlags()
+	if configFile != "" {
+		if err := applyConfigFile(configFile, explicit); err != nil {
+			logger.Fatalf("Invalid -config: %v", err)
+		}
+	}
+	if err := setupLogging(logCfg); err != nil {
+		logger.Fatalf("Invalid logging options: %v", err)
 	}
-	logger.Info(color.GreenString("Successfully connected to Ethereum client."))
-	privateKeyECDSA, err := crypto.HexToECDSA(privateKey)
+	logger.Info("Establishing connection with Ethereum client...")
+	client, err := dialInstrumented(infuraURL)
 	if err != nil {
-		logger.Fatalf("Error in parsing private key: %v", err)
+		logger.Fatalf("Failed to connect to the Ethereum client: %v", err)
 	}
+	logger.Info("Successfully connected to Ethereum client.")
 
 	chainID, err := client.NetworkID(context.Background())
 	if err != nil {
 		logger.Fatalf("Failed to get chainID: %v", err)
 	}
-	logger.Infof(color.GreenString("Successfully connected to Ethereum network with Chain ID: %v"), chainID)
+	logger.Infof("Successfully connected to Ethereum network with Chain ID: %v", chainID)
 
-	auth, err := bind.NewKeyedTransactorWithChainID(privateKeyECDSA, chainID)
-	if err != nil {
-		logger.Fatalf("Failed to create transactor: %v", err)
+	var auth *bind.TransactOpts
+	var fromAddress common.Address
+	switch {
+	case signerURL != "":
+		var from common.Address
+		if minerAddress != "" {
+			from = common.HexToAddress(minerAddress)
+		}
+		auth, err = newExternalTransactor(signerURL, from, chainID)
+		if err != nil {
+			logger.Fatalf("Failed to create external transactor: %v", err)
+		}
+		fromAddress = auth.From
+		logger.Infof("Transactions for %s will be signed by the external signer at %s", fromAddress.Hex(), signerURL)
+	case privateKey == "" && minerAddress != "":
+		// Without a key the miner only needs the account address for the
+		// hash preimage; the solution is handed to `sign` and `broadcast`.
+		if !common.IsHexAddress(minerAddress) {
+			logger.Fatalf("Invalid -address: %q", minerAddress)
+		}
+		fromAddress = common.HexToAddress(minerAddress)
+		withEvent(logger, "offline_mode").Infof("Mining for %s without a key, solutions will be written to %s", fromAddress.Hex(), prepareOut)
+	default:
+		privateKeyECDSA, err := crypto.HexToECDSA(privateKey)
+		if err != nil {
+			logger.Fatalf("Error in parsing private key: %v", err)
+		}
+		auth, err = bind.NewKeyedTransactorWithChainID(privateKeyECDSA, chainID)
+		if err != nil {
+			logger.Fatalf("Failed to create transactor: %v", err)
+		}
+		fromAddress = auth.From
 	}
 
-	contractAddr := common.HexToAddress(contractAddress)
-	contract, err := abi.NewPoWERC20(contractAddr, client)
+	setLogAccount(fromAddress.Hex())
+
+	scheme, err := miner.LoadScheme(schemeName)
 	if err != nil {
-		logger.Fatalf("Failed to instantiate a Token contract: %v", err)
+		logger.Fatalf("Failed to load mining scheme: %v", err)
 	}
-	logger.Info(color.GreenString("PoWERC20 token contract successfully instantiated."))
+	logger.Infof("Using mining scheme: %s", scheme.Name())
 
-	contractName, err := contract.Name(nil)
+	specs, err := miner.ParseContractList(contractAddress)
 	if err != nil {
-		logger.Fatalf("Failed to get contract name: %v", err)
+		logger.Fatalf("Invalid -contractAddress: %v", err)
+	}
+	if allocationMode != "weights" && allocationMode != "profit" {
+		logger.Fatalf("Invalid -allocation %q, expected weights or profit", allocationMode)
+	}
+	addresses := make([]common.Address, len(specs))
+	for i, spec := range specs {
+		addresses[i] = spec.Address
+	}
+	var policy *signingPolicy
+	if auth != nil {
+		policyCfg.stateFile = policyStatePath(policyCfg.stateFile, queueFile)
+		policy, err = newSigningPolicy(policyCfg, addresses...)
+		if err != nil {
+			logger.Fatalf("Failed to set up signing policy: %v", err)
+		}
+		policy.submitSelector = miner.SubmitSelector(scheme)
+		if sellRouter != "" && !policy.allowed[common.HexToAddress(sellRouter)] {
+			logger.Fatalf("Selling through %s needs the router in -policyAllowTo", sellRouter)
+		}
+		auth = policy.wrap(auth)
 	}
-	logger.Infof(color.GreenString("Contract Name: %s"), color.RedString(contractName))
 
-	challenge, err := contract.Challenge(nil)
-	if err != nil {
-		logger.Fatalf("Failed to get challenge: %v", err)
+	for i := range specs {
+		spec := &specs[i]
+		if err := checkContract(context.Background(), client, scheme, spec.Address, fromAddress, allowlistFile, allowUnverified); err != nil {
+			logger.Fatalf("Refusing to mine %s: %v", spec.Address.Hex(), err)
+		}
+		contract, err := abi.NewPoWERC20Caller(spec.Address, client)
+		if err != nil {
+			logger.Fatalf("Failed to instantiate a Token contract: %v", err)
+		}
+		contractName, err := contract.Name(nil)
+		if err != nil {
+			logger.Fatalf("Failed to get contract name: %v", err)
+		}
+		decimals, err := contract.Decimals(nil)
+		if err != nil {
+			logger.Fatalf("Failed to get contract decimals: %v", err)
+		}
+		spec.Name = fmt.Sprintf("%s (%s)", contractName, miner.ShortAddress(spec.Address))
+		spec.Decimals = decimals
+		spec.PauseUnprofitable = profitMode == "pause"
+		withEvent(logger, "contract_loaded", "contract", spec.Address).Infof("Contract Name: %s, weight %g", contractName, spec.Weight)
 	}
-	logger.Infof(color.GreenString("Current mining challenge number: %d"), challenge)
 
-	difficulty, err := contract.Difficulty(nil)
+	workers, autoWorkers, err := parseWorkerCount(workerCount)
 	if err != nil {
-		logger.Fatalf("Failed to get difficulty: %v", err)
+		logger.Fatalf("Invalid -workerCount: %v", err)
+	}
+	throttle, err := buildThrottle(cpuBudget, dutyCycle, mineSchedule, miner.AvailableCPUs())
+	if err != nil {
+		logger.Fatalf("%v", err)
+	}
+	if autoWorkers {
+		workers = budgetWorkers(workers, throttle)
+		quota := "none"
+		if q := miner.CPUQuota(); q > 0 {
+			quota = fmt.Sprintf("%.2f CPUs", q)
+		}
+		withEvent(tuneLog, "cpus_detected").Infof("%d CPUs available (%d online, cgroup quota %s), starting with %d workers", miner.AvailableCPUs(), runtime.NumCPU(), quota, workers)
+	}
+
+	if desc := throttle.String(); desc != "" {
+		withEvent(logger, "throttle_set").Infof("Throttling workers: %s", desc)
+	}
+	if niceLevel != 0 {
+		if niceLevel < 1 || niceLevel > 19 {
+			logger.Fatalf("Invalid -nice %d, expected 1 to 19", niceLevel)
+		}
+		if err := lowerPriority(niceLevel); err != nil {
+			logger.Fatalf("Failed to lower the process priority: %v", err)
+		}
+		logger.Infof("Process priority lowered to nice %d", niceLevel)
 	}
-	logger.Infof(color.GreenString("Current mining difficulty level: %d"), difficulty)
 
-	difficultyUint := uint(difficulty.Uint64())
-	target := new(big.Int).Lsh(big.NewInt(1), 256-difficultyUint)
-	logger.Infof(color.GreenString("Target number is: %d"), target)
+	hasher, err := resolveHasher(hasherName)
+	if err != nil {
+		logger.Fatalf("Invalid -hasher: %v", err)
+	}
 
-	resultChan := make(chan *big.Int)
 	errorChan := make(chan error)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	logger.Info(color.YellowString("Mining workers started..."))
-
-	hashCountChan := make(chan int)
-	totalHashCount := 0
-	ticker := time.NewTicker(1 * time.Second)
+	engine, err := miner.New(miner.Options{
+		Backend:   client,
+		Scheme:    scheme,
+		Contracts: specs,
+		Sender:    fromAddress,
+		Workers:   workers,
+		Hasher:    hasher,
+		Throttle:  throttle,
+		Supervision: miner.Supervision{
+			Backoff:     restartBackoff,
+			MaxFailures: maxFailures,
+			Window:      failureWindow,
+		},
+		Allocation:   allocationMode,
+		PollInterval: pollInterval,
+		Logger:       schedLog,
+	})
+	if err != nil {
+		logger.Fatalf("Failed to set up the miner: %v", err)
+	}
+	sites := engine.Contracts()
 
-	go func() {
-		for {
-			select {
-			case <-ticker.C:
-				timestamp := time.Now().Format("2006-01-02 15:04:05")
-				hashesPerSecond := float64(totalHashCount) / 1000.0
-				fmt.Fprintf(writer, "%s[%s] %s\n", color.BlueString("Mining"), timestamp, color.GreenString("Total hashes per second: %8.2f K/s", hashesPerSecond))
-				totalHashCount = 0
-			case count := <-hashCountChan:
-				totalHashCount += count
+	luck, err := newLuckTracker(sites, luckFile)
+	if err != nil {
+		logger.Fatalf("%v", err)
+	}
+	if metricsAddr != "" {
+		metrics.collect(func(emit func(string, float64, ...string)) {
+			st := engine.Stats()
+			emit("powerc20_hashrate", st.Hashrate, "worker", "total")
+			for i, rate := range st.WorkerRates {
+				emit("powerc20_hashrate", rate, "worker", strconv.Itoa(i))
+			}
+		})
+		metrics.collect(func(emit func(string, float64, ...string)) {
+			for _, site := range sites {
+				contract := site.Address().Hex()
+				emit("powerc20_contract_hashes_total", float64(site.Hashes()), "contract", contract)
+				if job := site.CurrentJob(); job != nil {
+					difficulty, _ := new(big.Float).SetInt(job.Difficulty).Float64()
+					emit("powerc20_difficulty", difficulty, "contract", contract)
+					emit("powerc20_job_info", 1, "contract", contract, "challenge", hexutil.EncodeBig(job.Challenge))
+				}
+			}
+			summary := luck.summary()
+			for i, site := range sites {
+				emit("powerc20_round_effort", summary.Current[i], "contract", site.Address().Hex())
 			}
+			emit("powerc20_expected_solutions_total", summary.Expected)
+		})
+		if err := serveMetrics(metricsAddr); err != nil {
+			logger.Fatalf("Failed to serve metrics: %v", err)
 		}
-	}()
+		logger.Infof("Serving metrics on http://%s/metrics", metricsAddr)
+	}
+	var profit *profitModel
+	if profitMode != "off" {
+		prices, err := parseTokenPrice(tokenPrice)
+		if err != nil {
+			logger.Fatalf("Invalid -tokenPrice: %v", err)
+		}
+		if prices == nil && pricePairs != "" {
+			pairs, err := parseAddressList(pricePairs)
+			if err != nil {
+				logger.Fatalf("Invalid -pricePair: %v", err)
+			}
+			prices, err = newPairPriceSource(ctx, client, common.HexToAddress(priceQuote), pairs, pairType)
+			if err != nil {
+				logger.Fatalf("Failed to set up on-chain token price: %v", err)
+			}
+		}
+		profit, err = newProfitModel(client, prices, engine.Hashrate, profitMode, mintGas, costPerHour, minProfit, resumeMargin/100)
+		if err != nil {
+			logger.Fatalf("Failed to set up profitability model: %v", err)
+		}
+		go profit.run(ctx, sites, pollInterval, engine.Rebalance)
+	}
 
-	var wg sync.WaitGroup
-	for i := 0; i < workerCount; i++ {
-		wg.Add(1)
-		go mineWorker(ctx, &wg, contract, auth.From, client, auth, resultChan, errorChan, challenge, target, hashCountChan)
+	if err := engine.Start(ctx); err != nil {
+		logger.Fatalf("Failed to start mining: %v", err)
 	}
+	defer engine.Stop()
+	withEvent(logger, "workers_started").Info("Mining workers started...")
 
-	select {
-	case nonce := <-resultChan:
-		ticker.Stop()
-		cancel()
-		wg.Wait()
-		logger.Infof(color.GreenString("Successfully discovered a valid nonce: %d"), nonce)
-		logger.Info(color.YellowString("Submitting mining transaction with nonce..."))
-		tx, err := contract.Mine(auth, nonce)
+	ctrl := &controller{
+		account: fromAddress,
+		engine:  engine,
+		sites:   sites,
+		luck:    luck,
+		started: time.Now(),
+		drain:   make(chan struct{}),
+	}
+	ctrl.tuner = newWorkerTuner(engine, workers, autoWorkers, retuneInterval, retuneDrop)
+	go ctrl.tuner.run(ctx)
+
+	// The submitter outlives ctx during a shutdown so that it can finish
+	// following transactions already sent.
+	subCtx, handOff := context.WithCancel(context.Background())
+	defer handOff()
+	submitterDone := make(chan struct{})
+	var enqueue func(*queuedSolution)
+	if auth != nil {
+		queue, err := loadSolutionQueue(queueFile)
 		if err != nil {
-			logger.Fatalf("Failed to submit mine transaction: %v", err)
+			logger.Fatalf("%v", err)
+		}
+		if n := queue.Len(); n > 0 {
+			logger.Infof("Loaded %d queued solution(s) from %s", n, queueFile)
 		}
-		receipt, err := bind.WaitMined(context.Background(), client, tx)
+		limit, err := parseGwei(maxGasPrice)
 		if err != nil {
-			logger.Fatalf("Failed to mine the transaction: %v", err)
+			logger.Fatalf("Invalid -maxGasPrice: %v", err)
 		}
-		logger.Infof(color.GreenString("Mining transaction successfully confirmed, Transaction Hash: %s"), color.CyanString(receipt.TxHash.Hex()))
+		bySite := make(map[common.Address]*miner.Contract, len(sites))
+		for _, site := range sites {
+			bySite[site.Address()] = site
+		}
+		var sell *seller
+		if sellRouter != "" {
+			if !common.IsHexAddress(sellRouter) {
+				logger.Fatalf("Invalid -sellRouter: %q", sellRouter)
+			}
+			list := sellPairs
+			if list == "" {
+				list = pricePairs
+			}
+			pairs, err := parseAddressList(list)
+			if err != nil {
+				logger.Fatalf("Invalid -sellPair: %v", err)
+			}
+			sell, err = newSeller(ctx, client, auth, common.HexToAddress(sellRouter), common.HexToAddress(priceQuote), pairs, sellPercent, sellSlippage)
+			if err != nil {
+				logger.Fatalf("Failed to set up selling: %v", err)
+			}
+			logger.Infof("Selling %g%% of every mint through %s", sellPercent, sellRouter)
+		}
+		sub := &submitter{
+			client:      client,
+			auth:        auth,
+			queue:       queue,
+			sites:       bySite,
+			profit:      profit,
+			seller:      sell,
+			policy:      policy,
+			maxGasPrice: limit,
+			interval:    pollInterval,
+		}
+		go func() {
+			defer close(submitterDone)
+			sub.supervise(subCtx, restartBackoff, errorChan)
+		}()
+		if sell != nil {
+			sell.track, sell.sendMu = sub.track, &sub.sendMu
+			go sell.run(subCtx)
+		}
+		ctrl.queue, ctrl.sub = queue, sub
+		enqueue = queue.push
+	}
 
-	case err := <-errorChan:
+	if controlAddr != "" {
+		token, err := controlToken(controlTokenValue, controlTokenFile)
+		if err != nil {
+			logger.Fatalf("%v", err)
+		}
+		if err := ctrl.serve(controlAddr, token); err != nil {
+			logger.Fatalf("Failed to start control API: %v", err)
+		}
+		logger.Infof("Control API listening on %s", controlAddr)
+	}
+
+	var dash *dashboard
+	if useDashboard(showDashboard) {
+		dash = newDashboard(ctrl, client)
+		dash.start(ctx, logCfg.file != "")
+		defer dash.stop()
+	}
+	reload := &reloader{path: configFile, explicit: explicit, ctrl: ctrl}
+	signals := make(chan os.Signal, 1)
+	notifySignals(signals)
+	finish := func() {
+		if dash != nil {
+			dash.stop()
+		}
+		printSessionSummary(os.Stdout, ctrl)
+	}
+	// abort stops after an error that cannot be recovered from, keeping
+	// the queued solutions and transactions in flight like a shutdown.
+	abort := func(err error) {
+		withEvent(logger, "mining_failed").Errorf("Mining operation failed due to an error: %v", err)
 		cancel()
-		wg.Wait()
-		logger.Fatalf("Mining operation failed due to an error: %v", err)
+		shutdown(ctrl, shutdownTimeout, signals, errorChan, handOff, submitterDone)
+		finish()
+		os.Exit(1)
+	}
+
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	go func() {
+		last, lastPlain := time.Now(), time.Now()
+		lastHashes := make([]uint64, len(sites))
+		for now := range ticker.C {
+			luck.sample(now)
+			if dash != nil {
+				dash.render(now, now.Sub(last))
+				last = now
+				continue
+			}
+			elapsed := now.Sub(lastPlain)
+			if elapsed < plainStatusInterval {
+				continue
+			}
+			siteRates := make([]float64, len(sites))
+			for i, site := range sites {
+				count := site.Hashes()
+				siteRates[i] = float64(count-lastHashes[i]) / elapsed.Seconds()
+				lastHashes[i] = count
+			}
+			printPlainStatus(os.Stdout, now, ctrl, siteRates)
+			lastPlain = now
+		}
+	}()
+
+	for {
+		select {
+		case ev := <-engine.Events():
+			switch ev.Type {
+			case miner.ErrorEvent:
+				abort(ev.Err)
+			case miner.WorkerFailedEvent:
+				kind := "error"
+				var p *miner.PanicError
+				if errors.As(ev.Err, &p) {
+					kind = "panic"
+				}
+				metrics.add("powerc20_worker_failures_total", 1, "kind", kind)
+			}
+			if ev.Type != miner.SolutionEvent {
+				continue
+			}
+			sol := ev.Solution
+			withEvent(logger, "solution_found", "contract", sol.Contract.Address(), "challenge", sol.Job.Challenge, "nonce", sol.Nonce).Infof("Successfully discovered a valid nonce for %s: %d", sol.Contract.Name(), sol.Nonce)
+			metrics.add("powerc20_solutions_found_total", 1, "contract", sol.Contract.Address().Hex())
+			luck.solved(sol.Contract)
+			if auth == nil {
+				engine.Stop()
+				data, err := scheme.SubmitData(sol.Job, sol.Nonce, sol.Digest)
+				if err != nil {
+					logger.Fatalf("Failed to encode solution: %v", err)
+				}
+				unsigned, err := prepareMineTx(context.Background(), client, fromAddress, sol.Contract.Address(), scheme.Name(), data, sol.Nonce, sol.Job.Challenge, 0)
+				if err != nil {
+					logger.Fatalf("Failed to prepare mine transaction: %v", err)
+				}
+				if err := writeJSONFile(prepareOut, unsigned); err != nil {
+					logger.Fatalf("Failed to write unsigned transaction: %v", err)
+				}
+				logger.Infof("Unsigned mine transaction written to %s, sign it offline and broadcast it", prepareOut)
+				finish()
+				return
+			}
+			enqueue(&queuedSolution{
+				Contract:   sol.Contract.Address(),
+				Sender:     fromAddress,
+				Challenge:  (*hexutil.Big)(sol.Job.Challenge),
+				Difficulty: (*hexutil.Big)(sol.Job.Difficulty),
+				Nonce:      (*hexutil.Big)(sol.Nonce),
+				Digest:     sol.Digest,
+				FoundAt:    time.Now(),
+			})
+			engine.Resume(sol.Contract)
+
+		case err := <-errorChan:
+			abort(err)
+
+		case sig := <-signals:
+			switch sig {
+			case reloadSignal:
+				if err := reload.reload(); err != nil {
+					withEvent(logger, "config_reload_failed").Errorf("Failed to reload %s: %v", configFile, err)
+				}
+			case statsSignal:
+				logStats(ctrl)
+			default:
+				withEvent(logger, "shutdown", "signal", sig.String()).Infof("Received %s, shutting down", sig)
+				cancel()
+				shutdown(ctrl, shutdownTimeout, signals, errorChan, handOff, submitterDone)
+				finish()
+				return
+			}
+
+		case <-ctrl.drain:
+			ctrl.tuner.disable()
+			engine.Stop()
+			drainQueue(ctrl, errorChan)
+			finish()
+			return
+
+		case <-engine.Done():
+			engine.Stop()
+			withEvent(logger, "completed").Info("Mining process successfully completed")
+			finish()
+			return
+		}
 	}
-	logger.Info(color.GreenString("Mining process successfully completed"))
 }
 
+// drainQueue waits until every queued solution has been submitted and every
+// sent transaction has been mined.
+func drainQueue(ctrl *controller, errorChan <-chan error) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	logged := -1
+	for {
+		queued, inflight := 0, 0
+		if ctrl.queue != nil {
+			queued, inflight = ctrl.queue.Len(), len(ctrl.sub.pendingTxs())
+		}
+		if queued == 0 && inflight == 0 {
+			withEvent(logger, "drained").Info("Drained, exiting")
+			return
+		}
+		if queued+inflight != logged {
+			withEvent(logger, "draining").Infof("Draining: hashing stopped, waiting for %d queued solution(s) and %d pending transaction(s)", queued, inflight)
+			logged = queued + inflight
+		}
+		select {
+		case err := <-errorChan:
+			logger.Fatalf("Mining operation failed due to an error: %v", err)
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// latencyBuckets are the upper bounds in seconds of the RPC latency
+// histogram.
+var latencyBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// seriesKey identifies one time series: a metric name and its rendered
+// label set.
+type seriesKey struct {
+	name   string
+	labels string
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, cumulative when rendered
+	sum    float64
+	count  uint64
+}
+
+// metricsRegistry holds the miner's metrics and renders them in the
+// Prometheus text exposition format. Gauges that mirror existing state and
+// counters kept elsewhere are read through collectors at scrape time
+// instead of being kept up to date.
+type metricsRegistry struct {
+	mu         sync.Mutex
+	help       map[string]string
+	kinds      map[string]string
+	values     map[seriesKey]float64
+	hists      map[seriesKey]*histogram
+	collectors []func(emit func(name string, value float64, labels ...string))
+}
+
+func newMetricsRegistry() *metricsRegistry {
+	return &metricsRegistry{
+		help:   make(map[string]string),
+		kinds:  make(map[string]string),
+		values: make(map[seriesKey]float64),
+		hists:  make(map[seriesKey]*histogram),
+	}
+}
+
+// metrics is the registry served on -metricsAddr.
+var metrics = newMetricsRegistry()
+
+func init() {
+	metrics.describe("powerc20_hashrate", "gauge", "Hashes per second, per worker and in total.")
+	metrics.describe("powerc20_contract_hashes_total", "counter", "Hashes spent on each contract.")
+	metrics.describe("powerc20_difficulty", "gauge", "Current mining difficulty of each contract.")
+	metrics.describe("powerc20_job_info", "gauge", "Current challenge of each contract, as a label.")
+	metrics.describe("powerc20_round_effort", "gauge", "Work done in the current round of each contract, in expected solutions.")
+	metrics.describe("powerc20_expected_solutions_total", "counter", "Solutions the hashes done this session should have found on average.")
+	metrics.describe("powerc20_solutions_found_total", "counter", "Solutions found by the workers.")
+	metrics.describe("powerc20_worker_failures_total", "counter", "Worker errors and panics, by kind.")
+	metrics.describe("powerc20_solutions_stale_total", "counter", "Queued solutions discarded before submission.")
+	metrics.describe("powerc20_transactions_submitted_total", "counter", "Transactions sent, by kind.")
+	metrics.describe("powerc20_transactions_confirmed_total", "counter", "Transactions mined successfully, by kind.")
+	metrics.describe("powerc20_transactions_reverted_total", "counter", "Transactions mined but reverted, by kind.")
+	metrics.describe("powerc20_gas_spent_eth_total", "counter", "Fees paid in ETH, by kind.")
+	metrics.describe("powerc20_tokens_minted_total", "counter", "Whole tokens minted per contract.")
+	metrics.describe("powerc20_rpc_request_duration_seconds", "histogram", "Latency of JSON-RPC requests per endpoint and method.")
+	metrics.describe("powerc20_rpc_errors_total", "counter", "Failed JSON-RPC requests per endpoint and method.")
+}
+
+func (r *metricsRegistry) describe(name, kind, help string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.kinds[name] = kind
+	r.help[name] = help
+}
+
+// labelEscaper escapes label values the way the text exposition format
+// expects: only backslashes, double quotes and newlines.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// renderLabels formats key/value pairs as a Prometheus label set.
+func renderLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		parts = append(parts, labels[i]+`="`+labelEscaper.Replace(labels[i+1])+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// add increments a counter by v.
+func (r *metricsRegistry) add(name string, v float64, labels ...string) {
+	r.mu.Lock()
+	r.values[seriesKey{name, renderLabels(labels)}] += v
+	r.mu.Unlock()
+}
+
+// observe records v in a histogram.
+func (r *metricsRegistry) observe(name string, v float64, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := seriesKey{name, renderLabels(labels)}
+	h := r.hists[key]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		r.hists[key] = h
+	}
+	for i, bound := range latencyBuckets {
+		if v <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// collect registers a function that emits series at scrape time.
+func (r *metricsRegistry) collect(fn func(emit func(name string, value float64, labels ...string))) {
+	r.mu.Lock()
+	r.collectors = append(r.collectors, fn)
+	r.mu.Unlock()
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// ServeHTTP writes every metric in the text exposition format.
+func (r *metricsRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	collectors := append([]func(func(string, float64, ...string)){}, r.collectors...)
+	r.mu.Unlock()
+
+	// Collected series are gathered outside the lock since collectors read
+	// miner state that has its own locks.
+	gauges := make(map[seriesKey]float64)
+	for _, fn := range collectors {
+		fn(func(name string, value float64, labels ...string) {
+			gauges[seriesKey{name, renderLabels(labels)}] = value
+		})
+	}
+
+	r.mu.Lock()
+	series := make(map[string][]string)
+	for _, key := range sortedKeys(r.values) {
+		series[key.name] = append(series[key.name], key.name+key.labels+" "+formatValue(r.values[key]))
+	}
+	for _, key := range sortedKeys(gauges) {
+		series[key.name] = append(series[key.name], key.name+key.labels+" "+formatValue(gauges[key]))
+	}
+	histKeys := make([]seriesKey, 0, len(r.hists))
+	for key := range r.hists {
+		histKeys = append(histKeys, key)
+	}
+	sortSeries(histKeys)
+	for _, key := range histKeys {
+		h := r.hists[key]
+		inner := strings.TrimSuffix(strings.TrimPrefix(key.labels, "{"), "}")
+		if inner != "" {
+			inner += ","
+		}
+		var cumulative uint64
+		for i, bound := range latencyBuckets {
+			cumulative += h.counts[i]
+			series[key.name] = append(series[key.name], fmt.Sprintf("%s_bucket{%sle=%q} %d", key.name, inner, formatValue(bound), cumulative))
+		}
+		series[key.name] = append(series[key.name],
+			fmt.Sprintf("%s_bucket{%sle=\"+Inf\"} %d", key.name, inner, h.count),
+			fmt.Sprintf("%s_sum%s %s", key.name, key.labels, formatValue(h.sum)),
+			fmt.Sprintf("%s_count%s %d", key.name, key.labels, h.count))
+	}
+	names := make([]string, 0, len(series))
+	for name := range series {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s %s\n", name, r.help[name], name, r.kinds[name])
+		for _, line := range series[name] {
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+		}
+	}
+	r.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+func sortSeries(keys []seriesKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].name != keys[j].name {
+			return keys[i].name < keys[j].name
+		}
+		return keys[i].labels < keys[j].labels
+	})
+}
+
+func sortedKeys(values map[seriesKey]float64) []seriesKey {
+	keys := make([]seriesKey, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sortSeries(keys)
+	return keys
+}
+
+// recordReceipt counts a mined transaction of the given kind ("mine",
+// "approve" or "swap") sent to contract and the fee it paid.
+func recordReceipt(kind string, contract common.Address, receipt *types.Receipt) {
+	labels := []string{"contract", contract.Hex(), "kind", kind}
+	if receipt.Status == types.ReceiptStatusSuccessful {
+		metrics.add("powerc20_transactions_confirmed_total", 1, labels...)
+	} else {
+		metrics.add("powerc20_transactions_reverted_total", 1, labels...)
+	}
+	if receipt.EffectiveGasPrice != nil {
+		fee := new(big.Int).Mul(receipt.EffectiveGasPrice, new(big.Int).SetUint64(receipt.GasUsed))
+		metrics.add("powerc20_gas_spent_eth_total", weiToEther(fee), labels...)
+	}
+}
+
+// serveMetrics starts the /metrics endpoint on addr.
+func serveMetrics(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			logger.Errorf("Metrics server stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// rpcTransport times JSON-RPC requests and counts failures, labelled with
+// the endpoint host and the method called.
+type rpcTransport struct {
+	endpoint string
+	inner    http.RoundTripper
+}
+
+func (t *rpcTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	method := "unknown"
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		var call struct {
+			Method string `json:"method"`
+		}
+		if json.Unmarshal(body, &call) == nil && call.Method != "" {
+			method = call.Method
+		} else if bytes.HasPrefix(bytes.TrimSpace(body), []byte("[")) {
+			method = "batch"
+		}
+	}
+
+	start := time.Now()
+	resp, err := t.inner.RoundTrip(req)
+	metrics.observe("powerc20_rpc_request_duration_seconds", time.Since(start).Seconds(), "endpoint", t.endpoint, "method", method)
+	if err != nil {
+		metrics.add("powerc20_rpc_errors_total", 1, "endpoint", t.endpoint, "method", method)
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		metrics.add("powerc20_rpc_errors_total", 1, "endpoint", t.endpoint, "method", method)
+		return resp, nil
+	}
+	// Look for a JSON-RPC error object in single-call responses.
+	if method != "batch" {
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			metrics.add("powerc20_rpc_errors_total", 1, "endpoint", t.endpoint, "method", method)
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		var reply struct {
+			Error json.RawMessage `json:"error"`
+		}
+		if json.Unmarshal(body, &reply) == nil && len(reply.Error) > 0 && string(reply.Error) != "null" {
+			metrics.add("powerc20_rpc_errors_total", 1, "endpoint", t.endpoint, "method", method)
+		}
+	}
+	return resp, nil
+}
+
+// dialInstrumented connects to an Ethereum node, recording RPC metrics for
+// HTTP endpoints. Only the host is used as the endpoint label so that API
+// keys in the path do not end up in metrics.
+func dialInstrumented(rawurl string) (*ethclient.Client, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ethclient.Dial(rawurl)
+	}
+	httpClient := &http.Client{Transport: &rpcTransport{endpoint: u.Host, inner: http.DefaultTransport}}
+	c, err := rpc.DialOptions(context.Background(), rawurl, rpc.WithHTTPClient(httpClient))
+	if err != nil {
+		return nil, err
+	}
+	return ethclient.NewClient(c), nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMetricsExposition(t *testing.T) {
+	r := newMetricsRegistry()
+	r.describe("test_requests_total", "counter", "Requests handled.")
+	r.describe("test_latency_seconds", "histogram", "Request latency.")
+	r.describe("test_workers", "gauge", "Running workers.")
+	r.add("test_requests_total", 2, "path", `C:\tmp`, "note", "say \"hi\"\nbye")
+	r.add("test_requests_total", 1, "path", "/b")
+	r.add("test_requests_total", 1, "path", "/b")
+	for _, v := range []float64{0.005, 0.03, 0.03, 0.7, 20} {
+		r.observe("test_latency_seconds", v, "method", "eth_call")
+	}
+	r.collect(func(emit func(string, float64, ...string)) {
+		emit("test_workers", 4)
+	})
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("content type %q, want the text exposition format", ct)
+	}
+	want := `# HELP test_latency_seconds Request latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{method="eth_call",le="0.01"} 1
+test_latency_seconds_bucket{method="eth_call",le="0.025"} 1
+test_latency_seconds_bucket{method="eth_call",le="0.05"} 3
+test_latency_seconds_bucket{method="eth_call",le="0.1"} 3
+test_latency_seconds_bucket{method="eth_call",le="0.25"} 3
+test_latency_seconds_bucket{method="eth_call",le="0.5"} 3
+test_latency_seconds_bucket{method="eth_call",le="1"} 4
+test_latency_seconds_bucket{method="eth_call",le="2.5"} 4
+test_latency_seconds_bucket{method="eth_call",le="5"} 4
+test_latency_seconds_bucket{method="eth_call",le="10"} 4
+test_latency_seconds_bucket{method="eth_call",le="+Inf"} 5
+test_latency_seconds_sum{method="eth_call"} 20.765
+test_latency_seconds_count{method="eth_call"} 5
+# HELP test_requests_total Requests handled.
+# TYPE test_requests_total counter
+test_requests_total{path="/b"} 2
+test_requests_total{path="C:\\tmp",note="say \"hi\"\nbye"} 2
+# HELP test_workers Running workers.
+# TYPE test_workers gauge
+test_workers 4
+`
+	if got := rec.Body.String(); got != want {
+		t.Errorf("exposition:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRPCErrorReplyCounted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.Copy(io.Discard, req.Body)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"header not found"}}`)
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := seriesKey{"powerc20_rpc_errors_total", renderLabels([]string{"endpoint", u.Host, "method", "eth_blockNumber"})}
+	count := func() float64 {
+		metrics.mu.Lock()
+		defer metrics.mu.Unlock()
+		return metrics.values[key]
+	}
+
+	client, err := dialInstrumented(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	before := count()
+	if _, err := client.BlockNumber(context.Background()); err == nil || !strings.Contains(err.Error(), "header not found") {
+		t.Fatalf("got %v, want the node's error", err)
+	}
+	if got := count() - before; got != 1 {
+		t.Errorf("error reply counted %g times, want once", got)
+	}
+}
@@ -0,0 +1,69 @@
+package miner
+
+import (
+	"context"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/sirupsen/logrus"
+)
+
+// BenchmarkPool runs workers real mining workers hashing with h on a
+// PoWERC20 job that is never solved, and returns the hashes per second
+// measured over d after they all started.
+func BenchmarkPool(ctx context.Context, h Hasher, workers int, d time.Duration) (float64, error) {
+	scheme, err := NewPoWERC20Scheme()
+	if err != nil {
+		return 0, err
+	}
+	quiet := logrus.New()
+	quiet.SetOutput(io.Discard)
+	m := &Miner{
+		opts: Options{
+			Scheme:  scheme,
+			Sender:  common.HexToAddress("0x1E4481159013D3Aa8dF7623Fc9B26daE5bcC0a73"),
+			Hasher:  h,
+			Workers: workers,
+		},
+		log:    logrus.NewEntry(quiet),
+		stats:  newHashStats(workers),
+		sup:    newSupervisor(Supervision{}),
+		events: make(chan Event, 64),
+	}
+	c := newContract(ContractSpec{Name: "benchmark"}, scheme, m)
+	// No digest is below a zero target.
+	c.job = &Job{Challenge: big.NewInt(0x5eed), Difficulty: big.NewInt(256)}
+	c.target = new(big.Int)
+	m.contracts = []*Contract{c}
+	m.sched = newScheduler(m.contracts, "weights", workers, m.log)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go m.sched.run(ctx, time.Minute)
+	pool := newWorkerPool(m.sup.start(ctx), m.supervise)
+	pool.resize(workers)
+	defer pool.stop()
+
+	for m.sched.workers()[0] < workers {
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	// Let every worker prepare its hasher before measuring.
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-time.After(100 * time.Millisecond):
+	}
+	start, before := time.Now(), m.stats.Total()
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-time.After(d):
+	}
+	return float64(m.stats.Total()-before) / time.Since(start).Seconds(), nil
+}
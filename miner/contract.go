@@ -0,0 +1,336 @@
+package miner
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ContractSpec describes a contract to mine.
+type ContractSpec struct {
+	Address common.Address
+	// Weight is the contract's share of the workers relative to the other
+	// contracts; zero counts as one.
+	Weight float64
+	// Name is shown in logs; it defaults to the address.
+	Name string
+	// Decimals of the token, used to express rewards in whole tokens.
+	Decimals uint8
+	// PauseUnprofitable stops hashing while the contract is marked
+	// unprofitable instead of only flagging it.
+	PauseUnprofitable bool
+}
+
+// ParseContractList parses a comma-separated list of addresses with an
+// optional ":weight" suffix each.
+func ParseContractList(list string) ([]ContractSpec, error) {
+	var specs []ContractSpec
+	seen := make(map[common.Address]bool)
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		addr, weight := item, 1.0
+		if i := strings.IndexByte(item, ':'); i >= 0 {
+			w, err := strconv.ParseFloat(item[i+1:], 64)
+			if err != nil || w <= 0 || math.IsInf(w, 0) {
+				return nil, fmt.Errorf("invalid weight in %q", item)
+			}
+			addr, weight = item[:i], w
+		}
+		if !common.IsHexAddress(addr) {
+			return nil, fmt.Errorf("invalid contract address %q", addr)
+		}
+		address := common.HexToAddress(addr)
+		if seen[address] {
+			return nil, fmt.Errorf("contract %s listed twice", address.Hex())
+		}
+		seen[address] = true
+		specs = append(specs, ContractSpec{Address: address, Weight: weight})
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("no contract address given")
+	}
+	return specs, nil
+}
+
+// Contract tracks one contract being mined: its current job, whether it
+// can still be mined and how many hashes went into it.
+type Contract struct {
+	address           common.Address
+	name              string
+	scheme            Scheme
+	weight            float64
+	decimals          uint8
+	pauseUnprofitable bool
+	m                 *Miner
+
+	mu           sync.RWMutex
+	job          *Job
+	target       *big.Int
+	reward       *big.Int
+	paused       bool   // a solution for the current job is being handed off
+	exhausted    string // why the contract can no longer be mined, if it can't
+	unprofitable string // why mining is currently not worth it, if it isn't
+
+	hashes  atomic.Uint64
+	refresh chan struct{}
+}
+
+func newContract(spec ContractSpec, scheme Scheme, m *Miner) *Contract {
+	c := &Contract{
+		address:           spec.Address,
+		name:              spec.Name,
+		scheme:            scheme,
+		weight:            spec.Weight,
+		decimals:          spec.Decimals,
+		pauseUnprofitable: spec.PauseUnprofitable,
+		m:                 m,
+		refresh:           make(chan struct{}, 1),
+	}
+	if c.name == "" {
+		c.name = spec.Address.Hex()
+	}
+	if c.weight <= 0 {
+		c.weight = 1
+	}
+	return c
+}
+
+// Address returns the contract address.
+func (c *Contract) Address() common.Address { return c.address }
+
+// Name returns the display name of the contract.
+func (c *Contract) Name() string { return c.name }
+
+// Scheme returns the scheme the contract is mined with.
+func (c *Contract) Scheme() Scheme { return c.scheme }
+
+// Decimals returns the token decimals from the spec.
+func (c *Contract) Decimals() uint8 { return c.decimals }
+
+// PausesUnprofitable reports whether hashing stops while the contract is
+// unprofitable.
+func (c *Contract) PausesUnprofitable() bool { return c.pauseUnprofitable }
+
+// Hashes returns the number of hashes done on the contract.
+func (c *Contract) Hashes() uint64 { return c.hashes.Load() }
+
+// CurrentJob returns the latest job seen by the watcher, even while the
+// contract is paused.
+func (c *Contract) CurrentJob() *Job {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.job
+}
+
+// Target returns the target of the current job, or nil.
+func (c *Contract) Target() *big.Int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.target
+}
+
+// Reward returns the token base units a mint pays, or nil if the scheme
+// cannot tell.
+func (c *Contract) Reward() *big.Int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.reward
+}
+
+// Exhausted returns why the contract can no longer be mined, or an empty
+// string.
+func (c *Contract) Exhausted() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.exhausted
+}
+
+// Unprofitable returns why mining the contract is currently not worth it,
+// or an empty string.
+func (c *Contract) Unprofitable() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.unprofitable
+}
+
+// SetUnprofitable marks the contract unprofitable for reason, or profitable
+// again if reason is empty, and returns the previous reason. Call
+// Miner.Rebalance after a change so that workers move.
+func (c *Contract) SetUnprofitable(reason string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	was := c.unprofitable
+	c.unprofitable = reason
+	return was
+}
+
+// State describes the contract in a few words: mining, waiting for job,
+// exhausted or unprofitable with the reason.
+func (c *Contract) State() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	switch {
+	case c.exhausted != "":
+		return "exhausted: " + c.exhausted
+	case c.unprofitable != "":
+		return "unprofitable: " + c.unprofitable
+	case c.job == nil:
+		return "waiting for job"
+	}
+	return "mining"
+}
+
+// RequestRefresh asks the watcher to read the job again now.
+func (c *Contract) RequestRefresh() {
+	select {
+	case c.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// work returns the job workers should hash on, or false if the contract
+// should not be mined right now.
+func (c *Contract) work() (*Job, *big.Int, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.job == nil || c.paused || c.exhausted != "" || (c.pauseUnprofitable && c.unprofitable != "") {
+		return nil, nil, false
+	}
+	return c.job, c.target, true
+}
+
+// active reports whether workers should be allocated to the contract.
+func (c *Contract) active() bool {
+	_, _, ok := c.work()
+	return ok
+}
+
+// claim pauses the contract while a solution to job is handed off, so that
+// other workers do not report the same job twice. It returns false if the
+// job is no longer current or another worker already claimed it.
+func (c *Contract) claim(job *Job) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.job != job || c.paused {
+		return false
+	}
+	c.paused = true
+	return true
+}
+
+// resume makes the contract minable again after a hand-off and asks the
+// watcher for a fresh job.
+func (c *Contract) resume() {
+	c.mu.Lock()
+	c.paused = false
+	c.mu.Unlock()
+	c.RequestRefresh()
+}
+
+// ExpectedHashes is the average number of hashes needed to find a solution,
+// 2^256 / target.
+func ExpectedHashes(target *big.Int) float64 {
+	if target == nil || target.Sign() == 0 {
+		return math.Inf(1)
+	}
+	space := new(big.Float).SetInt(new(big.Int).Lsh(big.NewInt(1), 256))
+	f, _ := space.Quo(space, new(big.Float).SetInt(target)).Float64()
+	return f
+}
+
+// score is the share of hashpower the contract should get relative to the
+// others under the given allocation mode.
+func (c *Contract) score(mode string) float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if mode != "profit" {
+		return c.weight
+	}
+	// Expected reward per hash; contracts without a known reward count as
+	// paying one unit.
+	reward := 1.0
+	if c.reward != nil {
+		reward, _ = new(big.Float).SetInt(c.reward).Float64()
+	}
+	return c.weight * reward / ExpectedHashes(c.target)
+}
+
+// watch keeps the contract's job up to date, polling every interval and
+// whenever a refresh is requested.
+func (c *Contract) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		c.poll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-c.refresh:
+		}
+	}
+}
+
+func (c *Contract) poll(ctx context.Context) {
+	caller, sender, log := c.m.opts.Backend, c.m.opts.Sender, c.m.log
+	job, err := c.scheme.FetchJob(ctx, caller, c.address, sender)
+	if err != nil {
+		log.Warnf("Failed to refresh job for %s: %v", c.name, err)
+		return
+	}
+	target := c.scheme.Target(job)
+
+	var exhausted string
+	if checker, ok := c.scheme.(LimitChecker); ok {
+		if exhausted, err = checker.Exhausted(ctx, caller, c.address, sender); err != nil {
+			log.Warnf("Failed to check limits for %s: %v", c.name, err)
+		}
+	}
+	var reward *big.Int
+	if reader, ok := c.scheme.(RewardReader); ok {
+		if reward, err = reader.Reward(ctx, caller, c.address); err != nil {
+			log.Warnf("Failed to get mint reward for %s: %v", c.name, err)
+		}
+	}
+
+	c.mu.Lock()
+	changed := c.job == nil || c.job.Challenge.Cmp(job.Challenge) != 0 || c.target.Cmp(target) != 0
+	if changed {
+		c.job, c.target = job, target
+	}
+	if reward != nil {
+		c.reward = reward
+	}
+	newlyExhausted := exhausted != "" && c.exhausted == ""
+	if exhausted != c.exhausted {
+		changed = true
+	}
+	c.exhausted = exhausted
+	c.mu.Unlock()
+
+	if newlyExhausted {
+		c.m.contractExhausted(c, exhausted)
+	} else if changed && exhausted == "" {
+		c.m.newJob(c, job)
+	}
+	if changed {
+		c.m.Rebalance()
+	}
+}
+
+// ShortAddress abbreviates an address for status output.
+func ShortAddress(addr common.Address) string {
+	hex := addr.Hex()
+	return hex[:6] + "…" + hex[len(hex)-4:]
+}
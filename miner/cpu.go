@@ -0,0 +1,189 @@
+package miner
+
+import (
+	"bufio"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// CPUQuota returns how many CPUs the cgroup of this process may use, from
+// cpu.max (cgroup v2) or cpu.cfs_quota_us and cpu.cfs_period_us (cgroup
+// v1), the tightest limit of the cgroup and its parents. It returns 0 when
+// there is no limit or no cgroup to read, for example outside Linux.
+func CPUQuota() float64 {
+	return cgroupQuota(os.DirFS("/"))
+}
+
+// cgroupQuota is CPUQuota for the file system root; paths in it have no
+// leading slash.
+func cgroupQuota(root fs.FS) float64 {
+	mounts, err := cgroupMounts(root)
+	if err != nil {
+		return 0
+	}
+	paths, err := cgroupPaths(root)
+	if err != nil {
+		return 0
+	}
+	quota := 0.0
+	for _, mnt := range mounts {
+		cgroup, ok := paths[mnt.controller]
+		if !ok {
+			continue
+		}
+		// Inside a cgroup namespace the mount root is the process's own
+		// cgroup or one of its parents.
+		rel, err := filepath.Rel(mnt.root, cgroup)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			rel = "."
+		}
+		point := fsPath(mnt.point)
+		for dir := path.Join(point, filepath.ToSlash(rel)); ; dir = path.Dir(dir) {
+			if q := readCPUQuota(root, dir, mnt.controller == ""); q > 0 && (quota == 0 || q < quota) {
+				quota = q
+			}
+			if dir == point || !strings.HasPrefix(dir, point) {
+				break
+			}
+		}
+	}
+	return quota
+}
+
+// fsPath turns an absolute path into a name in an fs.FS of the root.
+func fsPath(p string) string {
+	if p = strings.TrimPrefix(path.Clean(p), "/"); p == "" {
+		return "."
+	}
+	return p
+}
+
+// AvailableCPUs returns the number of CPUs this process can keep busy:
+// runtime.NumCPU capped by CPUQuota rounded up, and at least one.
+func AvailableCPUs() int {
+	n := runtime.NumCPU()
+	if q := CPUQuota(); q > 0 {
+		n = min(n, int(math.Ceil(q)))
+	}
+	return max(n, 1)
+}
+
+// cgroupMount is a mounted cgroup hierarchy with the cpu controller;
+// controller is "cpu" for cgroup v1 and empty for cgroup v2.
+type cgroupMount struct {
+	controller string
+	root       string // cgroup the mount point shows
+	point      string
+}
+
+// cgroupMounts finds the cgroup hierarchies with the cpu controller in
+// /proc/self/mountinfo.
+func cgroupMounts(root fs.FS) ([]cgroupMount, error) {
+	f, err := root.Open("proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var mounts []cgroupMount
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// 36 35 0:30 / /sys/fs/cgroup/cpu,cpuacct rw,nosuid - cgroup cgroup rw,cpu,cpuacct
+		pre, post, ok := strings.Cut(scanner.Text(), " - ")
+		fields, tail := strings.Fields(pre), strings.Fields(post)
+		if !ok || len(fields) < 5 || len(tail) < 3 {
+			continue
+		}
+		switch tail[0] {
+		case "cgroup2":
+			mounts = append(mounts, cgroupMount{root: fields[3], point: fields[4]})
+		case "cgroup":
+			if hasController(tail[2], "cpu") {
+				mounts = append(mounts, cgroupMount{controller: "cpu", root: fields[3], point: fields[4]})
+			}
+		}
+	}
+	return mounts, scanner.Err()
+}
+
+// hasController reports whether the comma-separated list has name.
+func hasController(list, name string) bool {
+	for _, item := range strings.Split(list, ",") {
+		if item == name {
+			return true
+		}
+	}
+	return false
+}
+
+// cgroupPaths reads the cgroups of this process from /proc/self/cgroup:
+// the cgroup v2 one keyed by "" and the cgroup v1 one with the cpu
+// controller keyed by "cpu".
+func cgroupPaths(root fs.FS) (map[string]string, error) {
+	f, err := root.Open("proc/self/cgroup")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	paths := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// 4:cpu,cpuacct:/docker/abc or 0::/user.slice
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		switch {
+		case parts[1] == "":
+			paths[""] = parts[2]
+		case hasController(parts[1], "cpu"):
+			paths["cpu"] = parts[2]
+		}
+	}
+	return paths, scanner.Err()
+}
+
+// readCPUQuota reads the CPU limit of the cgroup directory dir, 0 when it
+// has none.
+func readCPUQuota(root fs.FS, dir string, v2 bool) float64 {
+	if v2 {
+		data, err := fs.ReadFile(root, path.Join(dir, "cpu.max"))
+		if err != nil {
+			return 0
+		}
+		// "max 100000" or "50000 100000"
+		fields := strings.Fields(string(data))
+		if len(fields) != 2 || fields[0] == "max" {
+			return 0
+		}
+		return quotaRatio(fields[0], fields[1])
+	}
+	quota, err := fs.ReadFile(root, path.Join(dir, "cpu.cfs_quota_us"))
+	if err != nil {
+		return 0
+	}
+	period, err := fs.ReadFile(root, path.Join(dir, "cpu.cfs_period_us"))
+	if err != nil {
+		return 0
+	}
+	return quotaRatio(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+}
+
+// quotaRatio divides a quota by its period; -1 and bad values mean no
+// limit.
+func quotaRatio(quota, period string) float64 {
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil || q <= 0 {
+		return 0
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil || p <= 0 {
+		return 0
+	}
+	return q / p
+}
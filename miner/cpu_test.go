@@ -0,0 +1,81 @@
+package miner
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+const (
+	mountV1 = "36 35 0:30 / /sys/fs/cgroup/cpu,cpuacct rw,nosuid - cgroup cgroup rw,cpu,cpuacct\n"
+	mountV2 = "30 25 0:26 / /sys/fs/cgroup rw,nosuid - cgroup2 cgroup2 rw\n"
+)
+
+func file(s string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(s)} }
+
+func TestCgroupQuota(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		fs   fstest.MapFS
+		want float64
+	}{
+		{"v1 unlimited", fstest.MapFS{
+			"proc/self/mountinfo": file(mountV1),
+			"proc/self/cgroup":    file("4:cpu,cpuacct:/docker/abc\n"),
+			"sys/fs/cgroup/cpu,cpuacct/docker/abc/cpu.cfs_quota_us":  file("-1\n"),
+			"sys/fs/cgroup/cpu,cpuacct/docker/abc/cpu.cfs_period_us": file("100000\n"),
+		}, 0},
+		{"v1 limited", fstest.MapFS{
+			"proc/self/mountinfo": file(mountV1),
+			"proc/self/cgroup":    file("4:cpu,cpuacct:/docker/abc\n"),
+			"sys/fs/cgroup/cpu,cpuacct/docker/abc/cpu.cfs_quota_us":  file("150000\n"),
+			"sys/fs/cgroup/cpu,cpuacct/docker/abc/cpu.cfs_period_us": file("100000\n"),
+		}, 1.5},
+		{"v2 unlimited", fstest.MapFS{
+			"proc/self/mountinfo":              file(mountV2),
+			"proc/self/cgroup":                 file("0::/user.slice\n"),
+			"sys/fs/cgroup/user.slice/cpu.max": file("max 100000\n"),
+		}, 0},
+		{"v2 limited", fstest.MapFS{
+			"proc/self/mountinfo":              file(mountV2),
+			"proc/self/cgroup":                 file("0::/user.slice\n"),
+			"sys/fs/cgroup/user.slice/cpu.max": file("50000 100000\n"),
+		}, 0.5},
+		{"v2 parent limit", fstest.MapFS{
+			"proc/self/mountinfo":                     file(mountV2),
+			"proc/self/cgroup":                        file("0::/kubepods/pod1/ctr\n"),
+			"sys/fs/cgroup/kubepods/pod1/ctr/cpu.max": file("max 100000\n"),
+			"sys/fs/cgroup/kubepods/pod1/cpu.max":     file("200000 100000\n"),
+			"sys/fs/cgroup/kubepods/cpu.max":          file("400000 100000\n"),
+		}, 2},
+		{"v2 child tighter than parent", fstest.MapFS{
+			"proc/self/mountinfo":       file(mountV2),
+			"proc/self/cgroup":          file("0::/a/b\n"),
+			"sys/fs/cgroup/a/b/cpu.max": file("25000 100000\n"),
+			"sys/fs/cgroup/a/cpu.max":   file("100000 100000\n"),
+		}, 0.25},
+		// Inside a cgroup namespace the mount shows the container's cgroup
+		// at the mount point.
+		{"v2 namespaced root", fstest.MapFS{
+			"proc/self/mountinfo":   file("30 25 0:26 /docker/abc /sys/fs/cgroup rw - cgroup2 cgroup2 rw\n"),
+			"proc/self/cgroup":      file("0::/docker/abc\n"),
+			"sys/fs/cgroup/cpu.max": file("300000 100000\n"),
+		}, 3},
+		{"v1 namespaced root", fstest.MapFS{
+			"proc/self/mountinfo":                 file("36 35 0:30 /docker/abc /sys/fs/cgroup/cpu rw - cgroup cgroup rw,cpu\n"),
+			"proc/self/cgroup":                    file("4:cpu:/docker/abc\n"),
+			"sys/fs/cgroup/cpu/cpu.cfs_quota_us":  file("50000\n"),
+			"sys/fs/cgroup/cpu/cpu.cfs_period_us": file("100000\n"),
+		}, 0.5},
+		// A cgroup outside the mounted root reads the mount point.
+		{"v2 cgroup outside the mount", fstest.MapFS{
+			"proc/self/mountinfo":   file("30 25 0:26 /docker/abc /sys/fs/cgroup rw - cgroup2 cgroup2 rw\n"),
+			"proc/self/cgroup":      file("0::/other\n"),
+			"sys/fs/cgroup/cpu.max": file("100000 100000\n"),
+		}, 1},
+		{"no cgroup files", fstest.MapFS{}, 0},
+	} {
+		if got := cgroupQuota(c.fs); got != c.want {
+			t.Errorf("%s: quota %v, want %v", c.name, got, c.want)
+		}
+	}
+}
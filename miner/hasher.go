@@ -0,0 +1,294 @@
+package miner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/crypto/sha3"
+)
+
+// hashLanes is how many nonces a worker hands to its hasher per call.
+const hashLanes = 8
+
+// keccakRate is the Keccak-256 block size in bytes.
+const keccakRate = 136
+
+// Hasher is a Keccak-256 backend. The preimages workers hash differ only in
+// a 32-byte nonce word, so a backend is prepared once per job and then
+// hashes nonces in batches.
+type Hasher interface {
+	Name() string
+	// Prepare returns a NonceHasher for template, whose 32 bytes at offset
+	// are replaced by each nonce. The result is used by one goroutine.
+	Prepare(template []byte, offset int) (NonceHasher, error)
+}
+
+// NonceHasher hashes nonces into a prepared template.
+type NonceHasher interface {
+	// Hash writes the digest of the template with nonces[i] to out[i]; out
+	// must be at least as long as nonces.
+	Hash(nonces [][32]byte, out []common.Hash)
+}
+
+// hashers are the built-in backends, the reference first, then the
+// multi-buffer ones this CPU supports.
+var hashers = append([]Hasher{referenceHasher{}, sha3Hasher{}, unrolledHasher{}}, simdHashers()...)
+
+// Hashers returns the built-in backends.
+func Hashers() []Hasher { return append([]Hasher(nil), hashers...) }
+
+// HasherByName returns the built-in backend called name; simd is the
+// widest multi-buffer backend on this CPU.
+func HasherByName(name string) (Hasher, error) {
+	if name == "simd" {
+		return bestSIMDHasher(), nil
+	}
+	var names []string
+	for _, h := range hashers {
+		if h.Name() == name {
+			return h, nil
+		}
+		names = append(names, h.Name())
+	}
+	return nil, fmt.Errorf("unknown hasher %q, expected one of %v", name, names)
+}
+
+func checkTemplate(template []byte, offset int) error {
+	if offset < 0 || offset+32 > len(template) {
+		return fmt.Errorf("nonce at %d does not fit a %d-byte preimage", offset, len(template))
+	}
+	return nil
+}
+
+// referenceHasher hashes every preimage from scratch with
+// crypto.Keccak256Hash, which is what SolutionDigest does.
+type referenceHasher struct{}
+
+func (referenceHasher) Name() string { return "keccak256" }
+
+func (referenceHasher) Prepare(template []byte, offset int) (NonceHasher, error) {
+	if err := checkTemplate(template, offset); err != nil {
+		return nil, err
+	}
+	return &referenceNonceHasher{buf: bytes.Clone(template), offset: offset}, nil
+}
+
+type referenceNonceHasher struct {
+	buf    []byte
+	offset int
+}
+
+func (h *referenceNonceHasher) Hash(nonces [][32]byte, out []common.Hash) {
+	for i := range nonces {
+		copy(h.buf[h.offset:], nonces[i][:])
+		out[i] = crypto.Keccak256Hash(h.buf)
+	}
+}
+
+// sha3Hasher absorbs the bytes before the nonce once per job and clones
+// that state for every nonce.
+type sha3Hasher struct{}
+
+func (sha3Hasher) Name() string { return "sha3" }
+
+func (sha3Hasher) Prepare(template []byte, offset int) (NonceHasher, error) {
+	if err := checkTemplate(template, offset); err != nil {
+		return nil, err
+	}
+	base, ok := sha3.NewLegacyKeccak256().(interface{ Clone() sha3.ShakeHash })
+	if !ok {
+		return nil, fmt.Errorf("keccak state cannot be cloned")
+	}
+	prefix := base.Clone()
+	prefix.Write(template[:offset])
+	return &sha3NonceHasher{prefix: prefix, suffix: bytes.Clone(template[offset+32:])}, nil
+}
+
+type sha3NonceHasher struct {
+	prefix sha3.ShakeHash
+	suffix []byte
+}
+
+func (h *sha3NonceHasher) Hash(nonces [][32]byte, out []common.Hash) {
+	for i := range nonces {
+		d := h.prefix.Clone()
+		d.Write(nonces[i][:])
+		d.Write(h.suffix)
+		d.Read(out[i][:])
+	}
+}
+
+// unrolledHasher runs keccakF1600Digest directly on the lanes of a
+// preimage that fits one block, reloading only the lanes the nonce covers.
+type unrolledHasher struct{}
+
+func (unrolledHasher) Name() string { return "unrolled" }
+
+func (unrolledHasher) Prepare(template []byte, offset int) (NonceHasher, error) {
+	if err := checkTemplate(template, offset); err != nil {
+		return nil, err
+	}
+	if len(template) >= keccakRate {
+		return nil, fmt.Errorf("a %d-byte preimage does not fit one block", len(template))
+	}
+	h := &unrolledNonceHasher{offset: offset, first: offset / 8, last: (offset + 31) / 8}
+	copy(h.block[:], template)
+	// Keccak padding: a 0x01 after the message and 0x80 in the last byte
+	// of the block.
+	h.block[len(template)] ^= 0x01
+	h.block[keccakRate-1] ^= 0x80
+	for i := 0; i < keccakRate/8; i++ {
+		h.lanes[i] = binary.LittleEndian.Uint64(h.block[8*i:])
+	}
+	return h, nil
+}
+
+type unrolledNonceHasher struct {
+	block       [keccakRate]byte
+	lanes       [25]uint64 // the padded block; lanes past the rate stay zero
+	offset      int
+	first, last int // lanes covered by the nonce
+}
+
+func (h *unrolledNonceHasher) Hash(nonces [][32]byte, out []common.Hash) {
+	for i := range nonces {
+		copy(h.block[h.offset:], nonces[i][:])
+		for j := h.first; j <= h.last; j++ {
+			h.lanes[j] = binary.LittleEndian.Uint64(h.block[8*j:])
+		}
+		a := h.lanes
+		keccakF1600Digest(&a)
+		for j := 0; j < 4; j++ {
+			binary.LittleEndian.PutUint64(out[i][8*j:], a[j])
+		}
+	}
+}
+
+// NonceTemplate returns the preimage of job for sender with a zero nonce
+// and the offset of the nonce in it, for schemes that encode the nonce as
+// a 32-byte big-endian word. Other schemes return an error and are hashed
+// with SolutionDigest.
+func NonceTemplate(scheme Scheme, job *Job, sender common.Address) ([]byte, int, error) {
+	zero := scheme.Preimage(job, sender, new(big.Int))
+	ones := scheme.Preimage(job, sender, new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1)))
+	if len(zero) != len(ones) {
+		return nil, 0, fmt.Errorf("scheme %s: preimage length depends on the nonce", scheme.Name())
+	}
+	offset, end := -1, -1
+	for i := range zero {
+		if zero[i] != ones[i] {
+			if offset < 0 {
+				offset = i
+			}
+			end = i + 1
+		}
+	}
+	if offset < 0 || end-offset != 32 {
+		return nil, 0, fmt.Errorf("scheme %s: nonce is not a 32-byte word", scheme.Name())
+	}
+	// Make sure the word is the plain big-endian nonce and nothing else.
+	probe := new(big.Int).SetBytes(bytes.Repeat([]byte{0x5a, 0x01}, 16))
+	want := scheme.Preimage(job, sender, probe)
+	got := bytes.Clone(zero)
+	probe.FillBytes(got[offset:end])
+	if !bytes.Equal(got, want) {
+		return nil, 0, fmt.Errorf("scheme %s: nonce is not encoded as a big-endian word", scheme.Name())
+	}
+	return zero, offset, nil
+}
+
+// digestNonceHasher hashes through SolutionDigest, for schemes without a
+// NonceTemplate.
+type digestNonceHasher struct {
+	scheme Scheme
+	job    *Job
+	sender common.Address
+}
+
+func (h *digestNonceHasher) Hash(nonces [][32]byte, out []common.Hash) {
+	for i := range nonces {
+		out[i] = SolutionDigest(h.scheme, h.job, h.sender, new(big.Int).SetBytes(nonces[i][:]))
+	}
+}
+
+// prepareHasher returns a NonceHasher for job with h, falling back to the
+// reference backend when h cannot handle the preimage and to
+// SolutionDigest when the scheme has no nonce template.
+func prepareHasher(h Hasher, scheme Scheme, job *Job, sender common.Address) NonceHasher {
+	template, offset, err := NonceTemplate(scheme, job, sender)
+	if err != nil {
+		return &digestNonceHasher{scheme: scheme, job: job, sender: sender}
+	}
+	if nh, err := h.Prepare(template, offset); err == nil {
+		return nh
+	}
+	nh, _ := referenceHasher{}.Prepare(template, offset)
+	return nh
+}
+
+// HasherRate is the measured speed of a backend on one core.
+type HasherRate struct {
+	Hasher Hasher
+	Rate   float64 // hashes per second
+}
+
+// BenchmarkHasher hashes PoWERC20-shaped preimages with h on the calling
+// goroutine for d and returns the hashes per second.
+func BenchmarkHasher(h Hasher, d time.Duration) (float64, error) {
+	// challenge, sender, nonce as abi.encodePacked lays them out.
+	template := make([]byte, 32+20+32)
+	for i := range template {
+		template[i] = byte(i * 7)
+	}
+	nh, err := h.Prepare(template, 52)
+	if err != nil {
+		return 0, err
+	}
+	var nonces [hashLanes][32]byte
+	var out [hashLanes]common.Hash
+	var nonce [32]byte
+	hashes := 0
+	start := time.Now()
+	for time.Since(start) < d {
+		for i := 0; i < 64; i++ {
+			for j := range nonces {
+				nonces[j] = nonce
+				incrementNonce(&nonce)
+			}
+			nh.Hash(nonces[:], out[:])
+			hashes += hashLanes
+		}
+	}
+	return float64(hashes) / time.Since(start).Seconds(), nil
+}
+
+// BenchmarkHashers benchmarks every built-in backend for d each and
+// returns them fastest first.
+func BenchmarkHashers(d time.Duration) []HasherRate {
+	var rates []HasherRate
+	for _, h := range hashers {
+		rate, err := BenchmarkHasher(h, d)
+		if err != nil {
+			continue
+		}
+		rates = append(rates, HasherRate{Hasher: h, Rate: rate})
+	}
+	sort.SliceStable(rates, func(i, j int) bool { return rates[i].Rate > rates[j].Rate })
+	return rates
+}
+
+// incrementNonce adds one to the big-endian nonce, wrapping at 2^256.
+func incrementNonce(nonce *[32]byte) {
+	for i := len(nonce) - 1; i >= 0; i-- {
+		nonce[i]++
+		if nonce[i] != 0 {
+			return
+		}
+	}
+}
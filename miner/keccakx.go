@@ -0,0 +1,105 @@
+package miner
+
+import (
+	"encoding/binary"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// simdKernel is a multi-buffer Keccak-f[1600]: it permutes lanes
+// independent states at once. The states are stored lane-major, lane i of
+// buffer b at state[i*lanes+b], so that a vector register holds one lane of
+// every buffer.
+type simdKernel struct {
+	name    string
+	lanes   int
+	permute func(state []uint64)
+}
+
+// genericKernel is the pure-Go fallback for CPUs without a vector kernel.
+// It permutes the buffers one after the other and only computes the digest
+// lanes.
+var genericKernel = simdKernel{name: "generic", lanes: 4, permute: func(state []uint64) {
+	var a [25]uint64
+	for b := 0; b < 4; b++ {
+		for i := range a {
+			a[i] = state[i*4+b]
+		}
+		keccakF1600Digest(&a)
+		for i := 0; i < 4; i++ {
+			state[i*4+b] = a[i]
+		}
+	}
+}}
+
+// simdHashers returns a backend for every kernel this CPU supports, the
+// widest first, followed by the generic one.
+func simdHashers() []Hasher {
+	var hs []Hasher
+	for _, k := range simdKernels() {
+		hs = append(hs, simdHasher{k})
+	}
+	return append(hs, simdHasher{genericKernel})
+}
+
+// simdHasher hashes as many nonces per permutation as its kernel has
+// lanes. Like unrolledHasher it needs the preimage to fit one block.
+type simdHasher struct{ kernel simdKernel }
+
+func (h simdHasher) Name() string { return "simd-" + h.kernel.name }
+
+func (h simdHasher) Prepare(template []byte, offset int) (NonceHasher, error) {
+	single, err := unrolledHasher{}.Prepare(template, offset)
+	if err != nil {
+		return nil, err
+	}
+	u := single.(*unrolledNonceHasher)
+	w := h.kernel.lanes
+	nh := &simdNonceHasher{
+		unrolledNonceHasher: *u,
+		kernel:              h.kernel,
+		base:                make([]uint64, 25*w),
+		state:               make([]uint64, 25*w),
+	}
+	for i, lane := range u.lanes {
+		for b := 0; b < w; b++ {
+			nh.base[i*w+b] = lane
+		}
+	}
+	return nh, nil
+}
+
+type simdNonceHasher struct {
+	unrolledNonceHasher // the padded block and the lanes the nonce covers
+	kernel              simdKernel
+	base, state         []uint64
+}
+
+func (h *simdNonceHasher) Hash(nonces [][32]byte, out []common.Hash) {
+	w := h.kernel.lanes
+	for len(nonces) > 0 {
+		n := len(nonces)
+		if n > w {
+			n = w
+		}
+		copy(h.state, h.base)
+		for b := 0; b < n; b++ {
+			copy(h.block[h.offset:], nonces[b][:])
+			for j := h.first; j <= h.last; j++ {
+				h.state[j*w+b] = binary.LittleEndian.Uint64(h.block[8*j:])
+			}
+		}
+		h.kernel.permute(h.state)
+		for b := 0; b < n; b++ {
+			for j := 0; j < 4; j++ {
+				binary.LittleEndian.PutUint64(out[b][8*j:], h.state[j*w+b])
+			}
+		}
+		nonces, out = nonces[n:], out[n:]
+	}
+}
+
+// bestSIMDHasher returns the widest multi-buffer backend on this CPU.
+func bestSIMDHasher() Hasher {
+	return simdHashers()[0]
+}
@@ -0,0 +1,22 @@
+//go:build amd64 && !purego
+
+package miner
+
+import "golang.org/x/sys/cpu"
+
+//go:noescape
+func keccakF1600x4(state *uint64)
+
+//go:noescape
+func keccakF1600x8(state *uint64)
+
+func simdKernels() []simdKernel {
+	var ks []simdKernel
+	if cpu.X86.HasAVX512F {
+		ks = append(ks, simdKernel{name: "avx512", lanes: 8, permute: func(state []uint64) { keccakF1600x8(&state[0]) }})
+	}
+	if cpu.X86.HasAVX2 {
+		ks = append(ks, simdKernel{name: "avx2", lanes: 4, permute: func(state []uint64) { keccakF1600x4(&state[0]) }})
+	}
+	return ks
+}
@@ -0,0 +1,472 @@
+//go:build amd64 && !purego
+
+#include "textflag.h"
+
+DATA roundConstants<>+0x00(SB)/8, $0x0000000000000001
+DATA roundConstants<>+0x08(SB)/8, $0x0000000000008082
+DATA roundConstants<>+0x10(SB)/8, $0x800000000000808a
+DATA roundConstants<>+0x18(SB)/8, $0x8000000080008000
+DATA roundConstants<>+0x20(SB)/8, $0x000000000000808b
+DATA roundConstants<>+0x28(SB)/8, $0x0000000080000001
+DATA roundConstants<>+0x30(SB)/8, $0x8000000080008081
+DATA roundConstants<>+0x38(SB)/8, $0x8000000000008009
+DATA roundConstants<>+0x40(SB)/8, $0x000000000000008a
+DATA roundConstants<>+0x48(SB)/8, $0x0000000000000088
+DATA roundConstants<>+0x50(SB)/8, $0x0000000080008009
+DATA roundConstants<>+0x58(SB)/8, $0x000000008000000a
+DATA roundConstants<>+0x60(SB)/8, $0x000000008000808b
+DATA roundConstants<>+0x68(SB)/8, $0x800000000000008b
+DATA roundConstants<>+0x70(SB)/8, $0x8000000000008089
+DATA roundConstants<>+0x78(SB)/8, $0x8000000000008003
+DATA roundConstants<>+0x80(SB)/8, $0x8000000000008002
+DATA roundConstants<>+0x88(SB)/8, $0x8000000000000080
+DATA roundConstants<>+0x90(SB)/8, $0x000000000000800a
+DATA roundConstants<>+0x98(SB)/8, $0x800000008000000a
+DATA roundConstants<>+0xa0(SB)/8, $0x8000000080008081
+DATA roundConstants<>+0xa8(SB)/8, $0x8000000000008080
+DATA roundConstants<>+0xb0(SB)/8, $0x0000000080000001
+DATA roundConstants<>+0xb8(SB)/8, $0x8000000080008008
+GLOBL roundConstants<>(SB), RODATA|NOPTR, $192
+
+// The state is 25 lanes of 4 (AVX2) or 8 (AVX-512) interleaved buffers,
+// lane-major, so that one vector load reads a lane of every buffer.
+
+// AVX2_ROUND computes a round from the state at src into dst. With only
+// 16 registers the state stays in memory; Y0-Y4 hold the column parities
+// and then a row of B, Y5-Y9 the theta effect D and Y10-Y11 temporaries.
+#define AVX2_ROUND(src, dst) \
+	VMOVDQU 0(src), Y0; \
+	VPXOR 160(src), Y0, Y0; \
+	VPXOR 320(src), Y0, Y0; \
+	VPXOR 480(src), Y0, Y0; \
+	VPXOR 640(src), Y0, Y0; \
+	VMOVDQU 32(src), Y1; \
+	VPXOR 192(src), Y1, Y1; \
+	VPXOR 352(src), Y1, Y1; \
+	VPXOR 512(src), Y1, Y1; \
+	VPXOR 672(src), Y1, Y1; \
+	VMOVDQU 64(src), Y2; \
+	VPXOR 224(src), Y2, Y2; \
+	VPXOR 384(src), Y2, Y2; \
+	VPXOR 544(src), Y2, Y2; \
+	VPXOR 704(src), Y2, Y2; \
+	VMOVDQU 96(src), Y3; \
+	VPXOR 256(src), Y3, Y3; \
+	VPXOR 416(src), Y3, Y3; \
+	VPXOR 576(src), Y3, Y3; \
+	VPXOR 736(src), Y3, Y3; \
+	VMOVDQU 128(src), Y4; \
+	VPXOR 288(src), Y4, Y4; \
+	VPXOR 448(src), Y4, Y4; \
+	VPXOR 608(src), Y4, Y4; \
+	VPXOR 768(src), Y4, Y4; \
+	VPSLLQ $1, Y1, Y10; \
+	VPSRLQ $63, Y1, Y5; \
+	VPOR Y10, Y5, Y5; \
+	VPXOR Y4, Y5, Y5; \
+	VPSLLQ $1, Y2, Y10; \
+	VPSRLQ $63, Y2, Y6; \
+	VPOR Y10, Y6, Y6; \
+	VPXOR Y0, Y6, Y6; \
+	VPSLLQ $1, Y3, Y10; \
+	VPSRLQ $63, Y3, Y7; \
+	VPOR Y10, Y7, Y7; \
+	VPXOR Y1, Y7, Y7; \
+	VPSLLQ $1, Y4, Y10; \
+	VPSRLQ $63, Y4, Y8; \
+	VPOR Y10, Y8, Y8; \
+	VPXOR Y2, Y8, Y8; \
+	VPSLLQ $1, Y0, Y10; \
+	VPSRLQ $63, Y0, Y9; \
+	VPOR Y10, Y9, Y9; \
+	VPXOR Y3, Y9, Y9; \
+	VPXOR 0(src), Y5, Y0; \
+	VPXOR 192(src), Y6, Y1; \
+	VPSLLQ $44, Y1, Y10; \
+	VPSRLQ $20, Y1, Y1; \
+	VPOR Y10, Y1, Y1; \
+	VPXOR 384(src), Y7, Y2; \
+	VPSLLQ $43, Y2, Y10; \
+	VPSRLQ $21, Y2, Y2; \
+	VPOR Y10, Y2, Y2; \
+	VPXOR 576(src), Y8, Y3; \
+	VPSLLQ $21, Y3, Y10; \
+	VPSRLQ $43, Y3, Y3; \
+	VPOR Y10, Y3, Y3; \
+	VPXOR 768(src), Y9, Y4; \
+	VPSLLQ $14, Y4, Y10; \
+	VPSRLQ $50, Y4, Y4; \
+	VPOR Y10, Y4, Y4; \
+	VPANDN Y2, Y1, Y10; \
+	VPXOR Y0, Y10, Y10; \
+	VPBROADCASTQ (AX), Y11; \
+	VPXOR Y11, Y10, Y10; \
+	VMOVDQU Y10, 0(dst); \
+	VPANDN Y3, Y2, Y10; \
+	VPXOR Y1, Y10, Y10; \
+	VMOVDQU Y10, 32(dst); \
+	VPANDN Y4, Y3, Y10; \
+	VPXOR Y2, Y10, Y10; \
+	VMOVDQU Y10, 64(dst); \
+	VPANDN Y0, Y4, Y10; \
+	VPXOR Y3, Y10, Y10; \
+	VMOVDQU Y10, 96(dst); \
+	VPANDN Y1, Y0, Y10; \
+	VPXOR Y4, Y10, Y10; \
+	VMOVDQU Y10, 128(dst); \
+	VPXOR 96(src), Y8, Y0; \
+	VPSLLQ $28, Y0, Y10; \
+	VPSRLQ $36, Y0, Y0; \
+	VPOR Y10, Y0, Y0; \
+	VPXOR 288(src), Y9, Y1; \
+	VPSLLQ $20, Y1, Y10; \
+	VPSRLQ $44, Y1, Y1; \
+	VPOR Y10, Y1, Y1; \
+	VPXOR 320(src), Y5, Y2; \
+	VPSLLQ $3, Y2, Y10; \
+	VPSRLQ $61, Y2, Y2; \
+	VPOR Y10, Y2, Y2; \
+	VPXOR 512(src), Y6, Y3; \
+	VPSLLQ $45, Y3, Y10; \
+	VPSRLQ $19, Y3, Y3; \
+	VPOR Y10, Y3, Y3; \
+	VPXOR 704(src), Y7, Y4; \
+	VPSLLQ $61, Y4, Y10; \
+	VPSRLQ $3, Y4, Y4; \
+	VPOR Y10, Y4, Y4; \
+	VPANDN Y2, Y1, Y10; \
+	VPXOR Y0, Y10, Y10; \
+	VMOVDQU Y10, 160(dst); \
+	VPANDN Y3, Y2, Y10; \
+	VPXOR Y1, Y10, Y10; \
+	VMOVDQU Y10, 192(dst); \
+	VPANDN Y4, Y3, Y10; \
+	VPXOR Y2, Y10, Y10; \
+	VMOVDQU Y10, 224(dst); \
+	VPANDN Y0, Y4, Y10; \
+	VPXOR Y3, Y10, Y10; \
+	VMOVDQU Y10, 256(dst); \
+	VPANDN Y1, Y0, Y10; \
+	VPXOR Y4, Y10, Y10; \
+	VMOVDQU Y10, 288(dst); \
+	VPXOR 32(src), Y6, Y0; \
+	VPSLLQ $1, Y0, Y10; \
+	VPSRLQ $63, Y0, Y0; \
+	VPOR Y10, Y0, Y0; \
+	VPXOR 224(src), Y7, Y1; \
+	VPSLLQ $6, Y1, Y10; \
+	VPSRLQ $58, Y1, Y1; \
+	VPOR Y10, Y1, Y1; \
+	VPXOR 416(src), Y8, Y2; \
+	VPSLLQ $25, Y2, Y10; \
+	VPSRLQ $39, Y2, Y2; \
+	VPOR Y10, Y2, Y2; \
+	VPXOR 608(src), Y9, Y3; \
+	VPSLLQ $8, Y3, Y10; \
+	VPSRLQ $56, Y3, Y3; \
+	VPOR Y10, Y3, Y3; \
+	VPXOR 640(src), Y5, Y4; \
+	VPSLLQ $18, Y4, Y10; \
+	VPSRLQ $46, Y4, Y4; \
+	VPOR Y10, Y4, Y4; \
+	VPANDN Y2, Y1, Y10; \
+	VPXOR Y0, Y10, Y10; \
+	VMOVDQU Y10, 320(dst); \
+	VPANDN Y3, Y2, Y10; \
+	VPXOR Y1, Y10, Y10; \
+	VMOVDQU Y10, 352(dst); \
+	VPANDN Y4, Y3, Y10; \
+	VPXOR Y2, Y10, Y10; \
+	VMOVDQU Y10, 384(dst); \
+	VPANDN Y0, Y4, Y10; \
+	VPXOR Y3, Y10, Y10; \
+	VMOVDQU Y10, 416(dst); \
+	VPANDN Y1, Y0, Y10; \
+	VPXOR Y4, Y10, Y10; \
+	VMOVDQU Y10, 448(dst); \
+	VPXOR 128(src), Y9, Y0; \
+	VPSLLQ $27, Y0, Y10; \
+	VPSRLQ $37, Y0, Y0; \
+	VPOR Y10, Y0, Y0; \
+	VPXOR 160(src), Y5, Y1; \
+	VPSLLQ $36, Y1, Y10; \
+	VPSRLQ $28, Y1, Y1; \
+	VPOR Y10, Y1, Y1; \
+	VPXOR 352(src), Y6, Y2; \
+	VPSLLQ $10, Y2, Y10; \
+	VPSRLQ $54, Y2, Y2; \
+	VPOR Y10, Y2, Y2; \
+	VPXOR 544(src), Y7, Y3; \
+	VPSLLQ $15, Y3, Y10; \
+	VPSRLQ $49, Y3, Y3; \
+	VPOR Y10, Y3, Y3; \
+	VPXOR 736(src), Y8, Y4; \
+	VPSLLQ $56, Y4, Y10; \
+	VPSRLQ $8, Y4, Y4; \
+	VPOR Y10, Y4, Y4; \
+	VPANDN Y2, Y1, Y10; \
+	VPXOR Y0, Y10, Y10; \
+	VMOVDQU Y10, 480(dst); \
+	VPANDN Y3, Y2, Y10; \
+	VPXOR Y1, Y10, Y10; \
+	VMOVDQU Y10, 512(dst); \
+	VPANDN Y4, Y3, Y10; \
+	VPXOR Y2, Y10, Y10; \
+	VMOVDQU Y10, 544(dst); \
+	VPANDN Y0, Y4, Y10; \
+	VPXOR Y3, Y10, Y10; \
+	VMOVDQU Y10, 576(dst); \
+	VPANDN Y1, Y0, Y10; \
+	VPXOR Y4, Y10, Y10; \
+	VMOVDQU Y10, 608(dst); \
+	VPXOR 64(src), Y7, Y0; \
+	VPSLLQ $62, Y0, Y10; \
+	VPSRLQ $2, Y0, Y0; \
+	VPOR Y10, Y0, Y0; \
+	VPXOR 256(src), Y8, Y1; \
+	VPSLLQ $55, Y1, Y10; \
+	VPSRLQ $9, Y1, Y1; \
+	VPOR Y10, Y1, Y1; \
+	VPXOR 448(src), Y9, Y2; \
+	VPSLLQ $39, Y2, Y10; \
+	VPSRLQ $25, Y2, Y2; \
+	VPOR Y10, Y2, Y2; \
+	VPXOR 480(src), Y5, Y3; \
+	VPSLLQ $41, Y3, Y10; \
+	VPSRLQ $23, Y3, Y3; \
+	VPOR Y10, Y3, Y3; \
+	VPXOR 672(src), Y6, Y4; \
+	VPSLLQ $2, Y4, Y10; \
+	VPSRLQ $62, Y4, Y4; \
+	VPOR Y10, Y4, Y4; \
+	VPANDN Y2, Y1, Y10; \
+	VPXOR Y0, Y10, Y10; \
+	VMOVDQU Y10, 640(dst); \
+	VPANDN Y3, Y2, Y10; \
+	VPXOR Y1, Y10, Y10; \
+	VMOVDQU Y10, 672(dst); \
+	VPANDN Y4, Y3, Y10; \
+	VPXOR Y2, Y10, Y10; \
+	VMOVDQU Y10, 704(dst); \
+	VPANDN Y0, Y4, Y10; \
+	VPXOR Y3, Y10, Y10; \
+	VMOVDQU Y10, 736(dst); \
+	VPANDN Y1, Y0, Y10; \
+	VPXOR Y4, Y10, Y10; \
+	VMOVDQU Y10, 768(dst); \
+	ADDQ $8, AX
+
+// func keccakF1600x4(state *uint64)
+TEXT ·keccakF1600x4(SB), 0, $800-8
+	MOVQ state+0(FP), SI
+	MOVQ SP, DI
+	LEAQ roundConstants<>(SB), AX
+	MOVQ $12, CX
+
+avx2Loop:
+	AVX2_ROUND(SI, DI)
+	AVX2_ROUND(DI, SI)
+	DECQ CX
+	JNZ avx2Loop
+	VZEROUPPER
+	RET
+
+// AVX512_ROUND computes a round on the state held in the 25 registers
+// passed as lanes a00 to a44. Rho-pi moves no data: the caller passes the
+// registers of the next round permuted instead, which brings them back
+// in order after 24 rounds. Z25-Z29 hold the column parities and then
+// a row of B, Z30 the theta effect D and Z31 the round constant.
+#define AVX512_ROUND(a00, a10, a20, a30, a40, a01, a11, a21, a31, a41, a02, a12, a22, a32, a42, a03, a13, a23, a33, a43, a04, a14, a24, a34, a44) \
+	VMOVDQA64 a00, Z25; \
+	VPTERNLOGQ $0x96, a02, a01, Z25; \
+	VPTERNLOGQ $0x96, a04, a03, Z25; \
+	VMOVDQA64 a10, Z26; \
+	VPTERNLOGQ $0x96, a12, a11, Z26; \
+	VPTERNLOGQ $0x96, a14, a13, Z26; \
+	VMOVDQA64 a20, Z27; \
+	VPTERNLOGQ $0x96, a22, a21, Z27; \
+	VPTERNLOGQ $0x96, a24, a23, Z27; \
+	VMOVDQA64 a30, Z28; \
+	VPTERNLOGQ $0x96, a32, a31, Z28; \
+	VPTERNLOGQ $0x96, a34, a33, Z28; \
+	VMOVDQA64 a40, Z29; \
+	VPTERNLOGQ $0x96, a42, a41, Z29; \
+	VPTERNLOGQ $0x96, a44, a43, Z29; \
+	VPROLQ $1, Z26, Z30; \
+	VPXORQ Z29, Z30, Z30; \
+	VPXORQ Z30, a00, a00; \
+	VPXORQ Z30, a01, a01; \
+	VPXORQ Z30, a02, a02; \
+	VPXORQ Z30, a03, a03; \
+	VPXORQ Z30, a04, a04; \
+	VPROLQ $1, Z27, Z30; \
+	VPXORQ Z25, Z30, Z30; \
+	VPXORQ Z30, a10, a10; \
+	VPXORQ Z30, a11, a11; \
+	VPXORQ Z30, a12, a12; \
+	VPXORQ Z30, a13, a13; \
+	VPXORQ Z30, a14, a14; \
+	VPROLQ $1, Z28, Z30; \
+	VPXORQ Z26, Z30, Z30; \
+	VPXORQ Z30, a20, a20; \
+	VPXORQ Z30, a21, a21; \
+	VPXORQ Z30, a22, a22; \
+	VPXORQ Z30, a23, a23; \
+	VPXORQ Z30, a24, a24; \
+	VPROLQ $1, Z29, Z30; \
+	VPXORQ Z27, Z30, Z30; \
+	VPXORQ Z30, a30, a30; \
+	VPXORQ Z30, a31, a31; \
+	VPXORQ Z30, a32, a32; \
+	VPXORQ Z30, a33, a33; \
+	VPXORQ Z30, a34, a34; \
+	VPROLQ $1, Z25, Z30; \
+	VPXORQ Z28, Z30, Z30; \
+	VPXORQ Z30, a40, a40; \
+	VPXORQ Z30, a41, a41; \
+	VPXORQ Z30, a42, a42; \
+	VPXORQ Z30, a43, a43; \
+	VPXORQ Z30, a44, a44; \
+	VPROLQ $1, a10, a10; \
+	VPROLQ $62, a20, a20; \
+	VPROLQ $28, a30, a30; \
+	VPROLQ $27, a40, a40; \
+	VPROLQ $36, a01, a01; \
+	VPROLQ $44, a11, a11; \
+	VPROLQ $6, a21, a21; \
+	VPROLQ $55, a31, a31; \
+	VPROLQ $20, a41, a41; \
+	VPROLQ $3, a02, a02; \
+	VPROLQ $10, a12, a12; \
+	VPROLQ $43, a22, a22; \
+	VPROLQ $25, a32, a32; \
+	VPROLQ $39, a42, a42; \
+	VPROLQ $41, a03, a03; \
+	VPROLQ $45, a13, a13; \
+	VPROLQ $15, a23, a23; \
+	VPROLQ $21, a33, a33; \
+	VPROLQ $8, a43, a43; \
+	VPROLQ $18, a04, a04; \
+	VPROLQ $2, a14, a14; \
+	VPROLQ $61, a24, a24; \
+	VPROLQ $56, a34, a34; \
+	VPROLQ $14, a44, a44; \
+	VMOVDQA64 a00, Z25; \
+	VMOVDQA64 a11, Z26; \
+	VPTERNLOGQ $0xD2, a22, a11, a00; \
+	VPTERNLOGQ $0xD2, a33, a22, a11; \
+	VPTERNLOGQ $0xD2, a44, a33, a22; \
+	VPTERNLOGQ $0xD2, Z25, a44, a33; \
+	VPTERNLOGQ $0xD2, Z26, Z25, a44; \
+	VMOVDQA64 a30, Z25; \
+	VMOVDQA64 a41, Z26; \
+	VPTERNLOGQ $0xD2, a02, a41, a30; \
+	VPTERNLOGQ $0xD2, a13, a02, a41; \
+	VPTERNLOGQ $0xD2, a24, a13, a02; \
+	VPTERNLOGQ $0xD2, Z25, a24, a13; \
+	VPTERNLOGQ $0xD2, Z26, Z25, a24; \
+	VMOVDQA64 a10, Z25; \
+	VMOVDQA64 a21, Z26; \
+	VPTERNLOGQ $0xD2, a32, a21, a10; \
+	VPTERNLOGQ $0xD2, a43, a32, a21; \
+	VPTERNLOGQ $0xD2, a04, a43, a32; \
+	VPTERNLOGQ $0xD2, Z25, a04, a43; \
+	VPTERNLOGQ $0xD2, Z26, Z25, a04; \
+	VMOVDQA64 a40, Z25; \
+	VMOVDQA64 a01, Z26; \
+	VPTERNLOGQ $0xD2, a12, a01, a40; \
+	VPTERNLOGQ $0xD2, a23, a12, a01; \
+	VPTERNLOGQ $0xD2, a34, a23, a12; \
+	VPTERNLOGQ $0xD2, Z25, a34, a23; \
+	VPTERNLOGQ $0xD2, Z26, Z25, a34; \
+	VMOVDQA64 a20, Z25; \
+	VMOVDQA64 a31, Z26; \
+	VPTERNLOGQ $0xD2, a42, a31, a20; \
+	VPTERNLOGQ $0xD2, a03, a42, a31; \
+	VPTERNLOGQ $0xD2, a14, a03, a42; \
+	VPTERNLOGQ $0xD2, Z25, a14, a03; \
+	VPTERNLOGQ $0xD2, Z26, Z25, a14; \
+	VPBROADCASTQ (AX), Z31; \
+	VPXORQ Z31, a00, a00; \
+	ADDQ $8, AX
+
+// func keccakF1600x8(state *uint64)
+TEXT ·keccakF1600x8(SB), NOSPLIT, $0-8
+	MOVQ state+0(FP), DI
+	LEAQ roundConstants<>(SB), AX
+	VMOVDQU64 0(DI), Z0
+	VMOVDQU64 64(DI), Z1
+	VMOVDQU64 128(DI), Z2
+	VMOVDQU64 192(DI), Z3
+	VMOVDQU64 256(DI), Z4
+	VMOVDQU64 320(DI), Z5
+	VMOVDQU64 384(DI), Z6
+	VMOVDQU64 448(DI), Z7
+	VMOVDQU64 512(DI), Z8
+	VMOVDQU64 576(DI), Z9
+	VMOVDQU64 640(DI), Z10
+	VMOVDQU64 704(DI), Z11
+	VMOVDQU64 768(DI), Z12
+	VMOVDQU64 832(DI), Z13
+	VMOVDQU64 896(DI), Z14
+	VMOVDQU64 960(DI), Z15
+	VMOVDQU64 1024(DI), Z16
+	VMOVDQU64 1088(DI), Z17
+	VMOVDQU64 1152(DI), Z18
+	VMOVDQU64 1216(DI), Z19
+	VMOVDQU64 1280(DI), Z20
+	VMOVDQU64 1344(DI), Z21
+	VMOVDQU64 1408(DI), Z22
+	VMOVDQU64 1472(DI), Z23
+	VMOVDQU64 1536(DI), Z24
+	AVX512_ROUND(Z0, Z1, Z2, Z3, Z4, Z5, Z6, Z7, Z8, Z9, Z10, Z11, Z12, Z13, Z14, Z15, Z16, Z17, Z18, Z19, Z20, Z21, Z22, Z23, Z24)
+	AVX512_ROUND(Z0, Z6, Z12, Z18, Z24, Z3, Z9, Z10, Z16, Z22, Z1, Z7, Z13, Z19, Z20, Z4, Z5, Z11, Z17, Z23, Z2, Z8, Z14, Z15, Z21)
+	AVX512_ROUND(Z0, Z9, Z13, Z17, Z21, Z18, Z22, Z1, Z5, Z14, Z6, Z10, Z19, Z23, Z2, Z24, Z3, Z7, Z11, Z15, Z12, Z16, Z20, Z4, Z8)
+	AVX512_ROUND(Z0, Z22, Z19, Z11, Z8, Z17, Z14, Z6, Z3, Z20, Z9, Z1, Z23, Z15, Z12, Z21, Z18, Z10, Z7, Z4, Z13, Z5, Z2, Z24, Z16)
+	AVX512_ROUND(Z0, Z14, Z23, Z7, Z16, Z11, Z20, Z9, Z18, Z2, Z22, Z6, Z15, Z4, Z13, Z8, Z17, Z1, Z10, Z24, Z19, Z3, Z12, Z21, Z5)
+	AVX512_ROUND(Z0, Z20, Z15, Z10, Z5, Z7, Z2, Z22, Z17, Z12, Z14, Z9, Z4, Z24, Z19, Z16, Z11, Z6, Z1, Z21, Z23, Z18, Z13, Z8, Z3)
+	AVX512_ROUND(Z0, Z2, Z4, Z1, Z3, Z10, Z12, Z14, Z11, Z13, Z20, Z22, Z24, Z21, Z23, Z5, Z7, Z9, Z6, Z8, Z15, Z17, Z19, Z16, Z18)
+	AVX512_ROUND(Z0, Z12, Z24, Z6, Z18, Z1, Z13, Z20, Z7, Z19, Z2, Z14, Z21, Z8, Z15, Z3, Z10, Z22, Z9, Z16, Z4, Z11, Z23, Z5, Z17)
+	AVX512_ROUND(Z0, Z13, Z21, Z9, Z17, Z6, Z19, Z2, Z10, Z23, Z12, Z20, Z8, Z16, Z4, Z18, Z1, Z14, Z22, Z5, Z24, Z7, Z15, Z3, Z11)
+	AVX512_ROUND(Z0, Z19, Z8, Z22, Z11, Z9, Z23, Z12, Z1, Z15, Z13, Z2, Z16, Z5, Z24, Z17, Z6, Z20, Z14, Z3, Z21, Z10, Z4, Z18, Z7)
+	AVX512_ROUND(Z0, Z23, Z16, Z14, Z7, Z22, Z15, Z13, Z6, Z4, Z19, Z12, Z5, Z3, Z21, Z11, Z9, Z2, Z20, Z18, Z8, Z1, Z24, Z17, Z10)
+	AVX512_ROUND(Z0, Z15, Z5, Z20, Z10, Z14, Z4, Z19, Z9, Z24, Z23, Z13, Z3, Z18, Z8, Z7, Z22, Z12, Z2, Z17, Z16, Z6, Z21, Z11, Z1)
+	AVX512_ROUND(Z0, Z4, Z3, Z2, Z1, Z20, Z24, Z23, Z22, Z21, Z15, Z19, Z18, Z17, Z16, Z10, Z14, Z13, Z12, Z11, Z5, Z9, Z8, Z7, Z6)
+	AVX512_ROUND(Z0, Z24, Z18, Z12, Z6, Z2, Z21, Z15, Z14, Z8, Z4, Z23, Z17, Z11, Z5, Z1, Z20, Z19, Z13, Z7, Z3, Z22, Z16, Z10, Z9)
+	AVX512_ROUND(Z0, Z21, Z17, Z13, Z9, Z12, Z8, Z4, Z20, Z16, Z24, Z15, Z11, Z7, Z3, Z6, Z2, Z23, Z19, Z10, Z18, Z14, Z5, Z1, Z22)
+	AVX512_ROUND(Z0, Z8, Z11, Z19, Z22, Z13, Z16, Z24, Z2, Z5, Z21, Z4, Z7, Z10, Z18, Z9, Z12, Z15, Z23, Z1, Z17, Z20, Z3, Z6, Z14)
+	AVX512_ROUND(Z0, Z16, Z7, Z23, Z14, Z19, Z5, Z21, Z12, Z3, Z8, Z24, Z10, Z1, Z17, Z22, Z13, Z4, Z15, Z6, Z11, Z2, Z18, Z9, Z20)
+	AVX512_ROUND(Z0, Z5, Z10, Z15, Z20, Z23, Z3, Z8, Z13, Z18, Z16, Z21, Z1, Z6, Z11, Z14, Z19, Z24, Z4, Z9, Z7, Z12, Z17, Z22, Z2)
+	AVX512_ROUND(Z0, Z3, Z1, Z4, Z2, Z15, Z18, Z16, Z19, Z17, Z5, Z8, Z6, Z9, Z7, Z20, Z23, Z21, Z24, Z22, Z10, Z13, Z11, Z14, Z12)
+	AVX512_ROUND(Z0, Z18, Z6, Z24, Z12, Z4, Z17, Z5, Z23, Z11, Z3, Z16, Z9, Z22, Z10, Z2, Z15, Z8, Z21, Z14, Z1, Z19, Z7, Z20, Z13)
+	AVX512_ROUND(Z0, Z17, Z9, Z21, Z13, Z24, Z11, Z3, Z15, Z7, Z18, Z5, Z22, Z14, Z1, Z12, Z4, Z16, Z8, Z20, Z6, Z23, Z10, Z2, Z19)
+	AVX512_ROUND(Z0, Z11, Z22, Z8, Z19, Z21, Z7, Z18, Z4, Z10, Z17, Z3, Z14, Z20, Z6, Z13, Z24, Z5, Z16, Z2, Z9, Z15, Z1, Z12, Z23)
+	AVX512_ROUND(Z0, Z7, Z14, Z16, Z23, Z8, Z10, Z17, Z24, Z1, Z11, Z18, Z20, Z2, Z9, Z19, Z21, Z3, Z5, Z12, Z22, Z4, Z6, Z13, Z15)
+	AVX512_ROUND(Z0, Z10, Z20, Z5, Z15, Z16, Z1, Z11, Z21, Z6, Z7, Z17, Z2, Z12, Z22, Z23, Z8, Z18, Z3, Z13, Z14, Z24, Z9, Z19, Z4)
+	VMOVDQU64 Z0, 0(DI)
+	VMOVDQU64 Z1, 64(DI)
+	VMOVDQU64 Z2, 128(DI)
+	VMOVDQU64 Z3, 192(DI)
+	VMOVDQU64 Z4, 256(DI)
+	VMOVDQU64 Z5, 320(DI)
+	VMOVDQU64 Z6, 384(DI)
+	VMOVDQU64 Z7, 448(DI)
+	VMOVDQU64 Z8, 512(DI)
+	VMOVDQU64 Z9, 576(DI)
+	VMOVDQU64 Z10, 640(DI)
+	VMOVDQU64 Z11, 704(DI)
+	VMOVDQU64 Z12, 768(DI)
+	VMOVDQU64 Z13, 832(DI)
+	VMOVDQU64 Z14, 896(DI)
+	VMOVDQU64 Z15, 960(DI)
+	VMOVDQU64 Z16, 1024(DI)
+	VMOVDQU64 Z17, 1088(DI)
+	VMOVDQU64 Z18, 1152(DI)
+	VMOVDQU64 Z19, 1216(DI)
+	VMOVDQU64 Z20, 1280(DI)
+	VMOVDQU64 Z21, 1344(DI)
+	VMOVDQU64 Z22, 1408(DI)
+	VMOVDQU64 Z23, 1472(DI)
+	VMOVDQU64 Z24, 1536(DI)
+	VZEROUPPER
+	RET
@@ -0,0 +1,18 @@
+//go:build arm64 && !purego
+
+package miner
+
+import "golang.org/x/sys/cpu"
+
+//go:noescape
+func keccakF1600x2(state *uint64)
+
+// The NEON kernel is two buffers wide: a 128-bit register holds one lane of
+// two states, so the 25 lanes fill 25 of the 32 vector registers. Four
+// buffers would need 50 registers and spill to memory every round.
+func simdKernels() []simdKernel {
+	if !cpu.ARM64.HasASIMD {
+		return nil
+	}
+	return []simdKernel{{name: "neon", lanes: 2, permute: func(state []uint64) { keccakF1600x2(&state[0]) }}}
+}
@@ -0,0 +1,277 @@
+//go:build arm64 && !purego
+
+#include "textflag.h"
+
+DATA roundConstants<>+0x00(SB)/8, $0x0000000000000001
+DATA roundConstants<>+0x08(SB)/8, $0x0000000000008082
+DATA roundConstants<>+0x10(SB)/8, $0x800000000000808a
+DATA roundConstants<>+0x18(SB)/8, $0x8000000080008000
+DATA roundConstants<>+0x20(SB)/8, $0x000000000000808b
+DATA roundConstants<>+0x28(SB)/8, $0x0000000080000001
+DATA roundConstants<>+0x30(SB)/8, $0x8000000080008081
+DATA roundConstants<>+0x38(SB)/8, $0x8000000000008009
+DATA roundConstants<>+0x40(SB)/8, $0x000000000000008a
+DATA roundConstants<>+0x48(SB)/8, $0x0000000000000088
+DATA roundConstants<>+0x50(SB)/8, $0x0000000080008009
+DATA roundConstants<>+0x58(SB)/8, $0x000000008000000a
+DATA roundConstants<>+0x60(SB)/8, $0x000000008000808b
+DATA roundConstants<>+0x68(SB)/8, $0x800000000000008b
+DATA roundConstants<>+0x70(SB)/8, $0x8000000000008089
+DATA roundConstants<>+0x78(SB)/8, $0x8000000000008003
+DATA roundConstants<>+0x80(SB)/8, $0x8000000000008002
+DATA roundConstants<>+0x88(SB)/8, $0x8000000000000080
+DATA roundConstants<>+0x90(SB)/8, $0x000000000000800a
+DATA roundConstants<>+0x98(SB)/8, $0x800000008000000a
+DATA roundConstants<>+0xa0(SB)/8, $0x8000000080008081
+DATA roundConstants<>+0xa8(SB)/8, $0x8000000000008080
+DATA roundConstants<>+0xb0(SB)/8, $0x0000000080000001
+DATA roundConstants<>+0xb8(SB)/8, $0x8000000080008008
+GLOBL roundConstants<>(SB), RODATA|NOPTR, $192
+
+// NEON_ROUND computes a round on the state held in the 25 registers
+// passed as lanes a00 to a44, two buffers per register. As on amd64,
+// rho-pi is done by permuting the registers passed to the next round.
+// V25-V29 hold the column parities and then a row of B, V30 the theta
+// effect D, V31 a temporary and V28 the round constant.
+#define NEON_ROUND(a00, a10, a20, a30, a40, a01, a11, a21, a31, a41, a02, a12, a22, a32, a42, a03, a13, a23, a33, a43, a04, a14, a24, a34, a44) \
+	VEOR a01.B16, a00.B16, V25.B16; \
+	VEOR a02.B16, V25.B16, V25.B16; \
+	VEOR a03.B16, V25.B16, V25.B16; \
+	VEOR a04.B16, V25.B16, V25.B16; \
+	VEOR a11.B16, a10.B16, V26.B16; \
+	VEOR a12.B16, V26.B16, V26.B16; \
+	VEOR a13.B16, V26.B16, V26.B16; \
+	VEOR a14.B16, V26.B16, V26.B16; \
+	VEOR a21.B16, a20.B16, V27.B16; \
+	VEOR a22.B16, V27.B16, V27.B16; \
+	VEOR a23.B16, V27.B16, V27.B16; \
+	VEOR a24.B16, V27.B16, V27.B16; \
+	VEOR a31.B16, a30.B16, V28.B16; \
+	VEOR a32.B16, V28.B16, V28.B16; \
+	VEOR a33.B16, V28.B16, V28.B16; \
+	VEOR a34.B16, V28.B16, V28.B16; \
+	VEOR a41.B16, a40.B16, V29.B16; \
+	VEOR a42.B16, V29.B16, V29.B16; \
+	VEOR a43.B16, V29.B16, V29.B16; \
+	VEOR a44.B16, V29.B16, V29.B16; \
+	VSHL $1, V26.D2, V30.D2; \
+	VSRI $63, V26.D2, V30.D2; \
+	VEOR V29.B16, V30.B16, V30.B16; \
+	VEOR V30.B16, a00.B16, a00.B16; \
+	VEOR V30.B16, a01.B16, V31.B16; \
+	VSHL $36, V31.D2, a01.D2; \
+	VSRI $28, V31.D2, a01.D2; \
+	VEOR V30.B16, a02.B16, V31.B16; \
+	VSHL $3, V31.D2, a02.D2; \
+	VSRI $61, V31.D2, a02.D2; \
+	VEOR V30.B16, a03.B16, V31.B16; \
+	VSHL $41, V31.D2, a03.D2; \
+	VSRI $23, V31.D2, a03.D2; \
+	VEOR V30.B16, a04.B16, V31.B16; \
+	VSHL $18, V31.D2, a04.D2; \
+	VSRI $46, V31.D2, a04.D2; \
+	VSHL $1, V27.D2, V30.D2; \
+	VSRI $63, V27.D2, V30.D2; \
+	VEOR V25.B16, V30.B16, V30.B16; \
+	VEOR V30.B16, a10.B16, V31.B16; \
+	VSHL $1, V31.D2, a10.D2; \
+	VSRI $63, V31.D2, a10.D2; \
+	VEOR V30.B16, a11.B16, V31.B16; \
+	VSHL $44, V31.D2, a11.D2; \
+	VSRI $20, V31.D2, a11.D2; \
+	VEOR V30.B16, a12.B16, V31.B16; \
+	VSHL $10, V31.D2, a12.D2; \
+	VSRI $54, V31.D2, a12.D2; \
+	VEOR V30.B16, a13.B16, V31.B16; \
+	VSHL $45, V31.D2, a13.D2; \
+	VSRI $19, V31.D2, a13.D2; \
+	VEOR V30.B16, a14.B16, V31.B16; \
+	VSHL $2, V31.D2, a14.D2; \
+	VSRI $62, V31.D2, a14.D2; \
+	VSHL $1, V28.D2, V30.D2; \
+	VSRI $63, V28.D2, V30.D2; \
+	VEOR V26.B16, V30.B16, V30.B16; \
+	VEOR V30.B16, a20.B16, V31.B16; \
+	VSHL $62, V31.D2, a20.D2; \
+	VSRI $2, V31.D2, a20.D2; \
+	VEOR V30.B16, a21.B16, V31.B16; \
+	VSHL $6, V31.D2, a21.D2; \
+	VSRI $58, V31.D2, a21.D2; \
+	VEOR V30.B16, a22.B16, V31.B16; \
+	VSHL $43, V31.D2, a22.D2; \
+	VSRI $21, V31.D2, a22.D2; \
+	VEOR V30.B16, a23.B16, V31.B16; \
+	VSHL $15, V31.D2, a23.D2; \
+	VSRI $49, V31.D2, a23.D2; \
+	VEOR V30.B16, a24.B16, V31.B16; \
+	VSHL $61, V31.D2, a24.D2; \
+	VSRI $3, V31.D2, a24.D2; \
+	VSHL $1, V29.D2, V30.D2; \
+	VSRI $63, V29.D2, V30.D2; \
+	VEOR V27.B16, V30.B16, V30.B16; \
+	VEOR V30.B16, a30.B16, V31.B16; \
+	VSHL $28, V31.D2, a30.D2; \
+	VSRI $36, V31.D2, a30.D2; \
+	VEOR V30.B16, a31.B16, V31.B16; \
+	VSHL $55, V31.D2, a31.D2; \
+	VSRI $9, V31.D2, a31.D2; \
+	VEOR V30.B16, a32.B16, V31.B16; \
+	VSHL $25, V31.D2, a32.D2; \
+	VSRI $39, V31.D2, a32.D2; \
+	VEOR V30.B16, a33.B16, V31.B16; \
+	VSHL $21, V31.D2, a33.D2; \
+	VSRI $43, V31.D2, a33.D2; \
+	VEOR V30.B16, a34.B16, V31.B16; \
+	VSHL $56, V31.D2, a34.D2; \
+	VSRI $8, V31.D2, a34.D2; \
+	VSHL $1, V25.D2, V30.D2; \
+	VSRI $63, V25.D2, V30.D2; \
+	VEOR V28.B16, V30.B16, V30.B16; \
+	VEOR V30.B16, a40.B16, V31.B16; \
+	VSHL $27, V31.D2, a40.D2; \
+	VSRI $37, V31.D2, a40.D2; \
+	VEOR V30.B16, a41.B16, V31.B16; \
+	VSHL $20, V31.D2, a41.D2; \
+	VSRI $44, V31.D2, a41.D2; \
+	VEOR V30.B16, a42.B16, V31.B16; \
+	VSHL $39, V31.D2, a42.D2; \
+	VSRI $25, V31.D2, a42.D2; \
+	VEOR V30.B16, a43.B16, V31.B16; \
+	VSHL $8, V31.D2, a43.D2; \
+	VSRI $56, V31.D2, a43.D2; \
+	VEOR V30.B16, a44.B16, V31.B16; \
+	VSHL $14, V31.D2, a44.D2; \
+	VSRI $50, V31.D2, a44.D2; \
+	VMOV a00.B16, V25.B16; \
+	VMOV a11.B16, V26.B16; \
+	VORR a22.B16, a11.B16, V27.B16; \
+	VEOR a11.B16, V27.B16, V27.B16; \
+	VEOR V27.B16, a00.B16, a00.B16; \
+	VORR a33.B16, a22.B16, V27.B16; \
+	VEOR a22.B16, V27.B16, V27.B16; \
+	VEOR V27.B16, a11.B16, a11.B16; \
+	VORR a44.B16, a33.B16, V27.B16; \
+	VEOR a33.B16, V27.B16, V27.B16; \
+	VEOR V27.B16, a22.B16, a22.B16; \
+	VORR V25.B16, a44.B16, V27.B16; \
+	VEOR a44.B16, V27.B16, V27.B16; \
+	VEOR V27.B16, a33.B16, a33.B16; \
+	VORR V26.B16, V25.B16, V27.B16; \
+	VEOR V25.B16, V27.B16, V27.B16; \
+	VEOR V27.B16, a44.B16, a44.B16; \
+	VMOV a30.B16, V25.B16; \
+	VMOV a41.B16, V26.B16; \
+	VORR a02.B16, a41.B16, V27.B16; \
+	VEOR a41.B16, V27.B16, V27.B16; \
+	VEOR V27.B16, a30.B16, a30.B16; \
+	VORR a13.B16, a02.B16, V27.B16; \
+	VEOR a02.B16, V27.B16, V27.B16; \
+	VEOR V27.B16, a41.B16, a41.B16; \
+	VORR a24.B16, a13.B16, V27.B16; \
+	VEOR a13.B16, V27.B16, V27.B16; \
+	VEOR V27.B16, a02.B16, a02.B16; \
+	VORR V25.B16, a24.B16, V27.B16; \
+	VEOR a24.B16, V27.B16, V27.B16; \
+	VEOR V27.B16, a13.B16, a13.B16; \
+	VORR V26.B16, V25.B16, V27.B16; \
+	VEOR V25.B16, V27.B16, V27.B16; \
+	VEOR V27.B16, a24.B16, a24.B16; \
+	VMOV a10.B16, V25.B16; \
+	VMOV a21.B16, V26.B16; \
+	VORR a32.B16, a21.B16, V27.B16; \
+	VEOR a21.B16, V27.B16, V27.B16; \
+	VEOR V27.B16, a10.B16, a10.B16; \
+	VORR a43.B16, a32.B16, V27.B16; \
+	VEOR a32.B16, V27.B16, V27.B16; \
+	VEOR V27.B16, a21.B16, a21.B16; \
+	VORR a04.B16, a43.B16, V27.B16; \
+	VEOR a43.B16, V27.B16, V27.B16; \
+	VEOR V27.B16, a32.B16, a32.B16; \
+	VORR V25.B16, a04.B16, V27.B16; \
+	VEOR a04.B16, V27.B16, V27.B16; \
+	VEOR V27.B16, a43.B16, a43.B16; \
+	VORR V26.B16, V25.B16, V27.B16; \
+	VEOR V25.B16, V27.B16, V27.B16; \
+	VEOR V27.B16, a04.B16, a04.B16; \
+	VMOV a40.B16, V25.B16; \
+	VMOV a01.B16, V26.B16; \
+	VORR a12.B16, a01.B16, V27.B16; \
+	VEOR a01.B16, V27.B16, V27.B16; \
+	VEOR V27.B16, a40.B16, a40.B16; \
+	VORR a23.B16, a12.B16, V27.B16; \
+	VEOR a12.B16, V27.B16, V27.B16; \
+	VEOR V27.B16, a01.B16, a01.B16; \
+	VORR a34.B16, a23.B16, V27.B16; \
+	VEOR a23.B16, V27.B16, V27.B16; \
+	VEOR V27.B16, a12.B16, a12.B16; \
+	VORR V25.B16, a34.B16, V27.B16; \
+	VEOR a34.B16, V27.B16, V27.B16; \
+	VEOR V27.B16, a23.B16, a23.B16; \
+	VORR V26.B16, V25.B16, V27.B16; \
+	VEOR V25.B16, V27.B16, V27.B16; \
+	VEOR V27.B16, a34.B16, a34.B16; \
+	VMOV a20.B16, V25.B16; \
+	VMOV a31.B16, V26.B16; \
+	VORR a42.B16, a31.B16, V27.B16; \
+	VEOR a31.B16, V27.B16, V27.B16; \
+	VEOR V27.B16, a20.B16, a20.B16; \
+	VORR a03.B16, a42.B16, V27.B16; \
+	VEOR a42.B16, V27.B16, V27.B16; \
+	VEOR V27.B16, a31.B16, a31.B16; \
+	VORR a14.B16, a03.B16, V27.B16; \
+	VEOR a03.B16, V27.B16, V27.B16; \
+	VEOR V27.B16, a42.B16, a42.B16; \
+	VORR V25.B16, a14.B16, V27.B16; \
+	VEOR a14.B16, V27.B16, V27.B16; \
+	VEOR V27.B16, a03.B16, a03.B16; \
+	VORR V26.B16, V25.B16, V27.B16; \
+	VEOR V25.B16, V27.B16, V27.B16; \
+	VEOR V27.B16, a14.B16, a14.B16; \
+	VLD1R.P 8(R1), [V28.D2]; \
+	VEOR V28.B16, a00.B16, a00.B16
+
+// func keccakF1600x2(state *uint64)
+TEXT ·keccakF1600x2(SB), NOSPLIT, $0-8
+	MOVD state+0(FP), R0
+	MOVD $roundConstants<>(SB), R1
+	MOVD R0, R2
+	VLD1.P 64(R2), [V0.D2, V1.D2, V2.D2, V3.D2]
+	VLD1.P 64(R2), [V4.D2, V5.D2, V6.D2, V7.D2]
+	VLD1.P 64(R2), [V8.D2, V9.D2, V10.D2, V11.D2]
+	VLD1.P 64(R2), [V12.D2, V13.D2, V14.D2, V15.D2]
+	VLD1.P 64(R2), [V16.D2, V17.D2, V18.D2, V19.D2]
+	VLD1.P 64(R2), [V20.D2, V21.D2, V22.D2, V23.D2]
+	VLD1 (R2), [V24.D2]
+	NEON_ROUND(V0, V1, V2, V3, V4, V5, V6, V7, V8, V9, V10, V11, V12, V13, V14, V15, V16, V17, V18, V19, V20, V21, V22, V23, V24)
+	NEON_ROUND(V0, V6, V12, V18, V24, V3, V9, V10, V16, V22, V1, V7, V13, V19, V20, V4, V5, V11, V17, V23, V2, V8, V14, V15, V21)
+	NEON_ROUND(V0, V9, V13, V17, V21, V18, V22, V1, V5, V14, V6, V10, V19, V23, V2, V24, V3, V7, V11, V15, V12, V16, V20, V4, V8)
+	NEON_ROUND(V0, V22, V19, V11, V8, V17, V14, V6, V3, V20, V9, V1, V23, V15, V12, V21, V18, V10, V7, V4, V13, V5, V2, V24, V16)
+	NEON_ROUND(V0, V14, V23, V7, V16, V11, V20, V9, V18, V2, V22, V6, V15, V4, V13, V8, V17, V1, V10, V24, V19, V3, V12, V21, V5)
+	NEON_ROUND(V0, V20, V15, V10, V5, V7, V2, V22, V17, V12, V14, V9, V4, V24, V19, V16, V11, V6, V1, V21, V23, V18, V13, V8, V3)
+	NEON_ROUND(V0, V2, V4, V1, V3, V10, V12, V14, V11, V13, V20, V22, V24, V21, V23, V5, V7, V9, V6, V8, V15, V17, V19, V16, V18)
+	NEON_ROUND(V0, V12, V24, V6, V18, V1, V13, V20, V7, V19, V2, V14, V21, V8, V15, V3, V10, V22, V9, V16, V4, V11, V23, V5, V17)
+	NEON_ROUND(V0, V13, V21, V9, V17, V6, V19, V2, V10, V23, V12, V20, V8, V16, V4, V18, V1, V14, V22, V5, V24, V7, V15, V3, V11)
+	NEON_ROUND(V0, V19, V8, V22, V11, V9, V23, V12, V1, V15, V13, V2, V16, V5, V24, V17, V6, V20, V14, V3, V21, V10, V4, V18, V7)
+	NEON_ROUND(V0, V23, V16, V14, V7, V22, V15, V13, V6, V4, V19, V12, V5, V3, V21, V11, V9, V2, V20, V18, V8, V1, V24, V17, V10)
+	NEON_ROUND(V0, V15, V5, V20, V10, V14, V4, V19, V9, V24, V23, V13, V3, V18, V8, V7, V22, V12, V2, V17, V16, V6, V21, V11, V1)
+	NEON_ROUND(V0, V4, V3, V2, V1, V20, V24, V23, V22, V21, V15, V19, V18, V17, V16, V10, V14, V13, V12, V11, V5, V9, V8, V7, V6)
+	NEON_ROUND(V0, V24, V18, V12, V6, V2, V21, V15, V14, V8, V4, V23, V17, V11, V5, V1, V20, V19, V13, V7, V3, V22, V16, V10, V9)
+	NEON_ROUND(V0, V21, V17, V13, V9, V12, V8, V4, V20, V16, V24, V15, V11, V7, V3, V6, V2, V23, V19, V10, V18, V14, V5, V1, V22)
+	NEON_ROUND(V0, V8, V11, V19, V22, V13, V16, V24, V2, V5, V21, V4, V7, V10, V18, V9, V12, V15, V23, V1, V17, V20, V3, V6, V14)
+	NEON_ROUND(V0, V16, V7, V23, V14, V19, V5, V21, V12, V3, V8, V24, V10, V1, V17, V22, V13, V4, V15, V6, V11, V2, V18, V9, V20)
+	NEON_ROUND(V0, V5, V10, V15, V20, V23, V3, V8, V13, V18, V16, V21, V1, V6, V11, V14, V19, V24, V4, V9, V7, V12, V17, V22, V2)
+	NEON_ROUND(V0, V3, V1, V4, V2, V15, V18, V16, V19, V17, V5, V8, V6, V9, V7, V20, V23, V21, V24, V22, V10, V13, V11, V14, V12)
+	NEON_ROUND(V0, V18, V6, V24, V12, V4, V17, V5, V23, V11, V3, V16, V9, V22, V10, V2, V15, V8, V21, V14, V1, V19, V7, V20, V13)
+	NEON_ROUND(V0, V17, V9, V21, V13, V24, V11, V3, V15, V7, V18, V5, V22, V14, V1, V12, V4, V16, V8, V20, V6, V23, V10, V2, V19)
+	NEON_ROUND(V0, V11, V22, V8, V19, V21, V7, V18, V4, V10, V17, V3, V14, V20, V6, V13, V24, V5, V16, V2, V9, V15, V1, V12, V23)
+	NEON_ROUND(V0, V7, V14, V16, V23, V8, V10, V17, V24, V1, V11, V18, V20, V2, V9, V19, V21, V3, V5, V12, V22, V4, V6, V13, V15)
+	NEON_ROUND(V0, V10, V20, V5, V15, V16, V1, V11, V21, V6, V7, V17, V2, V12, V22, V23, V8, V18, V3, V13, V14, V24, V9, V19, V4)
+	MOVD R0, R2
+	VST1.P [V0.D2, V1.D2, V2.D2, V3.D2], 64(R2)
+	VST1.P [V4.D2, V5.D2, V6.D2, V7.D2], 64(R2)
+	VST1.P [V8.D2, V9.D2, V10.D2, V11.D2], 64(R2)
+	VST1.P [V12.D2, V13.D2, V14.D2, V15.D2], 64(R2)
+	VST1.P [V16.D2, V17.D2, V18.D2, V19.D2], 64(R2)
+	VST1.P [V20.D2, V21.D2, V22.D2, V23.D2], 64(R2)
+	VST1 [V24.D2], (R2)
+	RET
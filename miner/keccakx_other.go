@@ -0,0 +1,5 @@
+//go:build (!amd64 && !arm64) || purego
+
+package miner
+
+func simdKernels() []simdKernel { return nil }
@@ -0,0 +1,86 @@
+package miner
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// TestSIMDKernels compares the digest lanes of every multi-buffer kernel on
+// this CPU with the generic permutation applied to each buffer alone.
+func TestSIMDKernels(t *testing.T) {
+	for _, k := range append(simdKernels(), genericKernel) {
+		t.Run(k.name, func(t *testing.T) {
+			for round := 0; round < 100; round++ {
+				state := make([]uint64, 25*k.lanes)
+				raw := make([]byte, 8*len(state))
+				rand.Read(raw)
+				for i := range state {
+					state[i] = binary.LittleEndian.Uint64(raw[8*i:])
+				}
+				want := make([][25]uint64, k.lanes)
+				for b := range want {
+					for i := range want[b] {
+						want[b][i] = state[i*k.lanes+b]
+					}
+					keccakF1600Digest(&want[b])
+				}
+				k.permute(state)
+				for b := range want {
+					for i := 0; i < 4; i++ {
+						if got := state[i*k.lanes+b]; got != want[b][i] {
+							t.Fatalf("buffer %d lane %d: %#x, want %#x", b, i, got, want[b][i])
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestHashersMatchKeccak hashes random nonces with every backend, in batches
+// from one nonce to more than two full vectors, and compares them with
+// Keccak-256 of the filled in template.
+func TestHashersMatchKeccak(t *testing.T) {
+	layouts := []struct {
+		name           string
+		length, offset int
+	}{
+		{"challenge-sender-nonce", 84, 52},
+		{"challenge-sender32-nonce", 96, 64},
+		{"nonce-first", 84, 0},
+	}
+	for _, layout := range layouts {
+		template := make([]byte, layout.length)
+		rand.Read(template)
+		for _, h := range Hashers() {
+			t.Run(layout.name+"/"+h.Name(), func(t *testing.T) {
+				nh, err := h.Prepare(template, layout.offset)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for batch := 1; batch <= 2*hashLanes+1; batch++ {
+					nonces := make([][32]byte, batch)
+					for i := range nonces {
+						rand.Read(nonces[i][:])
+					}
+					// Leading zero bytes are the common case for counters.
+					nonces[0] = [32]byte{31: byte(batch)}
+					out := make([]common.Hash, batch)
+					nh.Hash(nonces, out)
+					for i, nonce := range nonces {
+						preimage := bytes.Clone(template)
+						copy(preimage[layout.offset:], nonce[:])
+						if want := crypto.Keccak256Hash(preimage); out[i] != want {
+							t.Fatalf("batch of %d, nonce %d (%x): %s, want %s", batch, i, nonce, out[i].Hex(), want.Hex())
+						}
+					}
+				}
+			})
+		}
+	}
+}
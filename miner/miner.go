@@ -0,0 +1,460 @@
+package miner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gethabi "github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+)
+
+// rebalanceInterval is how often the worker allocation is recomputed even
+// when nothing triggered it, so that profitability changes are picked up.
+const rebalanceInterval = time.Minute
+
+// Backend is what the miner needs from a node: contract calls for jobs and,
+// when it submits solutions itself, sending transactions and waiting for
+// receipts. *ethclient.Client implements it.
+type Backend interface {
+	bind.ContractBackend
+	bind.DeployBackend
+}
+
+// Hooks are called synchronously as things happen, in addition to the
+// events sent on Miner.Events. They must not block.
+type Hooks struct {
+	// OnJob is called when a contract's job changes.
+	OnJob func(c *Contract, job *Job)
+	// OnSolution is called when a worker finds a solution.
+	OnSolution func(s *Solution)
+	// OnExhausted is called when a contract can no longer be mined.
+	OnExhausted func(c *Contract, reason string)
+	// OnWorkerFailed is called when a worker returns an error or panics,
+	// before it is restarted.
+	OnWorkerFailed func(worker int, err error)
+}
+
+// Options configure a Miner.
+type Options struct {
+	// Backend is the node to read jobs from and, with Signer, submit to.
+	Backend Backend
+	// Scheme is the contract family; it defaults to PoWERC20.
+	Scheme Scheme
+	// Contracts to mine; at least one is required.
+	Contracts []ContractSpec
+	// Sender is the account solutions are mined for. It defaults to
+	// Signer.From.
+	Sender common.Address
+	// Signer, if set, makes the Miner submit every solution itself and
+	// wait for its receipt. Without it, solutions are only delivered as
+	// SolutionEvents and the caller must call Resume after handling each.
+	Signer *bind.TransactOpts
+	// Workers is the number of hashing goroutines.
+	Workers int
+	// Allocation splits workers across contracts by "weights" (default)
+	// or by expected "profit" per hash.
+	Allocation string
+	// PollInterval is how often jobs are re-read; it defaults to 15s.
+	PollInterval time.Duration
+	// Hasher is the Keccak-256 backend workers use; it defaults to the
+	// reference keccak256 backend. See BenchmarkHashers to pick the fastest.
+	Hasher Hasher
+	// Throttle limits the CPU the workers take; see SetThrottle.
+	Throttle Throttle
+	// Supervision sets how failed workers are restarted and when mining
+	// stops because they fail too often.
+	Supervision Supervision
+	// Logger receives the miner's log entries; it defaults to the standard
+	// logrus logger.
+	Logger *logrus.Entry
+	Hooks  Hooks
+}
+
+// EventType identifies what an Event reports.
+type EventType int
+
+const (
+	// JobEvent reports a new job on Contract.
+	JobEvent EventType = iota
+	// SolutionEvent reports a Solution.
+	SolutionEvent
+	// ExhaustedEvent reports that Contract can no longer be mined; Reason
+	// says why.
+	ExhaustedEvent
+	// SubmittedEvent reports that the Miner sent Tx for Solution.
+	SubmittedEvent
+	// ConfirmedEvent reports the Receipt of a submitted Tx, which may
+	// have reverted.
+	ConfirmedEvent
+	// ErrorEvent reports an error that stops the Miner from working
+	// properly, such as a failed submission or workers halted by a fatal
+	// error or by failing too often; Err is set.
+	ErrorEvent
+	// WorkerFailedEvent reports that Worker returned Err or panicked with
+	// a *PanicError; it is restarted unless an ErrorEvent follows.
+	WorkerFailedEvent
+)
+
+func (t EventType) String() string {
+	switch t {
+	case JobEvent:
+		return "job"
+	case SolutionEvent:
+		return "solution"
+	case ExhaustedEvent:
+		return "exhausted"
+	case SubmittedEvent:
+		return "submitted"
+	case ConfirmedEvent:
+		return "confirmed"
+	case ErrorEvent:
+		return "error"
+	case WorkerFailedEvent:
+		return "worker_failed"
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// Event is something that happened in the Miner. Only the fields that
+// apply to Type are set.
+type Event struct {
+	Type     EventType
+	Contract *Contract
+	Job      *Job
+	Solution *Solution
+	Reason   string
+	Tx       *types.Transaction
+	Receipt  *types.Receipt
+	Worker   int
+	Err      error
+}
+
+// ContractStats is the state of one contract in a Stats snapshot.
+type ContractStats struct {
+	Contract *Contract
+	Job      *Job
+	State    string
+	Workers  int
+	Hashes   uint64
+}
+
+// Stats is a snapshot of the Miner.
+type Stats struct {
+	Workers     int
+	Paused      bool
+	Throttle    Throttle
+	InWindow    bool // whether the throttle's windows allow hashing now
+	Hasher      string
+	Hashrate    float64 // hashes per second at the last sample
+	Hashes      uint64
+	WorkerRates []float64
+	Restarts    uint64 // workers restarted after failing
+	Contracts   []ContractStats
+}
+
+// Miner hashes on a set of contracts with a resizable pool of workers.
+type Miner struct {
+	opts      Options
+	log       *logrus.Entry
+	contracts []*Contract
+	sched     *scheduler
+	stats     *hashStats
+	sup       *supervisor
+	events    chan Event
+	throttle  atomic.Pointer[Throttle]
+	// worker is the loop supervise runs for each worker, m.work outside
+	// of tests.
+	worker func(ctx context.Context, id int) error
+
+	mu     sync.Mutex
+	pool   *workerPool
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New validates opts and returns a Miner that is ready to Start.
+func New(opts Options) (*Miner, error) {
+	if opts.Backend == nil {
+		return nil, errors.New("a backend is required")
+	}
+	if len(opts.Contracts) == 0 {
+		return nil, errors.New("no contract to mine")
+	}
+	if opts.Workers < 0 {
+		return nil, fmt.Errorf("invalid worker count %d", opts.Workers)
+	}
+	switch opts.Allocation {
+	case "":
+		opts.Allocation = "weights"
+	case "weights", "profit":
+	default:
+		return nil, fmt.Errorf("unknown allocation %q, expected weights or profit", opts.Allocation)
+	}
+	if opts.Scheme == nil {
+		scheme, err := NewPoWERC20Scheme()
+		if err != nil {
+			return nil, err
+		}
+		opts.Scheme = scheme
+	}
+	if opts.Signer != nil && opts.Sender == (common.Address{}) {
+		opts.Sender = opts.Signer.From
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 15 * time.Second
+	}
+	if opts.Hasher == nil {
+		opts.Hasher = referenceHasher{}
+	}
+	if opts.Logger == nil {
+		opts.Logger = logrus.NewEntry(logrus.StandardLogger())
+	}
+
+	m := &Miner{
+		opts:   opts,
+		log:    opts.Logger,
+		stats:  newHashStats(opts.Workers),
+		sup:    newSupervisor(opts.Supervision),
+		events: make(chan Event, 64),
+	}
+	m.worker = m.work
+	for _, spec := range opts.Contracts {
+		m.contracts = append(m.contracts, newContract(spec, opts.Scheme, m))
+	}
+	m.sched = newScheduler(m.contracts, opts.Allocation, opts.Workers, opts.Logger)
+	m.SetThrottle(opts.Throttle)
+	return m, nil
+}
+
+// Contracts returns the contracts being mined, in the order given.
+func (m *Miner) Contracts() []*Contract { return m.contracts }
+
+// Events returns the channel events are delivered on. Without a Signer,
+// workers wait until their SolutionEvent is received, so the channel must
+// be drained; other events are dropped when nobody keeps up.
+func (m *Miner) Events() <-chan Event { return m.events }
+
+// Done is closed once every contract is exhausted.
+func (m *Miner) Done() <-chan struct{} { return m.sched.done }
+
+// Start starts the job watchers and workers. They run until ctx is done or
+// Stop is called.
+func (m *Miner) Start(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cancel != nil {
+		return errors.New("miner already started")
+	}
+	ctx, m.cancel = context.WithCancel(ctx)
+	background := func(fn func()) {
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			fn()
+		}()
+	}
+	for _, c := range m.contracts {
+		c := c
+		background(func() { c.watch(ctx, m.opts.PollInterval) })
+	}
+	background(func() { m.sched.run(ctx, rebalanceInterval) })
+	background(func() { m.sample(ctx) })
+	m.pool = newWorkerPool(m.sup.start(ctx), m.supervise)
+	m.pool.resize(m.opts.Workers)
+	return nil
+}
+
+// Stop stops the workers and watchers and waits for them to return.
+func (m *Miner) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cancel == nil {
+		return
+	}
+	m.cancel()
+	m.pool.stop()
+	m.wg.Wait()
+}
+
+// sample turns hash counts into rates every second and logs when the
+// throttle's windows open and close.
+func (m *Miner) sample(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	inWindow := m.InWindow()
+	if !inWindow {
+		m.log.Infof("Outside the mining windows %s, hashing waits", m.Throttle().windows())
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.stats.sample(now)
+			if in := m.InWindow(); in != inWindow {
+				inWindow = in
+				if in {
+					m.log.Info("Mining window opened, hashing resumed")
+				} else {
+					m.log.Info("Mining window closed, hashing waits for the next one")
+				}
+			}
+		}
+	}
+}
+
+// SetWorkers changes the number of workers.
+func (m *Miner) SetWorkers(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.opts.Workers = n
+	m.stats.resize(n)
+	m.sched.resize(n)
+	if m.pool != nil {
+		m.pool.resize(n)
+	}
+}
+
+// Workers returns the number of workers.
+func (m *Miner) Workers() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.opts.Workers
+}
+
+// SetPaused suspends or resumes all hashing without stopping the workers.
+func (m *Miner) SetPaused(paused bool) { m.sched.paused.Store(paused) }
+
+// Paused reports whether hashing is suspended.
+func (m *Miner) Paused() bool { return m.sched.paused.Load() }
+
+// Rebalance asks the scheduler to recompute the worker allocation, for
+// example after a contract's profitability changed.
+func (m *Miner) Rebalance() { m.sched.rebalance() }
+
+// Resume lets workers mine c again after a solution was handed off.
+func (m *Miner) Resume(c *Contract) {
+	c.resume()
+	m.Rebalance()
+}
+
+// Hashrate returns the total hashes per second at the last sample.
+func (m *Miner) Hashrate() float64 { return m.stats.Rate() }
+
+// Stats returns a snapshot of the workers and contracts.
+func (m *Miner) Stats() Stats {
+	st := Stats{
+		Workers:     m.Workers(),
+		Paused:      m.Paused(),
+		Throttle:    m.Throttle(),
+		InWindow:    m.InWindow(),
+		Hasher:      m.opts.Hasher.Name(),
+		Hashrate:    m.stats.Rate(),
+		Hashes:      m.stats.Total(),
+		WorkerRates: m.stats.WorkerRates(),
+		Restarts:    m.sup.restarts.Load(),
+	}
+	workers := m.sched.workers()
+	for i, c := range m.contracts {
+		st.Contracts = append(st.Contracts, ContractStats{
+			Contract: c,
+			Job:      c.CurrentJob(),
+			State:    c.State(),
+			Workers:  workers[i],
+			Hashes:   c.Hashes(),
+		})
+	}
+	return st
+}
+
+// emit sends ev without blocking; it is dropped if the channel is full.
+func (m *Miner) emit(ev Event) {
+	select {
+	case m.events <- ev:
+	default:
+	}
+}
+
+func (m *Miner) newJob(c *Contract, job *Job) {
+	m.log.WithFields(logrus.Fields{"event": "new_job", "contract": c.address.Hex(), "challenge": job.Challenge.String()}).Infof("New job for %s: challenge %d, difficulty %d", c.name, job.Challenge, job.Difficulty)
+	if m.opts.Hooks.OnJob != nil {
+		m.opts.Hooks.OnJob(c, job)
+	}
+	m.emit(Event{Type: JobEvent, Contract: c, Job: job})
+}
+
+func (m *Miner) contractExhausted(c *Contract, reason string) {
+	m.log.WithFields(logrus.Fields{"event": "contract_stopped", "contract": c.address.Hex()}).Infof("Stopped mining %s: %s", c.name, reason)
+	if m.opts.Hooks.OnExhausted != nil {
+		m.opts.Hooks.OnExhausted(c, reason)
+	}
+	m.emit(Event{Type: ExhaustedEvent, Contract: c, Reason: reason})
+}
+
+// found hands a solution off: to the caller through the events channel,
+// or to submit when the Miner has a signer.
+func (m *Miner) found(ctx context.Context, sol *Solution) {
+	if m.opts.Hooks.OnSolution != nil {
+		m.opts.Hooks.OnSolution(sol)
+	}
+	ev := Event{Type: SolutionEvent, Contract: sol.Contract, Job: sol.Job, Solution: sol}
+	if m.opts.Signer != nil {
+		m.emit(ev)
+		if ctx.Err() != nil {
+			return
+		}
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			m.submit(ctx, sol)
+		}()
+		return
+	}
+	select {
+	case m.events <- ev:
+	case <-ctx.Done():
+	}
+}
+
+// fail reports an error that keeps a worker from running.
+func (m *Miner) fail(ctx context.Context, err error) {
+	select {
+	case m.events <- Event{Type: ErrorEvent, Err: err}:
+	case <-ctx.Done():
+	}
+}
+
+// submit sends sol with the signer, waits for the receipt and lets the
+// contract be mined again.
+func (m *Miner) submit(ctx context.Context, sol *Solution) {
+	defer m.Resume(sol.Contract)
+	data, err := sol.Contract.scheme.SubmitData(sol.Job, sol.Nonce, sol.Digest)
+	if err != nil {
+		m.fail(ctx, fmt.Errorf("failed to encode solution: %v", err))
+		return
+	}
+	backend := m.opts.Backend
+	opts := *m.opts.Signer
+	opts.Context = ctx
+	tx, err := bind.NewBoundContract(sol.Contract.address, gethabi.ABI{}, backend, backend, backend).RawTransact(&opts, data)
+	if err != nil {
+		m.fail(ctx, fmt.Errorf("failed to submit solution to %s: %v", sol.Contract.name, err))
+		return
+	}
+	m.emit(Event{Type: SubmittedEvent, Contract: sol.Contract, Solution: sol, Tx: tx})
+	receipt, err := bind.WaitMined(ctx, backend, tx)
+	if err != nil {
+		if ctx.Err() == nil {
+			m.fail(ctx, fmt.Errorf("failed to wait for %s: %v", tx.Hash().Hex(), err))
+		}
+		return
+	}
+	m.emit(Event{Type: ConfirmedEvent, Contract: sol.Contract, Solution: sol, Tx: tx, Receipt: receipt})
+}
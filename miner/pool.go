@@ -0,0 +1,55 @@
+package miner
+
+import (
+	"context"
+	"sync"
+)
+
+// workerPool runs a resizable set of mining workers. Workers are numbered
+// from zero; shrinking the pool stops the highest-numbered ones.
+type workerPool struct {
+	ctx   context.Context
+	start func(ctx context.Context, id int)
+
+	mu      sync.Mutex
+	cancels []context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func newWorkerPool(ctx context.Context, start func(ctx context.Context, id int)) *workerPool {
+	return &workerPool{ctx: ctx, start: start}
+}
+
+// resize starts or stops workers until n are running.
+func (p *workerPool) resize(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.cancels) < n {
+		id := len(p.cancels)
+		ctx, cancel := context.WithCancel(p.ctx)
+		p.cancels = append(p.cancels, cancel)
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.start(ctx, id)
+		}()
+	}
+	for len(p.cancels) > n {
+		last := len(p.cancels) - 1
+		p.cancels[last]()
+		p.cancels = p.cancels[:last]
+	}
+}
+
+// size returns the number of running workers.
+func (p *workerPool) size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.cancels)
+}
+
+// stop stops every worker and waits for them to return.
+func (p *workerPool) stop() {
+	p.resize(0)
+	p.wg.Wait()
+}
@@ -0,0 +1,211 @@
+package miner
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// scheduler splits the worker pool across contracts and moves workers when
+// a contract's job changes, becomes unprofitable or is exhausted.
+type scheduler struct {
+	sites   []*Contract
+	mode    string
+	log     *logrus.Entry
+	paused  atomic.Bool // whether all hashing is suspended
+	trigger chan struct{}
+	done    chan struct{}
+	once    sync.Once
+
+	mu     sync.RWMutex
+	assign []int32 // contract index per worker, -1 when idle
+}
+
+func newScheduler(sites []*Contract, mode string, workers int, log *logrus.Entry) *scheduler {
+	s := &scheduler{
+		sites:   sites,
+		mode:    mode,
+		log:     log,
+		trigger: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	s.resize(workers)
+	return s
+}
+
+// resize changes the number of workers to allocate and rebalances.
+func (s *scheduler) resize(workers int) {
+	s.mu.Lock()
+	for len(s.assign) < workers {
+		s.assign = append(s.assign, -1)
+	}
+	s.assign = s.assign[:workers]
+	s.mu.Unlock()
+	s.rebalance()
+}
+
+// assigned returns the contract worker id should hash on, or nil.
+func (s *scheduler) assigned(id int) *Contract {
+	if s.paused.Load() {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if id >= len(s.assign) || s.assign[id] < 0 {
+		return nil
+	}
+	return s.sites[s.assign[id]]
+}
+
+// size returns the number of workers allocated.
+func (s *scheduler) size() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.assign)
+}
+
+// workers returns how many workers are assigned to each contract.
+func (s *scheduler) workers() []int {
+	counts := make([]int, len(s.sites))
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, idx := range s.assign {
+		if idx >= 0 {
+			counts[idx]++
+		}
+	}
+	return counts
+}
+
+// rebalance asks the scheduler to recompute the allocation.
+func (s *scheduler) rebalance() {
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// allocate distributes workers over contracts in proportion to their
+// scores using the largest remainder method. Every active contract gets at
+// least one worker as long as there are enough to go around.
+func allocate(scores []float64, workers int) []int {
+	counts := make([]int, len(scores))
+	var total float64
+	var active []int
+	for i, score := range scores {
+		if score > 0 && !math.IsNaN(score) {
+			total += score
+			active = append(active, i)
+		}
+	}
+	if len(active) == 0 || workers == 0 {
+		return counts
+	}
+	type remainder struct {
+		idx  int
+		frac float64
+	}
+	var rems []remainder
+	assigned := 0
+	for _, i := range active {
+		share := scores[i] / total * float64(workers)
+		counts[i] = int(share)
+		assigned += counts[i]
+		rems = append(rems, remainder{i, share - float64(counts[i])})
+	}
+	sort.Slice(rems, func(a, b int) bool { return rems[a].frac > rems[b].frac })
+	for k := 0; assigned < workers; k++ {
+		counts[rems[k%len(rems)].idx]++
+		assigned++
+	}
+	for _, i := range active {
+		if counts[i] > 0 {
+			continue
+		}
+		// Take a worker from the best-served contract that can spare one.
+		donor := -1
+		for _, j := range active {
+			if counts[j] > 1 && (donor < 0 || counts[j] > counts[donor]) {
+				donor = j
+			}
+		}
+		if donor < 0 {
+			break
+		}
+		counts[donor]--
+		counts[i]++
+	}
+	return counts
+}
+
+// apply recomputes the allocation and reassigns workers. It closes done
+// once every contract is exhausted.
+func (s *scheduler) apply() {
+	scores := make([]float64, len(s.sites))
+	exhausted := 0
+	for i, site := range s.sites {
+		if site.Exhausted() != "" {
+			exhausted++
+		}
+		if site.active() {
+			scores[i] = site.score(s.mode)
+		}
+	}
+	if exhausted == len(s.sites) {
+		s.once.Do(func() { close(s.done) })
+		return
+	}
+
+	s.mu.Lock()
+	counts := allocate(scores, len(s.assign))
+	// Keep workers on their current contract where possible so that only
+	// the difference moves.
+	want := append([]int(nil), counts...)
+	var free []int
+	for id, idx := range s.assign {
+		if idx >= 0 && want[idx] > 0 {
+			want[idx]--
+			continue
+		}
+		free = append(free, id)
+	}
+	for idx := range want {
+		for ; want[idx] > 0 && len(free) > 0; want[idx]-- {
+			s.assign[free[0]] = int32(idx)
+			free = free[1:]
+		}
+	}
+	for _, id := range free {
+		s.assign[id] = -1
+	}
+	s.mu.Unlock()
+
+	var parts []string
+	for i, site := range s.sites {
+		parts = append(parts, fmt.Sprintf("%s=%d", ShortAddress(site.address), counts[i]))
+	}
+	s.log.Debugf("Worker allocation: %s", strings.Join(parts, " "))
+}
+
+// run rebalances whenever triggered and at least every interval so that
+// profitability changes are picked up.
+func (s *scheduler) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.apply()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.trigger:
+		}
+	}
+}
@@ -0,0 +1,447 @@
+// Package miner mines proof-of-work ERC20 tokens such as PoWERC20. A Miner
+// splits a pool of hashing workers across one or more contracts, follows
+// their jobs and reports solutions as events; it can submit them itself or
+// leave that to the caller.
+package miner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"Powerc20Worker/abi"
+
+	gethabi "github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// MineSelector is the 4-byte selector of mine(uint256).
+var MineSelector = crypto.Keccak256([]byte("mine(uint256)"))[:4]
+
+// expectedSelectors are the PoWERC20 functions the miner relies on.
+var expectedSelectors = []string{"challenge", "difficulty", "mine", "minedNonces", "miningTimes"}
+
+// Job is the unit of work read from a contract: the challenge to solve and
+// the target a hash has to be below.
+type Job struct {
+	Challenge  *big.Int
+	Difficulty *big.Int
+	// RawTarget is set by schemes whose contract publishes the target
+	// directly instead of a difficulty.
+	RawTarget *big.Int
+}
+
+// Scheme describes how a family of proof-of-work token contracts is mined:
+// where the job comes from, what is hashed, what the hash is compared with
+// and how a solution is submitted.
+type Scheme interface {
+	// Name identifies the scheme in logs and configuration.
+	Name() string
+	// FetchJob reads the current challenge and difficulty for sender.
+	FetchJob(ctx context.Context, caller bind.ContractCaller, contract, sender common.Address) (*Job, error)
+	// Preimage returns the bytes whose keccak256 hash must be below the
+	// target for nonce to be a solution.
+	Preimage(job *Job, sender common.Address, nonce *big.Int) []byte
+	// Target returns the value a solution hash has to be strictly below.
+	Target(job *Job) *big.Int
+	// SubmitData returns the calldata submitting nonce, whose preimage
+	// hashes to digest.
+	SubmitData(job *Job, nonce *big.Int, digest common.Hash) ([]byte, error)
+	// Methods returns the contract functions the scheme relies on.
+	Methods() []gethabi.Method
+}
+
+// BitsTarget is the PoWERC20 target formula, 1 << (256 - difficulty).
+func BitsTarget(difficulty *big.Int) *big.Int {
+	if difficulty.Sign() <= 0 || difficulty.Cmp(big.NewInt(256)) > 0 {
+		return new(big.Int)
+	}
+	return new(big.Int).Lsh(big.NewInt(1), 256-uint(difficulty.Uint64()))
+}
+
+// PoWERC20Scheme mines the PoWERC20 contract through its generated binding.
+type PoWERC20Scheme struct {
+	abi *gethabi.ABI
+}
+
+func NewPoWERC20Scheme() (*PoWERC20Scheme, error) {
+	parsed, err := abi.PoWERC20MetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	return &PoWERC20Scheme{abi: parsed}, nil
+}
+
+func (s *PoWERC20Scheme) Name() string { return "powerc20" }
+
+func (s *PoWERC20Scheme) FetchJob(ctx context.Context, caller bind.ContractCaller, contract, sender common.Address) (*Job, error) {
+	c, err := abi.NewPoWERC20Caller(contract, caller)
+	if err != nil {
+		return nil, err
+	}
+	opts := &bind.CallOpts{Context: ctx, From: sender}
+	challenge, err := c.Challenge(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get challenge: %v", err)
+	}
+	difficulty, err := c.Difficulty(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get difficulty: %v", err)
+	}
+	return &Job{Challenge: challenge, Difficulty: difficulty}, nil
+}
+
+// Preimage mirrors keccak256(abi.encodePacked(challenge, msg.sender, nonce)).
+func (s *PoWERC20Scheme) Preimage(job *Job, sender common.Address, nonce *big.Int) []byte {
+	data := make([]byte, 0, 84)
+	data = append(data, common.LeftPadBytes(job.Challenge.Bytes(), 32)...)
+	data = append(data, sender.Bytes()...)
+	return append(data, common.LeftPadBytes(nonce.Bytes(), 32)...)
+}
+
+func (s *PoWERC20Scheme) Target(job *Job) *big.Int {
+	return BitsTarget(job.Difficulty)
+}
+
+func (s *PoWERC20Scheme) SubmitData(job *Job, nonce *big.Int, digest common.Hash) ([]byte, error) {
+	return s.abi.Pack("mine", nonce)
+}
+
+func (s *PoWERC20Scheme) Methods() []gethabi.Method {
+	methods := make([]gethabi.Method, 0, len(expectedSelectors))
+	for _, name := range expectedSelectors {
+		methods = append(methods, s.abi.Methods[name])
+	}
+	return methods
+}
+
+// SchemeConfig describes a contract family in terms of its ABI so that
+// variants can be mined without code changes.
+type SchemeConfig struct {
+	Name string `json:"name"`
+	// ABI holds the JSON ABI of at least the methods referenced below.
+	ABI json.RawMessage `json:"abi"`
+	// Challenge and Difficulty name view methods without arguments, or
+	// with a single address argument that receives the sender.
+	Challenge  string `json:"challenge"`
+	Difficulty string `json:"difficulty,omitempty"`
+	// Target names a view method returning the raw target; required when
+	// TargetMode is "raw".
+	Target string `json:"target,omitempty"`
+	// TargetMode is "bits" for 1 << (256 - difficulty), "quotient" for
+	// (2^256 - 1) / difficulty or "raw" for the value of Target.
+	TargetMode string `json:"targetMode"`
+	// Preimage lists the packed fields in order: "challenge" (32 bytes),
+	// "sender" (20 bytes), "sender32" (sender left-padded to 32 bytes) and
+	// "nonce" (32 bytes).
+	Preimage []string `json:"preimage"`
+	// Submit names the method called with a solution and SubmitArgs its
+	// arguments, each one of "nonce", "digest" or "challenge".
+	Submit     string   `json:"submit"`
+	SubmitArgs []string `json:"submitArgs"`
+}
+
+// EIP918Config mines EIP-918 tokens such as 0xBitcoin, which publish a raw
+// target and take the digest alongside the nonce in mint().
+var EIP918Config = SchemeConfig{
+	Name: "eip918",
+	ABI: json.RawMessage(`[
+		{"type":"function","name":"getChallengeNumber","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"bytes32"}]},
+		{"type":"function","name":"getMiningDifficulty","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint256"}]},
+		{"type":"function","name":"getMiningTarget","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint256"}]},
+		{"type":"function","name":"mint","stateMutability":"nonpayable","inputs":[{"name":"nonce","type":"uint256"},{"name":"challenge_digest","type":"bytes32"}],"outputs":[{"name":"success","type":"bool"}]}
+	]`),
+	Challenge:  "getChallengeNumber",
+	Difficulty: "getMiningDifficulty",
+	Target:     "getMiningTarget",
+	TargetMode: "raw",
+	Preimage:   []string{"challenge", "sender", "nonce"},
+	Submit:     "mint",
+	SubmitArgs: []string{"nonce", "digest"},
+}
+
+// ABIScheme is a Scheme driven entirely by a SchemeConfig.
+type ABIScheme struct {
+	cfg SchemeConfig
+	abi gethabi.ABI
+}
+
+func NewABIScheme(cfg SchemeConfig) (*ABIScheme, error) {
+	parsed, err := gethabi.JSON(strings.NewReader(string(cfg.ABI)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ABI: %v", err)
+	}
+	s := &ABIScheme{cfg: cfg, abi: parsed}
+	for _, name := range []string{cfg.Challenge, cfg.Difficulty, cfg.Target, cfg.Submit} {
+		if _, ok := parsed.Methods[name]; name != "" && !ok {
+			return nil, fmt.Errorf("method %q is not in the ABI", name)
+		}
+	}
+	if cfg.Challenge == "" || cfg.Submit == "" {
+		return nil, errors.New("challenge and submit methods are required")
+	}
+	switch cfg.TargetMode {
+	case "bits", "quotient":
+		if cfg.Difficulty == "" {
+			return nil, fmt.Errorf("target mode %q needs a difficulty method", cfg.TargetMode)
+		}
+	case "raw":
+		if cfg.Target == "" {
+			return nil, errors.New(`target mode "raw" needs a target method`)
+		}
+	default:
+		return nil, fmt.Errorf("unknown target mode %q", cfg.TargetMode)
+	}
+	for _, field := range cfg.Preimage {
+		switch field {
+		case "challenge", "sender", "sender32", "nonce":
+		default:
+			return nil, fmt.Errorf("unknown preimage field %q", field)
+		}
+	}
+	if len(parsed.Methods[cfg.Submit].Inputs) != len(cfg.SubmitArgs) {
+		return nil, fmt.Errorf("submit method %q takes %d arguments, %d configured", cfg.Submit, len(parsed.Methods[cfg.Submit].Inputs), len(cfg.SubmitArgs))
+	}
+	for _, arg := range cfg.SubmitArgs {
+		switch arg {
+		case "nonce", "digest", "challenge":
+		default:
+			return nil, fmt.Errorf("unknown submit argument %q", arg)
+		}
+	}
+	return s, nil
+}
+
+func (s *ABIScheme) Name() string { return s.cfg.Name }
+
+// Config returns the configuration the scheme was built from.
+func (s *ABIScheme) Config() SchemeConfig { return s.cfg }
+
+// callUint calls a view method and returns its single result as an integer;
+// bytes32 results are interpreted big-endian.
+func (s *ABIScheme) callUint(ctx context.Context, contract *bind.BoundContract, sender common.Address, method string) (*big.Int, error) {
+	var params []interface{}
+	if inputs := s.abi.Methods[method].Inputs; len(inputs) == 1 && inputs[0].Type.T == gethabi.AddressTy {
+		params = append(params, sender)
+	}
+	var out []interface{}
+	if err := contract.Call(&bind.CallOpts{Context: ctx, From: sender}, &out, method, params...); err != nil {
+		return nil, fmt.Errorf("failed to call %s: %v", method, err)
+	}
+	if len(out) != 1 {
+		return nil, fmt.Errorf("%s returned %d values, expected 1", method, len(out))
+	}
+	switch v := out[0].(type) {
+	case *big.Int:
+		return v, nil
+	case [32]byte:
+		return new(big.Int).SetBytes(v[:]), nil
+	default:
+		return nil, fmt.Errorf("%s returned unsupported type %T", method, out[0])
+	}
+}
+
+func (s *ABIScheme) FetchJob(ctx context.Context, caller bind.ContractCaller, contractAddr, sender common.Address) (*Job, error) {
+	contract := bind.NewBoundContract(contractAddr, s.abi, caller, nil, nil)
+	job := new(Job)
+	var err error
+	if job.Challenge, err = s.callUint(ctx, contract, sender, s.cfg.Challenge); err != nil {
+		return nil, err
+	}
+	if s.cfg.Difficulty != "" {
+		if job.Difficulty, err = s.callUint(ctx, contract, sender, s.cfg.Difficulty); err != nil {
+			return nil, err
+		}
+	}
+	if s.cfg.Target != "" {
+		if job.RawTarget, err = s.callUint(ctx, contract, sender, s.cfg.Target); err != nil {
+			return nil, err
+		}
+	}
+	if job.Difficulty == nil {
+		job.Difficulty = new(big.Int)
+	}
+	return job, nil
+}
+
+func (s *ABIScheme) Preimage(job *Job, sender common.Address, nonce *big.Int) []byte {
+	data := make([]byte, 0, 32*len(s.cfg.Preimage))
+	for _, field := range s.cfg.Preimage {
+		switch field {
+		case "challenge":
+			data = append(data, common.LeftPadBytes(job.Challenge.Bytes(), 32)...)
+		case "sender":
+			data = append(data, sender.Bytes()...)
+		case "sender32":
+			data = append(data, common.LeftPadBytes(sender.Bytes(), 32)...)
+		case "nonce":
+			data = append(data, common.LeftPadBytes(nonce.Bytes(), 32)...)
+		}
+	}
+	return data
+}
+
+func (s *ABIScheme) Target(job *Job) *big.Int {
+	switch s.cfg.TargetMode {
+	case "raw":
+		if job.RawTarget == nil {
+			return new(big.Int)
+		}
+		return job.RawTarget
+	case "quotient":
+		if job.Difficulty.Sign() <= 0 {
+			return new(big.Int)
+		}
+		max := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+		return max.Quo(max, job.Difficulty)
+	default:
+		return BitsTarget(job.Difficulty)
+	}
+}
+
+func (s *ABIScheme) SubmitData(job *Job, nonce *big.Int, digest common.Hash) ([]byte, error) {
+	method := s.abi.Methods[s.cfg.Submit]
+	args := make([]interface{}, len(s.cfg.SubmitArgs))
+	for i, arg := range s.cfg.SubmitArgs {
+		var word [32]byte
+		var value *big.Int
+		switch arg {
+		case "nonce":
+			value = nonce
+		case "challenge":
+			value = job.Challenge
+		case "digest":
+			value = digest.Big()
+		}
+		// Pass the value in the Go type the ABI packer expects for the
+		// declared input type.
+		if method.Inputs[i].Type.T == gethabi.FixedBytesTy {
+			value.FillBytes(word[:])
+			args[i] = word
+		} else {
+			args[i] = value
+		}
+	}
+	return s.abi.Pack(s.cfg.Submit, args...)
+}
+
+func (s *ABIScheme) Methods() []gethabi.Method {
+	var methods []gethabi.Method
+	for _, name := range []string{s.cfg.Challenge, s.cfg.Difficulty, s.cfg.Target, s.cfg.Submit} {
+		if name != "" {
+			methods = append(methods, s.abi.Methods[name])
+		}
+	}
+	return methods
+}
+
+// LoadScheme resolves a scheme by name: a built-in scheme, powerc20 or
+// eip918, or the path of a JSON SchemeConfig.
+func LoadScheme(name string) (Scheme, error) {
+	switch name {
+	case "", "powerc20":
+		return NewPoWERC20Scheme()
+	case "eip918":
+		return NewABIScheme(EIP918Config)
+	}
+	raw, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown scheme %q and no such config file", name)
+	}
+	var cfg SchemeConfig
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid scheme config %s: %v", name, err)
+	}
+	if cfg.Name == "" {
+		cfg.Name = name
+	}
+	return NewABIScheme(cfg)
+}
+
+// SolutionDigest is the hash of the preimage a solution is checked against.
+func SolutionDigest(scheme Scheme, job *Job, sender common.Address, nonce *big.Int) common.Hash {
+	return crypto.Keccak256Hash(scheme.Preimage(job, sender, nonce))
+}
+
+// SubmitSelector returns the selector of the call scheme uses to submit
+// solutions.
+func SubmitSelector(scheme Scheme) []byte {
+	data, err := scheme.SubmitData(&Job{Challenge: new(big.Int), Difficulty: new(big.Int)}, new(big.Int), common.Hash{})
+	if err != nil || len(data) < 4 {
+		return MineSelector
+	}
+	return data[:4]
+}
+
+// LimitChecker is implemented by schemes whose contracts cap the total
+// supply or the number of mints per account.
+type LimitChecker interface {
+	// Exhausted returns a non-empty reason when sender can no longer mint
+	// from contract.
+	Exhausted(ctx context.Context, caller bind.ContractCaller, contract, sender common.Address) (string, error)
+}
+
+// RewardReader is implemented by schemes that can tell how many token base
+// units a successful mint pays.
+type RewardReader interface {
+	Reward(ctx context.Context, caller bind.ContractCaller, contract common.Address) (*big.Int, error)
+}
+
+// NonceChecker is implemented by schemes whose contracts remember which
+// nonces an account already used.
+type NonceChecker interface {
+	NonceUsed(ctx context.Context, caller bind.ContractCaller, contract, sender common.Address, nonce *big.Int) (bool, error)
+}
+
+func (s *PoWERC20Scheme) Exhausted(ctx context.Context, caller bind.ContractCaller, contract, sender common.Address) (string, error) {
+	c, err := abi.NewPoWERC20Caller(contract, caller)
+	if err != nil {
+		return "", err
+	}
+	opts := &bind.CallOpts{Context: ctx, From: sender}
+	remaining, err := c.GetRemainingSupply(opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to get remaining supply: %v", err)
+	}
+	perMint, err := c.LimitPerMint(opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to get limit per mint: %v", err)
+	}
+	if remaining.Sign() == 0 || remaining.Cmp(perMint) < 0 {
+		return "supply exhausted", nil
+	}
+	limit, err := c.MiningLimit(opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to get mining limit: %v", err)
+	}
+	times, err := c.MiningTimes(opts, sender)
+	if err != nil {
+		return "", fmt.Errorf("failed to get mining times: %v", err)
+	}
+	if limit.Sign() > 0 && times.Cmp(limit) >= 0 {
+		return fmt.Sprintf("mining limit of %v reached", limit), nil
+	}
+	return "", nil
+}
+
+func (s *PoWERC20Scheme) Reward(ctx context.Context, caller bind.ContractCaller, contract common.Address) (*big.Int, error) {
+	c, err := abi.NewPoWERC20Caller(contract, caller)
+	if err != nil {
+		return nil, err
+	}
+	return c.LimitPerMint(&bind.CallOpts{Context: ctx})
+}
+
+func (s *PoWERC20Scheme) NonceUsed(ctx context.Context, caller bind.ContractCaller, contract, sender common.Address, nonce *big.Int) (bool, error) {
+	c, err := abi.NewPoWERC20Caller(contract, caller)
+	if err != nil {
+		return false, err
+	}
+	return c.MinedNonces(&bind.CallOpts{Context: ctx, From: sender}, sender, nonce)
+}
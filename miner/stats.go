@@ -0,0 +1,93 @@
+package miner
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// hashStats counts hashes per worker and turns the counts into hash rates
+// once per sample.
+type hashStats struct {
+	mu       sync.RWMutex
+	counts   []atomic.Uint64
+	active   int // workers currently running
+	last     []uint64
+	rates    []float64 // per worker, hashes per second
+	total    float64
+	lastTick time.Time
+}
+
+func newHashStats(workers int) *hashStats {
+	s := &hashStats{lastTick: time.Now()}
+	s.resize(workers)
+	return s
+}
+
+// resize sets the number of running workers. Counters are only ever added
+// so that the total survives a smaller pool.
+func (s *hashStats) resize(workers int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if workers > len(s.counts) {
+		counts := make([]atomic.Uint64, workers)
+		for i := range s.counts {
+			counts[i].Store(s.counts[i].Load())
+		}
+		s.counts = counts
+		s.last = append(s.last, make([]uint64, workers-len(s.last))...)
+		s.rates = append(s.rates, make([]float64, workers-len(s.rates))...)
+	}
+	s.active = workers
+}
+
+// add records n hashes done by worker id.
+func (s *hashStats) add(id int, n uint64) {
+	s.mu.RLock()
+	s.counts[id].Add(n)
+	s.mu.RUnlock()
+}
+
+// Total returns the number of hashes done since start.
+func (s *hashStats) Total() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var total uint64
+	for i := range s.counts {
+		total += s.counts[i].Load()
+	}
+	return total
+}
+
+// sample updates the rates from the hashes done since the previous call.
+func (s *hashStats) sample(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elapsed := now.Sub(s.lastTick).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	s.total = 0
+	for i := range s.counts {
+		count := s.counts[i].Load()
+		s.rates[i] = float64(count-s.last[i]) / elapsed
+		s.last[i] = count
+		s.total += s.rates[i]
+	}
+	s.lastTick = now
+}
+
+// Rate returns the total hash rate at the last sample.
+func (s *hashStats) Rate() float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.total
+}
+
+// WorkerRates returns the hash rates of the running workers at the last
+// sample.
+func (s *hashStats) WorkerRates() []float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]float64(nil), s.rates[:s.active]...)
+}
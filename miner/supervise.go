@@ -0,0 +1,189 @@
+package miner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Supervision configures how the Miner restarts workers that fail. The
+// zero value uses the defaults.
+type Supervision struct {
+	// Backoff is how long a failed worker waits before it restarts; it
+	// doubles with every failure in a row up to MaxBackoff. They default
+	// to 1s and 1m.
+	Backoff, MaxBackoff time.Duration
+	// MaxFailures failures of any workers within Window stop mining with
+	// an ErrorEvent. They default to 10 in 10m.
+	MaxFailures int
+	Window      time.Duration
+}
+
+func (s Supervision) withDefaults() Supervision {
+	if s.Backoff <= 0 {
+		s.Backoff = time.Second
+	}
+	if s.MaxBackoff < s.Backoff {
+		s.MaxBackoff = max(time.Minute, s.Backoff)
+	}
+	if s.MaxFailures <= 0 {
+		s.MaxFailures = 10
+	}
+	if s.Window <= 0 {
+		s.Window = 10 * time.Minute
+	}
+	return s
+}
+
+// ErrTooManyFailures is wrapped by the ErrorEvent sent when workers fail
+// more often than Supervision allows.
+var ErrTooManyFailures = errors.New("workers failed too often")
+
+// PanicError is a panic recovered from a worker.
+type PanicError struct {
+	Worker int
+	Value  interface{}
+	Stack  []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("worker %d panicked: %v", e.Worker, e.Value)
+}
+
+// fatalError marks an error that restarting the worker cannot fix.
+type fatalError struct{ err error }
+
+func (e *fatalError) Error() string { return e.err.Error() }
+func (e *fatalError) Unwrap() error { return e.err }
+
+// Fatal marks err as one that restarting cannot fix: a worker failing
+// with it stops mining at once instead of being restarted.
+func Fatal(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &fatalError{err}
+}
+
+// IsFatal reports whether err was marked with Fatal.
+func IsFatal(err error) bool {
+	var f *fatalError
+	return errors.As(err, &f)
+}
+
+// supervisor keeps track of worker failures and stops every worker once
+// they fail too often.
+type supervisor struct {
+	opts     Supervision
+	ctx      context.Context
+	halt     context.CancelFunc
+	once     sync.Once
+	restarts atomic.Uint64
+	// after waits out a backoff; it is time.After outside of tests.
+	after func(d time.Duration) <-chan time.Time
+
+	mu       sync.Mutex
+	failures []time.Time
+}
+
+func newSupervisor(opts Supervision) *supervisor {
+	return &supervisor{opts: opts.withDefaults(), after: time.After}
+}
+
+// start returns the context workers run in; it is cancelled when they
+// are halted.
+func (s *supervisor) start(ctx context.Context) context.Context {
+	s.ctx = ctx
+	ctx, s.halt = context.WithCancel(ctx)
+	return ctx
+}
+
+// failed records a failure at now and reports how many happened within
+// the window.
+func (s *supervisor) failed(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, now)
+	recent := s.failures[:0]
+	for _, t := range s.failures {
+		if now.Sub(t) < s.opts.Window {
+			recent = append(recent, t)
+		}
+	}
+	s.failures = recent
+	return len(recent)
+}
+
+// call runs fn and returns a panic in it as a *PanicError.
+func call(id int, fn func() error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &PanicError{Worker: id, Value: v, Stack: debug.Stack()}
+		}
+	}()
+	return fn()
+}
+
+// supervise runs worker id until ctx is done, restarting it with backoff
+// when it fails. A fatal error, or failures more frequent than
+// Options.Supervision allows, stop every worker.
+func (m *Miner) supervise(ctx context.Context, id int) {
+	sup := m.sup
+	backoff := sup.opts.Backoff
+	for {
+		started := time.Now()
+		err := call(id, func() error { return m.worker(ctx, id) })
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		log := m.log.WithFields(logrus.Fields{"event": "worker_failed", "worker": id})
+		var p *PanicError
+		if errors.As(err, &p) {
+			log.Errorf("Worker %d panicked: %v\n%s", id, p.Value, p.Stack)
+		} else {
+			log.Errorf("Worker %d failed: %v", id, err)
+		}
+		if m.opts.Hooks.OnWorkerFailed != nil {
+			m.opts.Hooks.OnWorkerFailed(id, err)
+		}
+		m.emit(Event{Type: WorkerFailedEvent, Worker: id, Err: err})
+
+		if IsFatal(err) {
+			m.halt(err)
+			return
+		}
+		if n := sup.failed(time.Now()); n >= sup.opts.MaxFailures {
+			m.halt(fmt.Errorf("%w: %d failures within %s, the last: %v", ErrTooManyFailures, n, sup.opts.Window, err))
+			return
+		}
+		// A worker that ran for a while before failing starts over with
+		// the shortest delay.
+		if time.Since(started) > sup.opts.MaxBackoff {
+			backoff = sup.opts.Backoff
+		}
+		log.Infof("Restarting worker %d in %s", id, backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-sup.after(backoff):
+		}
+		backoff = min(2*backoff, sup.opts.MaxBackoff)
+		sup.restarts.Add(1)
+	}
+}
+
+// halt stops every worker after an error they cannot recover from and
+// reports it once as an ErrorEvent. The watchers keep running until Stop.
+func (m *Miner) halt(err error) {
+	m.sup.once.Do(func() {
+		m.sup.halt()
+		m.log.WithField("event", "workers_halted").Errorf("Stopped mining: %v", err)
+		m.fail(m.sup.ctx, err)
+	})
+}
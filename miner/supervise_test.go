@@ -0,0 +1,186 @@
+package miner
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/sirupsen/logrus"
+)
+
+// nopBackend satisfies Backend for miners whose workers never reach the
+// node.
+type nopBackend struct{ Backend }
+
+// testMiner returns a Miner whose workers run worker, and the backoffs
+// supervise waits, which return at once.
+func testMiner(t *testing.T, sup Supervision, worker func(ctx context.Context, id int) error) (*Miner, *[]time.Duration) {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	m, err := New(Options{
+		Backend:     nopBackend{},
+		Contracts:   []ContractSpec{{Address: common.HexToAddress("0x01")}},
+		Supervision: sup,
+		Logger:      logrus.NewEntry(logger),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.worker = worker
+	var (
+		mu     sync.Mutex
+		delays []time.Duration
+	)
+	m.sup.after = func(d time.Duration) <-chan time.Time {
+		mu.Lock()
+		delays = append(delays, d)
+		mu.Unlock()
+		ch := make(chan time.Time, 1)
+		ch <- time.Now()
+		return ch
+	}
+	return m, &delays
+}
+
+// events returns the events sent so far.
+func events(m *Miner) []Event {
+	var evs []Event
+	for {
+		select {
+		case ev := <-m.events:
+			evs = append(evs, ev)
+		default:
+			return evs
+		}
+	}
+}
+
+func TestSuperviseRecoversPanic(t *testing.T) {
+	var calls atomic.Int32
+	var hooked error
+	m, _ := testMiner(t, Supervision{}, func(ctx context.Context, id int) error {
+		if calls.Add(1) == 1 {
+			panic("boom")
+		}
+		return nil
+	})
+	m.opts.Hooks.OnWorkerFailed = func(id int, err error) { hooked = err }
+	m.supervise(m.sup.start(context.Background()), 3)
+
+	evs := events(m)
+	if len(evs) != 1 || evs[0].Type != WorkerFailedEvent || evs[0].Worker != 3 {
+		t.Fatalf("events %+v, want one worker_failed for worker 3", evs)
+	}
+	var p *PanicError
+	if !errors.As(evs[0].Err, &p) {
+		t.Fatalf("error %v is not a *PanicError", evs[0].Err)
+	}
+	if p.Worker != 3 || p.Value != "boom" || !strings.Contains(string(p.Stack), "supervise_test.go") {
+		t.Fatalf("panic error %+v lacks the worker, value or stack", p)
+	}
+	if hooked != evs[0].Err {
+		t.Errorf("OnWorkerFailed got %v", hooked)
+	}
+	if calls.Load() != 2 || m.sup.restarts.Load() != 1 {
+		t.Errorf("worker ran %d times with %d restarts, want 2 and 1", calls.Load(), m.sup.restarts.Load())
+	}
+}
+
+func TestSuperviseBackoff(t *testing.T) {
+	var calls atomic.Int32
+	m, delays := testMiner(t, Supervision{Backoff: time.Second, MaxBackoff: 4 * time.Second, MaxFailures: 100}, func(ctx context.Context, id int) error {
+		if calls.Add(1) <= 6 {
+			return errors.New("node unreachable")
+		}
+		return nil
+	})
+	m.supervise(m.sup.start(context.Background()), 0)
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second, 4 * time.Second, 4 * time.Second}
+	if len(*delays) != len(want) {
+		t.Fatalf("backoffs %v, want %v", *delays, want)
+	}
+	for i := range want {
+		if (*delays)[i] != want[i] {
+			t.Fatalf("backoffs %v, want %v", *delays, want)
+		}
+	}
+	for _, ev := range events(m) {
+		if ev.Type == ErrorEvent {
+			t.Fatalf("mining stopped below the failure threshold: %v", ev.Err)
+		}
+	}
+}
+
+func TestSuperviseFatal(t *testing.T) {
+	cause := errors.New("no entropy")
+	var calls atomic.Int32
+	m, delays := testMiner(t, Supervision{}, func(ctx context.Context, id int) error {
+		calls.Add(1)
+		return Fatal(cause)
+	})
+	ctx := m.sup.start(context.Background())
+	m.supervise(ctx, 0)
+
+	if calls.Load() != 1 || len(*delays) != 0 {
+		t.Fatalf("fatal error retried: %d calls, backoffs %v", calls.Load(), *delays)
+	}
+	if ctx.Err() == nil {
+		t.Fatal("workers not halted")
+	}
+	var halted []error
+	for _, ev := range events(m) {
+		if ev.Type == ErrorEvent {
+			halted = append(halted, ev.Err)
+		}
+	}
+	if len(halted) != 1 || !IsFatal(halted[0]) || !errors.Is(halted[0], cause) {
+		t.Fatalf("error events %v, want one fatal %v", halted, cause)
+	}
+}
+
+func TestSuperviseTooManyFailures(t *testing.T) {
+	m, _ := testMiner(t, Supervision{MaxFailures: 5, Window: time.Hour}, func(ctx context.Context, id int) error {
+		return errors.New("bad job")
+	})
+	ctx := m.sup.start(context.Background())
+	var wg sync.WaitGroup
+	for id := 0; id < 4; id++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			m.supervise(ctx, id)
+		}(id)
+	}
+	wg.Wait()
+
+	var halted []error
+	for _, ev := range events(m) {
+		if ev.Type == ErrorEvent {
+			halted = append(halted, ev.Err)
+		}
+	}
+	if len(halted) != 1 || !errors.Is(halted[0], ErrTooManyFailures) {
+		t.Fatalf("error events %v, want exactly one ErrTooManyFailures", halted)
+	}
+}
+
+func TestSupervisorWindow(t *testing.T) {
+	s := newSupervisor(Supervision{Window: time.Minute})
+	now := time.Unix(1700000000, 0)
+	s.failed(now)
+	s.failed(now.Add(30 * time.Second))
+	if n := s.failed(now.Add(50 * time.Second)); n != 3 {
+		t.Fatalf("%d failures within the window, want 3", n)
+	}
+	// The first two fall out of the window.
+	if n := s.failed(now.Add(90 * time.Second)); n != 2 {
+		t.Fatalf("%d failures within the window, want 2", n)
+	}
+}
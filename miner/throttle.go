@@ -0,0 +1,195 @@
+package miner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// defaultThrottlePeriod is the duty-cycle period used to hold a CPU budget
+// when no explicit one is set.
+const defaultThrottlePeriod = 100 * time.Millisecond
+
+// Throttle limits how much CPU the workers take. The zero value hashes
+// all the time.
+type Throttle struct {
+	// Cores caps the CPU time of all workers together, in cores. Workers
+	// take turns so that about that many are hashing at any moment.
+	Cores float64
+	// On and Period make every worker hash On out of every Period, all at
+	// the same time, leaving the CPUs idle for the rest.
+	On, Period time.Duration
+	// Windows are the times of day hashing is allowed in; none means any
+	// time. Outside them workers wait without losing their job.
+	Windows []Window
+}
+
+// Window is a daily time range in local time. End before Start wraps
+// around midnight, so 22:00-07:00 covers the night.
+type Window struct {
+	Start, End time.Duration // since midnight
+}
+
+// ParseWindows parses comma-separated HH:MM-HH:MM ranges.
+func ParseWindows(s string) ([]Window, error) {
+	var windows []Window
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid window %q, expected HH:MM-HH:MM", part)
+		}
+		start, err := parseClock(from)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClock(to)
+		if err != nil {
+			return nil, err
+		}
+		if start == end {
+			return nil, fmt.Errorf("window %q is empty", part)
+		}
+		windows = append(windows, Window{Start: start, End: end})
+	}
+	return windows, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func (w Window) String() string {
+	clock := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return clock(w.Start) + "-" + clock(w.End)
+}
+
+// Contains reports whether t falls in the window. It goes by the wall
+// clock, so on days with a daylight saving change 07:00 is still 07:00 and
+// not seven hours after midnight.
+func (w Window) Contains(t time.Time) bool {
+	since := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if w.Start < w.End {
+		return since >= w.Start && since < w.End
+	}
+	return since >= w.Start || since < w.End
+}
+
+// InWindow reports whether hashing is allowed at t.
+func (t Throttle) InWindow(now time.Time) bool {
+	if len(t.Windows) == 0 {
+		return true
+	}
+	for _, w := range t.Windows {
+		if w.Contains(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// String describes the throttle, empty when there is none.
+func (t Throttle) String() string {
+	var parts []string
+	if t.Cores > 0 {
+		parts = append(parts, fmt.Sprintf("%.2f cores", t.Cores))
+	}
+	if t.Period > 0 {
+		parts = append(parts, fmt.Sprintf("%s of every %s", t.On, t.Period))
+	}
+	if len(t.Windows) > 0 {
+		parts = append(parts, t.windows()+" only")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// windows lists the windows as they are written on the command line.
+func (t Throttle) windows() string {
+	windows := make([]string, len(t.Windows))
+	for i, w := range t.Windows {
+		windows[i] = w.String()
+	}
+	return strings.Join(windows, ",")
+}
+
+// pause returns how long worker id of workers should wait before its next
+// batch, zero to hash now.
+func (t Throttle) pause(now time.Time, id, workers int) time.Duration {
+	if !t.InWindow(now) {
+		// Checked again every second so that a changed throttle applies.
+		return time.Second
+	}
+	share, period := 1.0, t.Period
+	if period > 0 {
+		share = float64(t.On) / float64(period)
+	}
+	var offset time.Duration
+	if t.Cores > 0 && workers > 0 && t.Cores/float64(workers) < share {
+		share = t.Cores / float64(workers)
+		if period <= 0 {
+			period = defaultThrottlePeriod
+		}
+		// Without an explicit duty cycle workers take turns.
+		if t.Period <= 0 {
+			offset = period * time.Duration(id) / time.Duration(workers)
+		}
+	}
+	if share >= 1 {
+		return 0
+	}
+	phase := time.Duration(now.UnixNano()+int64(offset)) % period
+	if phase < time.Duration(share*float64(period)) {
+		return 0
+	}
+	return period - phase
+}
+
+// SetThrottle changes how much CPU the workers take.
+func (m *Miner) SetThrottle(t Throttle) {
+	m.throttle.Store(&t)
+}
+
+// Throttle returns the current throttle.
+func (m *Miner) Throttle() Throttle {
+	if t := m.throttle.Load(); t != nil {
+		return *t
+	}
+	return Throttle{}
+}
+
+// InWindow reports whether the throttle allows hashing at this time of
+// day.
+func (m *Miner) InWindow() bool {
+	return m.Throttle().InWindow(time.Now())
+}
+
+// throttled makes worker id wait while the throttle holds it back. It
+// returns false when ctx is done.
+func (m *Miner) throttled(ctx context.Context, id int) bool {
+	t := m.throttle.Load()
+	if t == nil {
+		return true
+	}
+	for {
+		d := t.pause(time.Now(), id, m.sched.size())
+		if d <= 0 {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(d):
+		}
+		t = m.throttle.Load()
+	}
+}
@@ -0,0 +1,226 @@
+package miner
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/sirupsen/logrus"
+)
+
+func TestWindowContainsDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2024, month, day, hour, min, 0, 0, loc)
+	}
+	parse := func(s string) Window {
+		windows, err := ParseWindows(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return windows[0]
+	}
+	for _, c := range []struct {
+		window string
+		t      time.Time
+		want   bool
+	}{
+		// 10 March 2024 skips 02:00-03:00, so 07:30 is 6h30 after
+		// midnight and 08:30 is 7h30 after it.
+		{"22:00-07:00", at(time.March, 10, 7, 30), false},
+		{"22:00-07:00", at(time.March, 10, 6, 59), true},
+		{"08:00-17:00", at(time.March, 10, 8, 30), true},
+		{"08:00-17:00", at(time.March, 10, 7, 59), false},
+		// 3 November 2024 repeats 01:00-02:00, so 07:30 is 8h30 after
+		// midnight.
+		{"22:00-08:00", at(time.November, 3, 7, 30), true},
+		{"22:00-08:00", at(time.November, 3, 8, 0), false},
+		{"08:00-17:00", at(time.November, 3, 16, 59), true},
+		{"08:00-17:00", at(time.November, 3, 17, 0), false},
+		// An ordinary day for comparison.
+		{"22:00-07:00", at(time.June, 1, 23, 0), true},
+		{"22:00-07:00", at(time.June, 1, 12, 0), false},
+	} {
+		if got := parse(c.window).Contains(c.t); got != c.want {
+			t.Errorf("%s contains %s: %v, want %v", c.window, c.t.Format(time.RFC3339), got, c.want)
+		}
+	}
+}
+
+func TestParseWindows(t *testing.T) {
+	windows, err := ParseWindows(" 22:00-07:00, 12:00-13:30 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Window{{22 * time.Hour, 7 * time.Hour}, {12 * time.Hour, 13*time.Hour + 30*time.Minute}}
+	if len(windows) != len(want) || windows[0] != want[0] || windows[1] != want[1] {
+		t.Errorf("parsed %v, want %v", windows, want)
+	}
+	if windows, err := ParseWindows(""); err != nil || len(windows) != 0 {
+		t.Errorf("empty schedule parsed to %v, %v", windows, err)
+	}
+
+	for s, want := range map[string]string{
+		"22:00":             "expected HH:MM-HH:MM",
+		"07:00-07:00":       "is empty",
+		"12:00-13:00,09:30": "expected HH:MM-HH:MM",
+		"25:00-07:00":       "invalid time of day",
+		"22:00-07:60":       "invalid time of day",
+		"10pm-7am":          "invalid time of day",
+		"22:00-":            "invalid time of day",
+	} {
+		if _, err := ParseWindows(s); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: got %v, want an error containing %q", s, err, want)
+		}
+	}
+}
+
+// at is a time phase into a period of the Unix clock.
+func at(phase time.Duration) time.Time {
+	return time.Unix(1_700_000_000, 0).Add(phase)
+}
+
+func TestThrottleDutyCycle(t *testing.T) {
+	th := Throttle{On: 300 * time.Millisecond, Period: time.Second}
+	for _, c := range []struct {
+		phase, want time.Duration
+	}{
+		{0, 0},
+		{299 * time.Millisecond, 0},
+		{300 * time.Millisecond, 700 * time.Millisecond},
+		{999 * time.Millisecond, time.Millisecond},
+	} {
+		// Every worker hashes in the same part of the period.
+		for id := 0; id < 4; id++ {
+			if got := th.pause(at(c.phase), id, 4); got != c.want {
+				t.Errorf("worker %d at %s: pause %s, want %s", id, c.phase, got, c.want)
+			}
+		}
+	}
+	if got := (Throttle{On: time.Second, Period: time.Second}).pause(at(500*time.Millisecond), 0, 1); got != 0 {
+		t.Errorf("full duty cycle pauses %s", got)
+	}
+}
+
+func TestThrottleCPUBudget(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		th      Throttle
+		workers int
+		hashing int           // workers hashing at any moment
+		each    time.Duration // time each worker hashes per period
+		period  time.Duration
+	}{
+		{"one of four cores", Throttle{Cores: 1}, 4, 1, 25 * time.Millisecond, defaultThrottlePeriod},
+		{"two of four cores", Throttle{Cores: 2}, 4, 2, 50 * time.Millisecond, defaultThrottlePeriod},
+		{"more cores than workers", Throttle{Cores: 8}, 4, 4, defaultThrottlePeriod, defaultThrottlePeriod},
+		// An explicit duty cycle keeps the workers in step, each at the
+		// smaller of the two shares.
+		{"budget below duty cycle", Throttle{Cores: 1, On: 500 * time.Millisecond, Period: time.Second}, 4, 4, 250 * time.Millisecond, time.Second},
+		{"duty cycle below budget", Throttle{Cores: 3, On: 500 * time.Millisecond, Period: time.Second}, 4, 4, 500 * time.Millisecond, time.Second},
+	} {
+		hashed := make([]time.Duration, c.workers)
+		for phase := time.Duration(0); phase < c.period; phase += time.Millisecond {
+			n := 0
+			for id := range hashed {
+				if c.th.pause(at(phase), id, c.workers) == 0 {
+					hashed[id] += time.Millisecond
+					n++
+				}
+			}
+			// With workers taking turns, the same number hashes at every
+			// moment; in step, all or none do.
+			if n != c.hashing && (c.th.Period == 0 || n != 0) {
+				t.Errorf("%s: %d workers hashing at %s, want %d", c.name, n, phase, c.hashing)
+				break
+			}
+		}
+		for id, d := range hashed {
+			if d != c.each {
+				t.Errorf("%s: worker %d hashed %s of every %s, want %s", c.name, id, d, c.period, c.each)
+			}
+		}
+	}
+}
+
+func TestWorkerKeepsJobAcrossWindows(t *testing.T) {
+	scheme, err := LoadScheme("powerc20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	m, err := New(Options{
+		Backend:   nopBackend{},
+		Scheme:    scheme,
+		Contracts: []ContractSpec{{Address: common.HexToAddress("0x01")}},
+		Workers:   1,
+		Logger:    logrus.NewEntry(logger),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	site := m.contracts[0]
+	// A job no nonce solves, and worker 0 on it.
+	job := &Job{Challenge: big.NewInt(1), Difficulty: big.NewInt(255)}
+	site.mu.Lock()
+	site.job, site.target = job, big.NewInt(1)
+	site.mu.Unlock()
+	m.sched.mu.Lock()
+	m.sched.assign[0] = 0
+	m.sched.mu.Unlock()
+
+	// A window that is closed now: it starts in two hours.
+	now := time.Now()
+	since := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute
+	closed := Throttle{Windows: []Window{{(since + 2*time.Hour) % (24 * time.Hour), (since + 3*time.Hour) % (24 * time.Hour)}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- m.work(ctx, 0) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("worker failed: %v", err)
+		}
+	}()
+	hashing := func() bool {
+		before := site.Hashes()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if site.Hashes() > before {
+				return true
+			}
+		}
+		return false
+	}
+	if !hashing() {
+		t.Fatal("worker is not hashing")
+	}
+
+	m.SetThrottle(closed)
+	// The batch under way finishes, then the worker waits.
+	time.Sleep(200 * time.Millisecond)
+	stalled := site.Hashes()
+	time.Sleep(300 * time.Millisecond)
+	if site.Hashes() != stalled {
+		t.Fatal("worker hashed outside the window")
+	}
+
+	m.SetThrottle(Throttle{})
+	if !hashing() {
+		t.Fatal("worker did not resume when the window opened")
+	}
+	if site.CurrentJob() != job || site.Exhausted() != "" {
+		t.Errorf("job %+v after the window reopened, want the one it had", site.CurrentJob())
+	}
+	if evs := events(m); len(evs) != 0 {
+		t.Errorf("events %+v while waiting for the window, want none", evs)
+	}
+}
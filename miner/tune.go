@@ -0,0 +1,175 @@
+package miner
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+// ErrNotHashing is returned by Tune when the miner has nothing to hash,
+// for example while it is paused, outside its windows or waiting for a job.
+var ErrNotHashing = errors.New("miner is not hashing")
+
+// TuneOptions controls a worker-count calibration.
+type TuneOptions struct {
+	// Max is the largest worker count tried (default AvailableCPUs).
+	Max int
+	// Step is how long each count is measured (default 2s).
+	Step time.Duration
+	// Tolerance is the fraction of the peak hashrate within which fewer
+	// workers are preferred (default 0.02).
+	Tolerance float64
+}
+
+// TuneResult is the outcome of a calibration.
+type TuneResult struct {
+	Workers int             // the chosen worker count
+	Rate    float64         // its hashes per second
+	Rates   map[int]float64 // every count tried
+}
+
+// Tune finds the worker count with the peak hashrate by mining the current
+// jobs at several counts: powers of two up to Max, then halving the gaps
+// around the best one. It leaves the miner at the chosen count, or at the
+// previous one when it fails.
+func (m *Miner) Tune(ctx context.Context, opts TuneOptions) (TuneResult, error) {
+	if opts.Max <= 0 {
+		opts.Max = AvailableCPUs()
+	}
+	if opts.Step <= 0 {
+		opts.Step = 2 * time.Second
+	}
+	if opts.Tolerance <= 0 {
+		opts.Tolerance = 0.02
+	}
+	previous := m.Workers()
+	res, err := tuneSearch(opts, func(n int) (float64, error) { return m.measure(ctx, n, opts.Step) })
+	if err != nil {
+		m.SetWorkers(previous)
+		return res, err
+	}
+	m.SetWorkers(res.Workers)
+	return res, nil
+}
+
+// tuneSearch measures worker counts with measure: powers of two up to
+// opts.Max, then the middle of the gaps around the best count until they
+// close.
+func tuneSearch(opts TuneOptions, measure func(n int) (float64, error)) (TuneResult, error) {
+	res := TuneResult{Rates: make(map[int]float64)}
+	try := func(n int) error {
+		if _, ok := res.Rates[n]; ok {
+			return nil
+		}
+		rate, err := measure(n)
+		if err != nil {
+			return err
+		}
+		res.Rates[n] = rate
+		return nil
+	}
+
+	var counts []int
+	for n := 1; n < opts.Max; n *= 2 {
+		counts = append(counts, n)
+	}
+	counts = append(counts, opts.Max)
+	for _, n := range counts {
+		if err := try(n); err != nil {
+			return res, err
+		}
+	}
+	// The peak lies between the neighbours of the best count; measure the
+	// middle of both gaps until they close.
+	for {
+		best := res.best(opts.Tolerance)
+		lo, hi := 0, opts.Max+1
+		for n := range res.Rates {
+			if n < best && n > lo {
+				lo = n
+			}
+			if n > best && n < hi {
+				hi = n
+			}
+		}
+		var next []int
+		if best-lo > 1 && lo > 0 {
+			next = append(next, (lo+best)/2)
+		}
+		if hi-best > 1 && hi <= opts.Max {
+			next = append(next, (best+hi)/2)
+		}
+		if len(next) == 0 {
+			break
+		}
+		for _, n := range next {
+			if err := try(n); err != nil {
+				return res, err
+			}
+		}
+	}
+	res.Workers = res.best(opts.Tolerance)
+	res.Rate = res.Rates[res.Workers]
+	return res, nil
+}
+
+// best returns the smallest count within tolerance of the peak rate.
+func (r *TuneResult) best(tolerance float64) int {
+	var counts []int
+	peak := 0.0
+	for n, rate := range r.Rates {
+		counts = append(counts, n)
+		peak = max(peak, rate)
+	}
+	sort.Ints(counts)
+	for _, n := range counts {
+		if r.Rates[n] >= peak*(1-tolerance) {
+			return n
+		}
+	}
+	return 0
+}
+
+// measure runs n workers and returns their hashes per second over d, once
+// they had a moment to pick up their assignment.
+func (m *Miner) measure(ctx context.Context, n int, d time.Duration) (float64, error) {
+	m.SetWorkers(n)
+	wait := func(d time.Duration) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(d):
+			return nil
+		}
+	}
+	if err := wait(250 * time.Millisecond); err != nil {
+		return 0, err
+	}
+	if !m.Busy() {
+		return 0, ErrNotHashing
+	}
+	start, before := time.Now(), m.stats.Total()
+	if err := wait(d); err != nil {
+		return 0, err
+	}
+	rate := float64(m.stats.Total()-before) / time.Since(start).Seconds()
+	// A job that ran out or a pause in between makes the rate meaningless.
+	if !m.Busy() || rate == 0 {
+		return 0, ErrNotHashing
+	}
+	return rate, nil
+}
+
+// Busy reports whether every worker has a contract to hash on and the
+// throttle's windows allow hashing.
+func (m *Miner) Busy() bool {
+	if m.Paused() || !m.InWindow() {
+		return false
+	}
+	assigned := 0
+	for _, n := range m.sched.workers() {
+		assigned += n
+	}
+	return assigned > 0 && assigned == m.Workers()
+}
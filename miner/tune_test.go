@@ -0,0 +1,85 @@
+package miner
+
+import (
+	"errors"
+	"sort"
+	"testing"
+)
+
+func TestTuneResultBest(t *testing.T) {
+	r := &TuneResult{Rates: map[int]float64{4: 1000, 8: 1015, 16: 1000}}
+	// 1000 is within 2% of the 1015 peak, so the smaller count wins.
+	if got := r.best(0.02); got != 4 {
+		t.Errorf("best with 2%% tolerance %d, want 4", got)
+	}
+	if got := r.best(0.001); got != 8 {
+		t.Errorf("best with 0.1%% tolerance %d, want 8", got)
+	}
+	if got := (&TuneResult{Rates: map[int]float64{}}).best(0.02); got != 0 {
+		t.Errorf("best of no rates %d, want 0", got)
+	}
+}
+
+func TestTuneSearch(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		max   int
+		rate  func(n int) float64
+		want  int
+		tried []int
+	}{
+		// Flat from 6 workers: the gaps around 8 are halved down to 6.
+		{"plateau", 16, func(n int) float64 { return float64(min(n, 6)) * 100 }, 6, []int{1, 2, 4, 5, 6, 7, 8, 12, 16}},
+		// Peaks at 10 and falls off with contention.
+		{"peak", 32, func(n int) float64 {
+			if n <= 10 {
+				return float64(n) * 100
+			}
+			return 1000 - float64(n-10)*50
+		}, 10, nil},
+		{"one cpu", 1, func(n int) float64 { return 100 }, 1, []int{1}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := tuneSearch(TuneOptions{Max: c.max, Tolerance: 0.02}, func(n int) (float64, error) {
+				if n < 1 || n > c.max {
+					t.Fatalf("measured %d workers outside 1-%d", n, c.max)
+				}
+				return c.rate(n), nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Workers != c.want || res.Rate != c.rate(c.want) {
+				t.Fatalf("chose %d workers at %v, want %d", res.Workers, res.Rate, c.want)
+			}
+			if c.tried != nil {
+				var tried []int
+				for n := range res.Rates {
+					tried = append(tried, n)
+				}
+				sort.Ints(tried)
+				if len(tried) != len(c.tried) {
+					t.Fatalf("tried %v, want %v", tried, c.tried)
+				}
+				for i := range tried {
+					if tried[i] != c.tried[i] {
+						t.Fatalf("tried %v, want %v", tried, c.tried)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestTuneSearchError(t *testing.T) {
+	stop := errors.New("paused")
+	_, err := tuneSearch(TuneOptions{Max: 8, Tolerance: 0.02}, func(n int) (float64, error) {
+		if n == 4 {
+			return 0, stop
+		}
+		return float64(n), nil
+	})
+	if !errors.Is(err, stop) {
+		t.Fatalf("got %v, want the measurement error", err)
+	}
+}
@@ -0,0 +1,105 @@
+package miner
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// hashBatch is how many nonces a worker tries before checking for a new
+// assignment or job.
+const hashBatch = 4096
+
+// Solution is a nonce that solves Job on Contract.
+type Solution struct {
+	Contract *Contract
+	Job      *Job
+	Nonce    *big.Int
+	Digest   common.Hash
+}
+
+// work is the loop of worker id: it hashes on whatever contract the
+// scheduler assigns to it until ctx is done.
+func (m *Miner) work(ctx context.Context, id int) error {
+	// Start from a random nonce and count up so workers never overlap.
+	var nonce [32]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return Fatal(fmt.Errorf("failed to generate random nonce: %v", err))
+	}
+	sender := m.opts.Sender
+	var (
+		nonces   [hashLanes][32]byte
+		digests  [hashLanes]common.Hash
+		hasher   NonceHasher
+		prepared *Job
+	)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		if !m.throttled(ctx, id) {
+			return nil
+		}
+		site := m.sched.assigned(id)
+		if site == nil {
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		job, target, ok := site.work()
+		if !ok {
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		if job != prepared {
+			hasher, prepared = prepareHasher(m.opts.Hasher, site.scheme, job, sender), job
+		}
+		// Digests are compared as big-endian bytes; a target of 2^256 or
+		// more accepts every digest.
+		var limit common.Hash
+		anything := target.BitLen() > 256
+		if !anything {
+			target.FillBytes(limit[:])
+		}
+
+		hashes := uint64(0)
+		for hashes < hashBatch {
+			for i := range nonces {
+				nonces[i] = nonce
+				incrementNonce(&nonce)
+			}
+			hasher.Hash(nonces[:], digests[:])
+			hashes += hashLanes
+			found := -1
+			for i := range digests {
+				if anything || bytes.Compare(digests[i][:], limit[:]) < 0 {
+					found = i
+					break
+				}
+			}
+			if found < 0 {
+				continue
+			}
+			// Count the batch before handing the solution off so that
+			// statistics of the round include the winning hash. The nonce
+			// counter is already past it, so it is not found again.
+			m.stats.add(id, hashes)
+			site.hashes.Add(hashes)
+			hashes = 0
+			if site.claim(job) {
+				m.found(ctx, &Solution{Contract: site, Job: job, Nonce: new(big.Int).SetBytes(nonces[found][:]), Digest: digests[found]})
+			}
+			break
+		}
+		m.stats.add(id, hashes)
+		site.hashes.Add(hashes)
+	}
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"Powerc20Worker/miner"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// offlineFormatVersion is bumped whenever the layout of the files exchanged
+// between prepare, sign and broadcast changes incompatibly.
+const offlineFormatVersion = 1
+
+// unsignedMineTx is the output of `prepare` and the input of `sign`. It holds
+// everything needed to sign a mine(nonce) call without talking to a node.
+type unsignedMineTx struct {
+	Version   int            `json:"version"`
+	ChainID   *hexutil.Big   `json:"chainId"`
+	From      common.Address `json:"from"`
+	To        common.Address `json:"to"`
+	Nonce     hexutil.Uint64 `json:"nonce"`
+	Gas       hexutil.Uint64 `json:"gas"`
+	GasTipCap *hexutil.Big   `json:"maxPriorityFeePerGas"`
+	GasFeeCap *hexutil.Big   `json:"maxFeePerGas"`
+	Value     *hexutil.Big   `json:"value"`
+	Data      hexutil.Bytes  `json:"data"`
+	MineNonce *hexutil.Big   `json:"mineNonce"`
+	Challenge *hexutil.Big   `json:"challenge,omitempty"`
+	Scheme    string         `json:"scheme,omitempty"`
+}
+
+// signedMineTx is the output of `sign` and the input of `broadcast`.
+type signedMineTx struct {
+	Version int            `json:"version"`
+	ChainID *hexutil.Big   `json:"chainId"`
+	From    common.Address `json:"from"`
+	Hash    common.Hash    `json:"hash"`
+	Raw     hexutil.Bytes  `json:"raw"`
+}
+
+// toTransaction rebuilds the EIP-1559 transaction described by u.
+func (u *unsignedMineTx) toTransaction() *types.Transaction {
+	return types.NewTx(&types.DynamicFeeTx{
+		ChainID:   u.ChainID.ToInt(),
+		Nonce:     uint64(u.Nonce),
+		GasTipCap: u.GasTipCap.ToInt(),
+		GasFeeCap: u.GasFeeCap.ToInt(),
+		Gas:       uint64(u.Gas),
+		To:        &u.To,
+		Value:     u.Value.ToInt(),
+		Data:      u.Data,
+	})
+}
+
+// validate checks that u is complete, was prepared for scheme and that its
+// calldata is exactly what scheme submits for the nonce it claims to carry.
+func (u *unsignedMineTx) validate(scheme miner.Scheme) error {
+	if u.Version != offlineFormatVersion {
+		return fmt.Errorf("unsupported file version %d, expected %d", u.Version, offlineFormatVersion)
+	}
+	if u.ChainID == nil || u.GasTipCap == nil || u.GasFeeCap == nil || u.Value == nil || u.MineNonce == nil {
+		return errors.New("missing required field")
+	}
+	if u.Gas == 0 {
+		return errors.New("gas limit is zero")
+	}
+	if u.GasFeeCap.ToInt().Cmp(u.GasTipCap.ToInt()) < 0 {
+		return errors.New("maxFeePerGas is lower than maxPriorityFeePerGas")
+	}
+	name := u.Scheme
+	if name == "" {
+		name = "powerc20"
+	}
+	if name != scheme.Name() {
+		return fmt.Errorf("prepared for scheme %q, not %q", name, scheme.Name())
+	}
+	job := &miner.Job{Challenge: new(big.Int), Difficulty: new(big.Int)}
+	if u.Challenge != nil {
+		job.Challenge = u.Challenge.ToInt()
+	}
+	nonce := u.MineNonce.ToInt()
+	data, err := scheme.SubmitData(job, nonce, miner.SolutionDigest(scheme, job, u.From, nonce))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(data, u.Data) {
+		return fmt.Errorf("calldata is not the %s submission of mineNonce", name)
+	}
+	return nil
+}
+
+// signScheme returns the scheme the file was prepared for. Only built-in
+// schemes are taken from the file; a custom one has to be given with
+// -scheme so that the file cannot point at a config of its choosing.
+func signScheme(flagValue string, u *unsignedMineTx) (miner.Scheme, error) {
+	if flagValue != "" {
+		return miner.LoadScheme(flagValue)
+	}
+	switch u.Scheme {
+	case "", "powerc20", "eip918":
+		return miner.LoadScheme(u.Scheme)
+	}
+	return nil, fmt.Errorf("unknown scheme %q, pass its config with -scheme", u.Scheme)
+}
+
+// prepareMineTx queries the node for the account nonce, chain ID and current
+// fees and returns an unsigned transaction from from submitting the solution
+// encoded in data.
+func prepareMineTx(ctx context.Context, client *ethclient.Client, from, contractAddr common.Address, scheme string, data []byte, mineNonce, challenge *big.Int, gasLimit uint64) (*unsignedMineTx, error) {
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chainID: %v", err)
+	}
+	accountNonce, err := client.PendingNonceAt(ctx, from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account nonce: %v", err)
+	}
+	tip, err := client.SuggestGasTipCap(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to suggest gas tip: %v", err)
+	}
+	head, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest header: %v", err)
+	}
+	if head.BaseFee == nil {
+		return nil, errors.New("chain does not support EIP-1559 transactions")
+	}
+	// Same fee cap rule as bind.TransactOpts: leave room for two doublings
+	// of the base fee before the transaction becomes unincludable.
+	feeCap := new(big.Int).Add(tip, new(big.Int).Mul(head.BaseFee, big.NewInt(2)))
+
+	if gasLimit == 0 {
+		gasLimit, err = client.EstimateGas(ctx, ethereum.CallMsg{
+			From:      from,
+			To:        &contractAddr,
+			GasTipCap: tip,
+			GasFeeCap: feeCap,
+			Data:      data,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to estimate gas: %v", err)
+		}
+	}
+
+	return &unsignedMineTx{
+		Version:   offlineFormatVersion,
+		ChainID:   (*hexutil.Big)(chainID),
+		From:      from,
+		To:        contractAddr,
+		Nonce:     hexutil.Uint64(accountNonce),
+		Gas:       hexutil.Uint64(gasLimit),
+		GasTipCap: (*hexutil.Big)(tip),
+		GasFeeCap: (*hexutil.Big)(feeCap),
+		Value:     (*hexutil.Big)(new(big.Int)),
+		Data:      data,
+		MineNonce: (*hexutil.Big)(mineNonce),
+		Challenge: (*hexutil.Big)(challenge),
+		Scheme:    scheme,
+	}, nil
+}
+
+// loadPrivateKey returns the signing key either from a hex string or from an
+// encrypted keystore file unlocked with the password stored in passwordFile.
+func loadPrivateKey(hexKey, keystoreFile, passwordFile string) (*keystore.Key, error) {
+	if keystoreFile == "" {
+		if hexKey == "" {
+			return nil, errors.New("either -privateKey or -keystore is required")
+		}
+		privateKeyECDSA, err := crypto.HexToECDSA(strings.TrimPrefix(hexKey, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("error in parsing private key: %v", err)
+		}
+		return &keystore.Key{
+			Address:    crypto.PubkeyToAddress(privateKeyECDSA.PublicKey),
+			PrivateKey: privateKeyECDSA,
+		}, nil
+	}
+	keyJSON, err := os.ReadFile(keystoreFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keystore: %v", err)
+	}
+	var password string
+	if passwordFile != "" {
+		raw, err := os.ReadFile(passwordFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read password file: %v", err)
+		}
+		password = strings.TrimRight(string(raw), "\r\n")
+	}
+	key, err := keystore.DecryptKey(keyJSON, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt keystore: %v", err)
+	}
+	return key, nil
+}
+
+func readJSONFile(path string, v interface{}) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// writeJSONFile replaces path with v as indented JSON. It writes a synced
+// temporary file next to path and renames it over path, so a crash leaves
+// either the old or the new content and never a truncated file.
+func writeJSONFile(path string, v interface{}) error {
+	raw, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(append(raw, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// runPrepare implements the `prepare` subcommand.
+func runPrepare(args []string) {
+	fs := flag.NewFlagSet("prepare", flag.ExitOnError)
+	rpcURL := fs.String("rpc", infuraURL, "Ethereum RPC endpoint")
+	from := fs.String("from", "", "Address of the mining account")
+	contract := fs.String("contractAddress", contractAddress, "Address of the Ethereum contract")
+	nonceStr := fs.String("nonce", "", "Mining nonce found for the account (decimal or 0x-prefixed hex)")
+	gasLimit := fs.Uint64("gasLimit", 0, "Gas limit, estimated from the node when zero")
+	out := fs.String("out", "mine-unsigned.json", "File to write the unsigned transaction to")
+	schemeName := fs.String("scheme", "powerc20", "Contract family: powerc20, eip918 or the path of a JSON scheme config")
+	parseCommand(fs, args)
+
+	if !common.IsHexAddress(*from) {
+		offlineLog.Fatalf("Invalid -from address: %q", *from)
+	}
+	mineNonce, ok := new(big.Int).SetString(*nonceStr, 0)
+	if !ok {
+		offlineLog.Fatalf("Invalid -nonce: %q", *nonceStr)
+	}
+
+	scheme, err := miner.LoadScheme(*schemeName)
+	if err != nil {
+		offlineLog.Fatalf("Failed to load mining scheme: %v", err)
+	}
+
+	ctx := context.Background()
+	client, err := ethclient.Dial(*rpcURL)
+	if err != nil {
+		offlineLog.Fatalf("Failed to connect to the Ethereum client: %v", err)
+	}
+	sender, contractAddr := common.HexToAddress(*from), common.HexToAddress(*contract)
+	job, err := scheme.FetchJob(ctx, client, contractAddr, sender)
+	if err != nil {
+		offlineLog.Fatalf("Failed to get mining job: %v", err)
+	}
+	digest := miner.SolutionDigest(scheme, job, sender, mineNonce)
+	if digest.Big().Cmp(scheme.Target(job)) >= 0 {
+		offlineLog.Warnf("Nonce %v does not solve the current challenge %v, the transaction will likely revert", mineNonce, job.Challenge)
+	}
+	data, err := scheme.SubmitData(job, mineNonce, digest)
+	if err != nil {
+		offlineLog.Fatalf("Failed to encode solution: %v", err)
+	}
+	unsigned, err := prepareMineTx(ctx, client, sender, contractAddr, scheme.Name(), data, mineNonce, job.Challenge, *gasLimit)
+	if err != nil {
+		offlineLog.Fatalf("Failed to prepare mine transaction: %v", err)
+	}
+	if err := writeJSONFile(*out, unsigned); err != nil {
+		offlineLog.Fatalf("Failed to write unsigned transaction: %v", err)
+	}
+	withEvent(offlineLog, "tx_prepared", "contract", unsigned.To, "nonce", unsigned.MineNonce.ToInt()).Infof("Unsigned mine transaction written to %s (account nonce %d, gas %d)", *out, unsigned.Nonce, unsigned.Gas)
+}
+
+// runSign implements the offline `sign` subcommand. It never opens a
+// network connection.
+func runSign(args []string) {
+	fs := flag.NewFlagSet("sign", flag.ExitOnError)
+	in := fs.String("in", "mine-unsigned.json", "Unsigned transaction produced by prepare")
+	out := fs.String("out", "mine-signed.json", "File to write the signed transaction to")
+	hexKey := fs.String("privateKey", "", "Private key for the Ethereum account")
+	keystoreFile := fs.String("keystore", "", "Encrypted keystore file holding the account key")
+	passwordFile := fs.String("password", "", "File containing the keystore password")
+	contract := fs.String("contractAddress", contractAddress, "Address of the Ethereum contract")
+	schemeName := fs.String("scheme", "", "Contract family the transaction was prepared for: powerc20, eip918 or the path of a JSON scheme config (default the built-in scheme named in the file)")
+	policyCfg := registerPolicyFlags(fs)
+	parseCommand(fs, args)
+
+	var unsigned unsignedMineTx
+	if err := readJSONFile(*in, &unsigned); err != nil {
+		offlineLog.Fatalf("Failed to read unsigned transaction: %v", err)
+	}
+	scheme, err := signScheme(*schemeName, &unsigned)
+	if err != nil {
+		offlineLog.Fatalf("Refusing to sign %s: %v", *in, err)
+	}
+	if err := unsigned.validate(scheme); err != nil {
+		offlineLog.Fatalf("Refusing to sign %s: %v", *in, err)
+	}
+	key, err := loadPrivateKey(*hexKey, *keystoreFile, *passwordFile)
+	if err != nil {
+		offlineLog.Fatalf("Failed to load key: %v", err)
+	}
+	if key.Address != unsigned.From {
+		offlineLog.Fatalf("Key belongs to %s but transaction was prepared for %s", key.Address.Hex(), unsigned.From.Hex())
+	}
+
+	policy, err := newSigningPolicy(policyCfg, common.HexToAddress(*contract))
+	if err != nil {
+		offlineLog.Fatalf("Failed to set up signing policy: %v", err)
+	}
+	policy.submitSelector = miner.SubmitSelector(scheme)
+	reserved, err := policy.authorize(unsigned.toTransaction())
+	if err != nil {
+		offlineLog.Fatalf("Refusing to sign %s: %v", *in, err)
+	}
+
+	signer := types.LatestSignerForChainID(unsigned.ChainID.ToInt())
+	tx, err := types.SignTx(unsigned.toTransaction(), signer, key.PrivateKey)
+	if err != nil {
+		offlineLog.Fatalf("Failed to sign transaction: %v", err)
+	}
+	policy.commit(reserved, tx)
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		offlineLog.Fatalf("Failed to encode signed transaction: %v", err)
+	}
+	signed := &signedMineTx{
+		Version: offlineFormatVersion,
+		ChainID: unsigned.ChainID,
+		From:    unsigned.From,
+		Hash:    tx.Hash(),
+		Raw:     raw,
+	}
+	if err := writeJSONFile(*out, signed); err != nil {
+		offlineLog.Fatalf("Failed to write signed transaction: %v", err)
+	}
+	withEvent(offlineLog, "tx_signed", "tx_hash", tx.Hash()).Infof("Signed transaction %s written to %s", tx.Hash().Hex(), *out)
+}
+
+// runBroadcast implements the `broadcast` subcommand.
+func runBroadcast(args []string) {
+	fs := flag.NewFlagSet("broadcast", flag.ExitOnError)
+	rpcURL := fs.String("rpc", infuraURL, "Ethereum RPC endpoint")
+	in := fs.String("in", "mine-signed.json", "Signed transaction produced by sign")
+	parseCommand(fs, args)
+
+	var signed signedMineTx
+	if err := readJSONFile(*in, &signed); err != nil {
+		offlineLog.Fatalf("Failed to read signed transaction: %v", err)
+	}
+	if signed.Version != offlineFormatVersion {
+		offlineLog.Fatalf("Unsupported file version %d, expected %d", signed.Version, offlineFormatVersion)
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(signed.Raw); err != nil {
+		offlineLog.Fatalf("Failed to decode signed transaction: %v", err)
+	}
+	if tx.Hash() != signed.Hash {
+		offlineLog.Fatalf("Transaction hash mismatch: file says %s, raw decodes to %s", signed.Hash.Hex(), tx.Hash().Hex())
+	}
+	sender, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil || sender != signed.From {
+		offlineLog.Fatalf("Transaction is not signed by %s", signed.From.Hex())
+	}
+
+	ctx := context.Background()
+	client, err := ethclient.Dial(*rpcURL)
+	if err != nil {
+		offlineLog.Fatalf("Failed to connect to the Ethereum client: %v", err)
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		offlineLog.Fatalf("Failed to get chainID: %v", err)
+	}
+	if chainID.Cmp(tx.ChainId()) != 0 {
+		offlineLog.Fatalf("Transaction is for chain %v but node is on chain %v", tx.ChainId(), chainID)
+	}
+
+	if err := client.SendTransaction(ctx, tx); err != nil {
+		offlineLog.Fatalf("Failed to broadcast transaction: %v", err)
+	}
+	withEvent(offlineLog, "tx_broadcast", "tx_hash", tx.Hash()).Infof("Transaction %s broadcast, waiting for receipt...", tx.Hash().Hex())
+	receipt, err := bind.WaitMined(ctx, client, tx)
+	if err != nil {
+		offlineLog.Fatalf("Failed to mine the transaction: %v", err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		offlineLog.Fatalf("Mining transaction reverted in block %v, Transaction Hash: %s", receipt.BlockNumber, receipt.TxHash.Hex())
+	}
+	withEvent(offlineLog, "tx_confirmed", "tx_hash", receipt.TxHash).Infof("Mining transaction successfully confirmed in block %v, Transaction Hash: %s", receipt.BlockNumber, receipt.TxHash.Hex())
+}
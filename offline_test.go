@@ -0,0 +1,122 @@
+package main
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"Powerc20Worker/miner"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// unsignedFor returns a complete unsigned file submitting nonce with scheme.
+func unsignedFor(t *testing.T, scheme miner.Scheme, nonce, challenge *big.Int) *unsignedMineTx {
+	t.Helper()
+	from := common.HexToAddress("0x1E4481159013D3Aa8dF7623Fc9B26daE5bcC0a73")
+	job := &miner.Job{Challenge: challenge, Difficulty: new(big.Int)}
+	data, err := scheme.SubmitData(job, nonce, miner.SolutionDigest(scheme, job, from, nonce))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &unsignedMineTx{
+		Version:   offlineFormatVersion,
+		ChainID:   (*hexutil.Big)(big.NewInt(1)),
+		From:      from,
+		To:        common.HexToAddress(contractAddress),
+		Gas:       100000,
+		GasTipCap: (*hexutil.Big)(big.NewInt(1)),
+		GasFeeCap: (*hexutil.Big)(big.NewInt(2)),
+		Value:     (*hexutil.Big)(new(big.Int)),
+		Data:      data,
+		MineNonce: (*hexutil.Big)(nonce),
+		Challenge: (*hexutil.Big)(challenge),
+		Scheme:    scheme.Name(),
+	}
+}
+
+func TestUnsignedValidate(t *testing.T) {
+	for _, name := range []string{"powerc20", "eip918"} {
+		scheme, err := miner.LoadScheme(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u := unsignedFor(t, scheme, big.NewInt(42), big.NewInt(7))
+		if err := u.validate(scheme); err != nil {
+			t.Errorf("%s: valid file rejected: %v", name, err)
+		}
+
+		tampered := *u
+		tampered.Data = append(hexutil.Bytes(nil), u.Data...)
+		tampered.Data[len(tampered.Data)-1] ^= 1
+		if err := tampered.validate(scheme); err == nil {
+			t.Errorf("%s: modified calldata accepted", name)
+		}
+		tampered = *u
+		tampered.MineNonce = (*hexutil.Big)(big.NewInt(43))
+		if err := tampered.validate(scheme); err == nil {
+			t.Errorf("%s: calldata for another nonce accepted", name)
+		}
+	}
+}
+
+func TestUnsignedValidateScheme(t *testing.T) {
+	powerc20, _ := miner.LoadScheme("powerc20")
+	eip918, _ := miner.LoadScheme("eip918")
+	u := unsignedFor(t, eip918, big.NewInt(42), big.NewInt(7))
+
+	// A file claiming another scheme does not skip the calldata check.
+	u.Scheme = "custom"
+	if _, err := signScheme("", u); err == nil || !strings.Contains(err.Error(), "unknown scheme") {
+		t.Errorf("unknown scheme in the file: got %v", err)
+	}
+	u.Scheme = "powerc20"
+	if err := u.validate(powerc20); err == nil {
+		t.Error("eip918 calldata accepted as powerc20")
+	}
+	u.Scheme = "eip918"
+	if err := u.validate(powerc20); err == nil {
+		t.Error("file for eip918 validated against powerc20")
+	}
+	scheme, err := signScheme("", u)
+	if err != nil || scheme.Name() != "eip918" {
+		t.Fatalf("built-in scheme from the file: %v, %v", scheme, err)
+	}
+	if err := u.validate(scheme); err != nil {
+		t.Errorf("valid eip918 file rejected: %v", err)
+	}
+}
+
+func TestWriteJSONFileReplaces(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "queue.json")
+	if err := writeJSONFile(path, []int{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeJSONFile(path, []int{4}); err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	if err := readJSONFile(path, &got); err != nil || len(got) != 1 || got[0] != 4 {
+		t.Fatalf("read back %v, %v; want [4]", got, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("mode %v, want 0600", info.Mode().Perm())
+	}
+	// No temporary files are left behind.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("%d files in the directory, want only queue.json", len(entries))
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"Powerc20Worker/miner"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// tokenABI covers the ERC20 functions the tool may call on a mined
+// contract besides mining.
+var tokenABI = mustParseABI(`[
+	{"type":"function","name":"approve","stateMutability":"nonpayable","inputs":[{"name":"spender","type":"address"},{"name":"amount","type":"uint256"}],"outputs":[{"name":"","type":"bool"}]},
+	{"type":"function","name":"transfer","stateMutability":"nonpayable","inputs":[{"name":"to","type":"address"},{"name":"amount","type":"uint256"}],"outputs":[{"name":"","type":"bool"}]}
+]`)
+
+// errPolicyRejected is returned by policy-wrapped signers when a transaction
+// violates the signing policy and no override was given.
+var errPolicyRejected = errors.New("transaction rejected by signing policy")
+
+// policyConfig holds the command-line settings of the signing policy.
+type policyConfig struct {
+	allowTo         string
+	maxTxFee        string
+	maxDailyFee     string
+	maxMintsPerHour int
+	override        bool
+	stateFile       string
+}
+
+// registerPolicyFlags adds the signing policy flags to fs.
+func registerPolicyFlags(fs *flag.FlagSet) *policyConfig {
+	cfg := new(policyConfig)
+	fs.StringVar(&cfg.allowTo, "policyAllowTo", "", "Comma-separated sweep destinations allowed besides the PoWERC20 contract")
+	fs.StringVar(&cfg.maxTxFee, "policyMaxTxFee", "0.05", "Maximum fee in ETH a single transaction may pay (0 disables)")
+	fs.StringVar(&cfg.maxDailyFee, "policyMaxDailyFee", "0.5", "Maximum fee in ETH spent over any 24 hours (0 disables)")
+	fs.IntVar(&cfg.maxMintsPerHour, "policyMaxMintsPerHour", 0, "Maximum mine transactions signed per hour (0 disables)")
+	fs.BoolVar(&cfg.override, "policyOverride", false, "Sign transactions that violate the policy instead of rejecting them")
+	fs.StringVar(&cfg.stateFile, "policyState", defaultPolicyState, "File to persist fee spend and mint history across restarts, next to -queueFile when relative; empty keeps it in memory")
+	return cfg
+}
+
+// defaultPolicyState is where the policy history is kept unless
+// -policyState says otherwise.
+const defaultPolicyState = "policy.json"
+
+// policyStatePath places a relative -policyState in the directory of
+// queueFile, so that the history lives with the queued solutions.
+func policyStatePath(stateFile, queueFile string) string {
+	if stateFile == "" || filepath.IsAbs(stateFile) || queueFile == "" {
+		return stateFile
+	}
+	return filepath.Join(filepath.Dir(queueFile), stateFile)
+}
+
+// policyEntry records one signed transaction for the rolling limits. An
+// entry without a hash is reserved for a transaction being signed. Fee is
+// the most the transaction can pay until its receipt settles it.
+type policyEntry struct {
+	Time time.Time      `json:"time"`
+	Hash common.Hash    `json:"hash"`
+	Fee  *big.Int       `json:"fee"`
+	To   common.Address `json:"to"`
+	Mint bool           `json:"mint"`
+}
+
+// signingPolicy decides whether a transaction may be signed. Every signer
+// used by the tool is wrapped with it.
+type signingPolicy struct {
+	contracts       map[common.Address]bool
+	submitSelector  []byte
+	allowed         map[common.Address]bool
+	maxTxFee        *big.Int
+	maxDailyFee     *big.Int
+	maxMintsPerHour int
+	override        bool
+	stateFile       string
+
+	mu      sync.Mutex
+	history []*policyEntry
+	now     func() time.Time
+}
+
+// newSigningPolicy builds the policy for mining contracts from cfg and loads
+// any persisted history.
+func newSigningPolicy(cfg *policyConfig, contracts ...common.Address) (*signingPolicy, error) {
+	p := &signingPolicy{
+		contracts:       make(map[common.Address]bool),
+		submitSelector:  miner.MineSelector,
+		allowed:         make(map[common.Address]bool),
+		maxMintsPerHour: cfg.maxMintsPerHour,
+		override:        cfg.override,
+		stateFile:       cfg.stateFile,
+		now:             time.Now,
+	}
+	for _, contract := range contracts {
+		p.contracts[contract] = true
+		p.allowed[contract] = true
+	}
+	for _, addr := range strings.Split(cfg.allowTo, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		if !common.IsHexAddress(addr) {
+			return nil, fmt.Errorf("invalid allowed destination %q", addr)
+		}
+		p.allowed[common.HexToAddress(addr)] = true
+	}
+	var err error
+	if p.maxTxFee, err = parseEther(cfg.maxTxFee); err != nil {
+		return nil, fmt.Errorf("invalid per-transaction fee cap: %v", err)
+	}
+	if p.maxDailyFee, err = parseEther(cfg.maxDailyFee); err != nil {
+		return nil, fmt.Errorf("invalid daily fee cap: %v", err)
+	}
+	if p.stateFile != "" {
+		if err := readJSONFile(p.stateFile, &p.history); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to load policy state: %v", err)
+		}
+	}
+	return p, nil
+}
+
+// parseEther converts a decimal ETH amount such as "0.05" to wei.
+func parseEther(s string) (*big.Int, error) {
+	if s == "" {
+		return new(big.Int), nil
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok || r.Sign() < 0 {
+		return nil, fmt.Errorf("%q is not a valid ETH amount", s)
+	}
+	r.Mul(r, new(big.Rat).SetInt(big.NewInt(1e18)))
+	return new(big.Int).Quo(r.Num(), r.Denom()), nil
+}
+
+// formatEther renders wei as ETH for log messages.
+func formatEther(wei *big.Int) string {
+	return new(big.Rat).SetFrac(wei, big.NewInt(1e18)).FloatString(6)
+}
+
+// maxFee is the most a transaction can pay in fees.
+func maxFee(tx *types.Transaction) *big.Int {
+	return new(big.Int).Mul(new(big.Int).SetUint64(tx.Gas()), tx.GasFeeCap())
+}
+
+func (p *signingPolicy) isMint(tx *types.Transaction) bool {
+	return tx.To() != nil && p.contracts[*tx.To()] && len(tx.Data()) >= 4 && bytes.Equal(tx.Data()[:4], p.submitSelector)
+}
+
+// check returns an error describing why tx violates the policy, or nil.
+// The caller holds p.mu.
+func (p *signingPolicy) check(tx *types.Transaction) error {
+	if tx.To() == nil {
+		return errors.New("contract creation is not allowed")
+	}
+	if !p.allowed[*tx.To()] {
+		return fmt.Errorf("destination %s is not allowed", tx.To().Hex())
+	}
+	if p.contracts[*tx.To()] && !p.isMint(tx) {
+		if err := p.checkTokenCall(tx); err != nil {
+			return err
+		}
+	}
+	fee := maxFee(tx)
+	if p.maxTxFee.Sign() > 0 && fee.Cmp(p.maxTxFee) > 0 {
+		return fmt.Errorf("fee of up to %s ETH exceeds the per-transaction cap of %s ETH", formatEther(fee), formatEther(p.maxTxFee))
+	}
+	now := p.now()
+	if p.maxDailyFee.Sign() > 0 {
+		spent := new(big.Int)
+		for _, e := range p.history {
+			if now.Sub(e.Time) < 24*time.Hour {
+				spent.Add(spent, e.Fee)
+			}
+		}
+		if total := new(big.Int).Add(spent, fee); total.Cmp(p.maxDailyFee) > 0 {
+			return fmt.Errorf("fee of up to %s ETH would bring 24h spend to %s ETH, over the cap of %s ETH", formatEther(fee), formatEther(total), formatEther(p.maxDailyFee))
+		}
+	}
+	if p.maxMintsPerHour > 0 && p.isMint(tx) {
+		mints := 0
+		for _, e := range p.history {
+			if e.Mint && now.Sub(e.Time) < time.Hour {
+				mints++
+			}
+		}
+		if mints >= p.maxMintsPerHour {
+			return fmt.Errorf("already signed %d mints in the last hour, the cap is %d", mints, p.maxMintsPerHour)
+		}
+	}
+	return nil
+}
+
+// checkTokenCall checks a transaction to a mined contract other than a
+// mint: only approving an allowed router and transferring to an allowed
+// destination may be signed.
+func (p *signingPolicy) checkTokenCall(tx *types.Transaction) error {
+	if tx.Value().Sign() != 0 {
+		return errors.New("sending ETH to the token contract is not allowed")
+	}
+	data := tx.Data()
+	if len(data) < 4 {
+		return errors.New("calls to the token contract other than mine, approve and transfer are not allowed")
+	}
+	method, err := tokenABI.MethodById(data[:4])
+	if err != nil {
+		return fmt.Errorf("call %#x to the token contract is not allowed, only mine, approve and transfer are", data[:4])
+	}
+	args, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return fmt.Errorf("invalid %s call: %v", method.Name, err)
+	}
+	// Both take the address the tokens may go to first.
+	to := args[0].(common.Address)
+	if !p.allowed[to] || p.contracts[to] {
+		if method.Name == "approve" {
+			return fmt.Errorf("approving %s to spend tokens is not allowed", to.Hex())
+		}
+		return fmt.Errorf("transferring tokens to %s is not allowed", to.Hex())
+	}
+	return nil
+}
+
+// reserve adds tx to the history before it is signed, dropping entries
+// that no longer affect any limit. The caller holds p.mu.
+func (p *signingPolicy) reserve(tx *types.Transaction) *policyEntry {
+	now := p.now()
+	kept := p.history[:0]
+	for _, e := range p.history {
+		if now.Sub(e.Time) < 24*time.Hour {
+			kept = append(kept, e)
+		}
+	}
+	e := &policyEntry{Time: now, Fee: maxFee(tx), Mint: p.isMint(tx)}
+	if tx.To() != nil {
+		e.To = *tx.To()
+	}
+	p.history = append(kept, e)
+	return e
+}
+
+// commit records that the transaction reserved as e was signed as tx and
+// persists the history.
+func (p *signingPolicy) commit(e *policyEntry, tx *types.Transaction) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e.Hash = tx.Hash()
+	p.save()
+}
+
+// settle replaces the worst-case fee reserved for a signed transaction
+// with the fee its receipt shows it paid.
+func (p *signingPolicy) settle(receipt *types.Receipt) {
+	if receipt.EffectiveGasPrice == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, e := range p.history {
+		if e.Hash == receipt.TxHash {
+			e.Fee = new(big.Int).Mul(receipt.EffectiveGasPrice, new(big.Int).SetUint64(receipt.GasUsed))
+			p.save()
+			return
+		}
+	}
+}
+
+// release gives back the limits reserved as e when signing failed.
+func (p *signingPolicy) release(e *policyEntry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, other := range p.history {
+		if other == e {
+			p.history = append(p.history[:i], p.history[i+1:]...)
+			return
+		}
+	}
+}
+
+// save persists the signed entries of the history. The caller holds p.mu.
+func (p *signingPolicy) save() {
+	if p.stateFile == "" {
+		return
+	}
+	signed := make([]*policyEntry, 0, len(p.history))
+	for _, e := range p.history {
+		if e.Hash != (common.Hash{}) {
+			signed = append(signed, e)
+		}
+	}
+	if err := writeJSONFile(p.stateFile, signed); err != nil {
+		policyLog.Warnf("Failed to persist policy state: %v", err)
+	}
+}
+
+// authorize runs the policy for tx and logs the decision. If tx may be
+// signed, its fee and mint are reserved in the same step so that
+// concurrent requests cannot both slip under a limit; the caller commits
+// the returned entry once signed or releases it.
+func (p *signingPolicy) authorize(tx *types.Transaction) (*policyEntry, error) {
+	to := "<create>"
+	if tx.To() != nil {
+		to = tx.To().Hex()
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.check(tx); err != nil {
+		if !p.override {
+			withEvent(policyLog, "policy_reject", "contract", to).Errorf("Policy rejected transaction to %s: %v", to, err)
+			return nil, fmt.Errorf("%w: %v", errPolicyRejected, err)
+		}
+		withEvent(policyLog, "policy_override", "contract", to).Warnf("Policy override: signing transaction to %s despite violation: %v", to, err)
+	} else {
+		withEvent(policyLog, "policy_accept", "contract", to).Infof("Policy accepted transaction to %s with max fee %s ETH", to, formatEther(maxFee(tx)))
+	}
+	return p.reserve(tx), nil
+}
+
+// wrap returns a copy of opts whose Signer enforces the policy before
+// delegating to the original signer.
+func (p *signingPolicy) wrap(opts *bind.TransactOpts) *bind.TransactOpts {
+	wrapped := *opts
+	inner := opts.Signer
+	wrapped.Signer = func(from common.Address, tx *types.Transaction) (*types.Transaction, error) {
+		reserved, err := p.authorize(tx)
+		if err != nil {
+			return nil, err
+		}
+		signed, err := inner(from, tx)
+		if err != nil {
+			p.release(reserved)
+			return nil, err
+		}
+		p.commit(reserved, signed)
+		return signed, nil
+	}
+	return &wrapped
+}
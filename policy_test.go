@@ -0,0 +1,236 @@
+package main
+
+import (
+	"math/big"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"Powerc20Worker/miner"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func testPolicyConfig(stateFile string) *policyConfig {
+	return &policyConfig{maxTxFee: "0.05", maxDailyFee: "0.5", stateFile: stateFile}
+}
+
+// mintTx is a mine transaction to contract costing at most gas * 1 gwei.
+func mintTx(contract common.Address, nonce, gas uint64) *types.Transaction {
+	return types.NewTx(&types.DynamicFeeTx{
+		ChainID:   big.NewInt(1),
+		Nonce:     nonce,
+		GasTipCap: big.NewInt(1e9),
+		GasFeeCap: big.NewInt(1e9),
+		Gas:       gas,
+		To:        &contract,
+		Value:     new(big.Int),
+		Data:      append(append([]byte(nil), miner.MineSelector...), make([]byte, 32)...),
+	})
+}
+
+func TestPolicyConcurrentReservations(t *testing.T) {
+	contract := common.HexToAddress(contractAddress)
+	cfg := testPolicyConfig("")
+	cfg.maxMintsPerHour = 3
+	p, err := newSigningPolicy(cfg, contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		accepted []*policyEntry
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if e, err := p.authorize(mintTx(contract, uint64(i), 100000)); err == nil {
+				mu.Lock()
+				accepted = append(accepted, e)
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if len(accepted) != cfg.maxMintsPerHour {
+		t.Fatalf("%d concurrent mints accepted, the cap is %d", len(accepted), cfg.maxMintsPerHour)
+	}
+
+	// A reservation whose signing failed gives its slot back.
+	p.release(accepted[0])
+	e, err := p.authorize(mintTx(contract, 100, 100000))
+	if err != nil {
+		t.Fatalf("mint after a release rejected: %v", err)
+	}
+	p.commit(e, mintTx(contract, 100, 100000))
+	if _, err := p.authorize(mintTx(contract, 101, 100000)); err == nil {
+		t.Fatal("mint over the cap accepted")
+	}
+}
+
+func TestPolicyDailyFeeConcurrent(t *testing.T) {
+	contract := common.HexToAddress(contractAddress)
+	p, err := newSigningPolicy(testPolicyConfig(""), contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each transaction may cost 0.04 ETH; twelve of them fit under 0.5.
+	var wg sync.WaitGroup
+	var accepted sync.Map
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := p.authorize(mintTx(contract, uint64(i), 40_000_000)); err == nil {
+				accepted.Store(i, true)
+			}
+		}(i)
+	}
+	wg.Wait()
+	n := 0
+	accepted.Range(func(_, _ interface{}) bool { n++; return true })
+	if n != 12 {
+		t.Fatalf("%d transactions of 0.04 ETH accepted under a 0.5 ETH daily cap, want 12", n)
+	}
+}
+
+func TestPolicyStatePersists(t *testing.T) {
+	dir := t.TempDir()
+	state := policyStatePath(defaultPolicyState, filepath.Join(dir, "solutions.json"))
+	if state != filepath.Join(dir, defaultPolicyState) {
+		t.Fatalf("policy state at %s, want it next to the queue file", state)
+	}
+	contract := common.HexToAddress(contractAddress)
+	cfg := testPolicyConfig(state)
+	cfg.maxMintsPerHour = 1
+
+	p, err := newSigningPolicy(cfg, contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := mintTx(contract, 0, 100000)
+	e, err := p.authorize(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.commit(e, tx)
+
+	// A restart reads the history back and keeps the cap.
+	restarted, err := newSigningPolicy(cfg, contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := restarted.authorize(mintTx(contract, 1, 100000)); err == nil {
+		t.Fatal("mint cap reset by a restart")
+	}
+}
+
+// callTx is a call to contract with data and value, costing at most
+// 100000 gas at 1 gwei.
+func callTx(contract common.Address, value int64, data []byte) *types.Transaction {
+	return types.NewTx(&types.DynamicFeeTx{
+		ChainID:   big.NewInt(1),
+		GasTipCap: big.NewInt(1e9),
+		GasFeeCap: big.NewInt(1e9),
+		Gas:       100000,
+		To:        &contract,
+		Value:     big.NewInt(value),
+		Data:      data,
+	})
+}
+
+func TestPolicyTokenCalls(t *testing.T) {
+	contract := common.HexToAddress(contractAddress)
+	router := common.HexToAddress("0x00000000000000000000000000000000000000a1")
+	other := common.HexToAddress("0x00000000000000000000000000000000000000b2")
+	cfg := testPolicyConfig("")
+	cfg.allowTo = router.Hex()
+	p, err := newSigningPolicy(cfg, contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pack := func(method string, args ...interface{}) []byte {
+		data, err := tokenABI.Pack(method, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	amount := big.NewInt(1e18)
+	transferFrom := append(common.FromHex("0x23b872dd"), make([]byte, 96)...)
+	for _, c := range []struct {
+		name string
+		tx   *types.Transaction
+		want string // empty if the transaction is allowed
+	}{
+		{"mint", mintTx(contract, 0, 100000), ""},
+		{"approve router", callTx(contract, 0, pack("approve", router, amount)), ""},
+		{"transfer to destination", callTx(contract, 0, pack("transfer", router, amount)), ""},
+		{"approve other", callTx(contract, 0, pack("approve", other, amount)), "approving"},
+		{"approve contract", callTx(contract, 0, pack("approve", contract, amount)), "approving"},
+		{"transfer to other", callTx(contract, 0, pack("transfer", other, amount)), "transferring"},
+		{"transferFrom", callTx(contract, 0, transferFrom), "not allowed"},
+		{"no calldata", callTx(contract, 0, nil), "not allowed"},
+		{"short approve", callTx(contract, 0, pack("approve", router, amount)[:36]), "invalid approve"},
+		{"value with approve", callTx(contract, 1, pack("approve", router, amount)), "sending ETH"},
+		{"other destination", callTx(other, 0, nil), "destination"},
+	} {
+		p.mu.Lock()
+		err := p.check(c.tx)
+		p.mu.Unlock()
+		if c.want == "" {
+			if err != nil {
+				t.Errorf("%s: rejected: %v", c.name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: got %v, want an error containing %q", c.name, err, c.want)
+		}
+	}
+}
+
+func TestPolicySettle(t *testing.T) {
+	contract := common.HexToAddress(contractAddress)
+	p, err := newSigningPolicy(testPolicyConfig(filepath.Join(t.TempDir(), "policy.json")), contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Twelve transactions of up to 0.04 ETH fill the 0.5 ETH daily cap.
+	for i := 0; i < 12; i++ {
+		tx := mintTx(contract, uint64(i), 40_000_000)
+		e, err := p.authorize(tx)
+		if err != nil {
+			t.Fatalf("transaction %d: %v", i, err)
+		}
+		p.commit(e, tx)
+		if i == 0 {
+			// The first one only used 100000 gas at 0.5 gwei, which the
+			// submitter settles once its receipt arrives.
+			done := (&submitter{policy: p}).track(&pendingTx{Hash: tx.Hash()})
+			done(&types.Receipt{TxHash: tx.Hash(), GasUsed: 100000, EffectiveGasPrice: big.NewInt(5e8)})
+		}
+	}
+	// What the first one did not spend makes room for one more.
+	tx := mintTx(contract, 12, 40_000_000)
+	e, err := p.authorize(tx)
+	if err != nil {
+		t.Fatalf("settled fee was not given back: %v", err)
+	}
+	p.commit(e, tx)
+	if _, err := p.authorize(mintTx(contract, 13, 40_000_000)); err == nil {
+		t.Fatal("transaction over the daily cap accepted")
+	}
+
+	// The settled fee is persisted.
+	restarted, err := newSigningPolicy(testPolicyConfig(p.stateFile), contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fee := restarted.history[0].Fee; fee.Cmp(big.NewInt(5e13)) != 0 {
+		t.Errorf("restarted with a fee of %v wei for the settled transaction, want 5e13", fee)
+	}
+}
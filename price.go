@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	gethabi "github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// errNoLiquidity is returned when a pair or pool holds nothing to price
+// against.
+var errNoLiquidity = errors.New("pair has no liquidity")
+
+// wethAddress is the canonical WETH9 contract on mainnet.
+const wethAddress = "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2"
+
+// pairABI covers the read-only functions of Uniswap V2 pairs, V3 pools and
+// ERC20 tokens used for pricing.
+var pairABI = mustParseABI(`[
+	{"type":"function","name":"token0","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"address"}]},
+	{"type":"function","name":"token1","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"address"}]},
+	{"type":"function","name":"getReserves","stateMutability":"view","inputs":[],"outputs":[{"name":"reserve0","type":"uint112"},{"name":"reserve1","type":"uint112"},{"name":"blockTimestampLast","type":"uint32"}]},
+	{"type":"function","name":"slot0","stateMutability":"view","inputs":[],"outputs":[{"name":"sqrtPriceX96","type":"uint160"},{"name":"tick","type":"int24"},{"name":"observationIndex","type":"uint16"},{"name":"observationCardinality","type":"uint16"},{"name":"observationCardinalityNext","type":"uint16"},{"name":"feeProtocol","type":"uint8"},{"name":"unlocked","type":"bool"}]},
+	{"type":"function","name":"liquidity","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint128"}]},
+	{"type":"function","name":"decimals","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint8"}]}
+]`)
+
+func mustParseABI(raw string) gethabi.ABI {
+	parsed, err := gethabi.JSON(strings.NewReader(raw))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+// pricePair is a Uniswap V2 pair or V3 pool between a token and the quote.
+type pricePair struct {
+	address        common.Address
+	kind           string // "v2" or "v3"
+	token0, token1 common.Address
+	decimals0      uint8
+	decimals1      uint8
+}
+
+// pairPriceSource prices tokens in ETH from on-chain DEX reserves.
+type pairPriceSource struct {
+	caller bind.ContractCaller
+	quote  common.Address
+	pairs  map[common.Address]*pricePair // keyed by the priced token
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	cache map[common.Address]cachedPrice
+}
+
+type cachedPrice struct {
+	price float64
+	at    time.Time
+}
+
+// call runs a view function of pairABI on addr through a plain eth_call.
+func callPair(ctx context.Context, caller bind.ContractCaller, addr common.Address, method string) ([]interface{}, error) {
+	var out []interface{}
+	contract := bind.NewBoundContract(addr, pairABI, caller, nil, nil)
+	if err := contract.Call(&bind.CallOpts{Context: ctx}, &out, method); err != nil {
+		return nil, fmt.Errorf("%s() on %s failed: %v", method, addr.Hex(), err)
+	}
+	return out, nil
+}
+
+// newPairPriceSource inspects each pair, working out which token it prices
+// and whether it is a V2 pair or a V3 pool unless kind says so.
+func newPairPriceSource(ctx context.Context, caller bind.ContractCaller, quote common.Address, pairs []common.Address, kind string) (*pairPriceSource, error) {
+	s := &pairPriceSource{
+		caller: caller,
+		quote:  quote,
+		pairs:  make(map[common.Address]*pricePair),
+		ttl:    30 * time.Second,
+		cache:  make(map[common.Address]cachedPrice),
+	}
+	for _, addr := range pairs {
+		p := &pricePair{address: addr, kind: kind}
+		out, err := callPair(ctx, caller, addr, "token0")
+		if err != nil {
+			return nil, err
+		}
+		p.token0 = out[0].(common.Address)
+		if out, err = callPair(ctx, caller, addr, "token1"); err != nil {
+			return nil, err
+		}
+		p.token1 = out[0].(common.Address)
+		for _, t := range []struct {
+			token common.Address
+			dec   *uint8
+		}{{p.token0, &p.decimals0}, {p.token1, &p.decimals1}} {
+			out, err := callPair(ctx, caller, t.token, "decimals")
+			if err != nil {
+				return nil, err
+			}
+			*t.dec = out[0].(uint8)
+		}
+		if p.kind == "" || p.kind == "auto" {
+			if _, err := callPair(ctx, caller, addr, "getReserves"); err == nil {
+				p.kind = "v2"
+			} else if _, err := callPair(ctx, caller, addr, "slot0"); err == nil {
+				p.kind = "v3"
+			} else {
+				return nil, fmt.Errorf("%s is neither a V2 pair nor a V3 pool", addr.Hex())
+			}
+		}
+		if p.kind != "v2" && p.kind != "v3" {
+			return nil, fmt.Errorf("unknown pair type %q", p.kind)
+		}
+		switch quote {
+		case p.token0:
+			s.pairs[p.token1] = p
+		case p.token1:
+			s.pairs[p.token0] = p
+		default:
+			return nil, fmt.Errorf("pair %s does not trade against %s", addr.Hex(), quote.Hex())
+		}
+	}
+	return s, nil
+}
+
+// TokenPrice returns the price of one whole token in ETH.
+func (s *pairPriceSource) TokenPrice(ctx context.Context, token common.Address) (float64, error) {
+	p := s.pairs[token]
+	if p == nil {
+		return 0, fmt.Errorf("no price pair configured for %s", token.Hex())
+	}
+	s.mu.Lock()
+	cached, ok := s.cache[token]
+	s.mu.Unlock()
+	if ok && time.Since(cached.at) < s.ttl {
+		return cached.price, nil
+	}
+
+	// price0 is the price of one whole token0 in whole token1.
+	var price0 *big.Float
+	switch p.kind {
+	case "v2":
+		out, err := callPair(ctx, s.caller, p.address, "getReserves")
+		if err != nil {
+			return 0, err
+		}
+		r0, r1 := out[0].(*big.Int), out[1].(*big.Int)
+		if r0.Sign() == 0 || r1.Sign() == 0 {
+			return 0, errNoLiquidity
+		}
+		price0 = new(big.Float).Quo(new(big.Float).SetInt(r1), new(big.Float).SetInt(r0))
+	case "v3":
+		out, err := callPair(ctx, s.caller, p.address, "slot0")
+		if err != nil {
+			return 0, err
+		}
+		sqrtPrice := out[0].(*big.Int)
+		liq, err := callPair(ctx, s.caller, p.address, "liquidity")
+		if err != nil {
+			return 0, err
+		}
+		if sqrtPrice.Sign() == 0 || liq[0].(*big.Int).Sign() == 0 {
+			return 0, errNoLiquidity
+		}
+		// (sqrtPriceX96 / 2^96)^2 is the raw token1/token0 ratio.
+		ratio := new(big.Float).SetPrec(256).SetInt(sqrtPrice)
+		ratio.Quo(ratio, new(big.Float).SetInt(new(big.Int).Lsh(big.NewInt(1), 96)))
+		price0 = ratio.Mul(ratio, ratio)
+	}
+	// Adjust the raw ratio for the decimals of both tokens.
+	scale := new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(p.decimals0)), nil))
+	price0.Mul(price0, scale)
+	price0.Quo(price0, new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(p.decimals1)), nil)))
+
+	price, _ := price0.Float64()
+	if token == p.token1 {
+		price = 1 / price
+	}
+	s.mu.Lock()
+	s.cache[token] = cachedPrice{price: price, at: time.Now()}
+	s.mu.Unlock()
+	return price, nil
+}
+
+// recordingCaller wraps a ContractCaller and remembers every response so
+// that a pricing session can be replayed offline with replayCaller.
+type recordingCaller struct {
+	inner bind.ContractCaller
+	mu    sync.Mutex
+	calls map[string]hexutil.Bytes
+}
+
+func callKey(to *common.Address, data []byte) string {
+	return strings.ToLower(to.Hex()) + ":" + hexutil.Encode(data)
+}
+
+func (r *recordingCaller) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	code, err := r.inner.CodeAt(ctx, contract, blockNumber)
+	if err == nil {
+		r.mu.Lock()
+		r.calls[callKey(&contract, nil)] = code
+		r.mu.Unlock()
+	}
+	return code, err
+}
+
+func (r *recordingCaller) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	out, err := r.inner.CallContract(ctx, call, blockNumber)
+	if err == nil {
+		r.mu.Lock()
+		r.calls[callKey(call.To, call.Data)] = out
+		r.mu.Unlock()
+	}
+	return out, err
+}
+
+// replayCaller answers eth_call and eth_getCode from a recording.
+type replayCaller map[string]hexutil.Bytes
+
+func (r replayCaller) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	if code, ok := r[callKey(&contract, nil)]; ok {
+		return code, nil
+	}
+	return nil, nil
+}
+
+func (r replayCaller) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	if out, ok := r[callKey(call.To, call.Data)]; ok {
+		return out, nil
+	}
+	return nil, errors.New("execution reverted: call not in recording")
+}
+
+// parseAddressList parses a comma-separated list of addresses.
+func parseAddressList(list string) ([]common.Address, error) {
+	var addrs []common.Address
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !common.IsHexAddress(item) {
+			return nil, fmt.Errorf("invalid address %q", item)
+		}
+		addrs = append(addrs, common.HexToAddress(item))
+	}
+	return addrs, nil
+}
+
+// runPrice implements the `price` subcommand, which prints a token's price
+// from a DEX pair and can record the responses for offline replay.
+func runPrice(args []string) {
+	fs := flag.NewFlagSet("price", flag.ExitOnError)
+	rpcURL := fs.String("rpc", infuraURL, "Ethereum RPC endpoint")
+	token := fs.String("token", contractAddress, "Token to price")
+	pair := fs.String("pair", "", "Uniswap V2 pair or V3 pool trading the token against -quote")
+	pairType := fs.String("pairType", "auto", "Pair type: auto, v2 or v3")
+	quote := fs.String("quote", wethAddress, "Quote token the pair trades against")
+	record := fs.String("record", "", "Write the RPC responses used to this file")
+	replay := fs.String("replay", "", "Answer calls from a file written by -record instead of the RPC")
+	parseCommand(fs, args)
+
+	var caller bind.ContractCaller
+	var recorder *recordingCaller
+	if *replay != "" {
+		var calls replayCaller
+		if err := readJSONFile(*replay, &calls); err != nil {
+			logger.Fatalf("Failed to read recording: %v", err)
+		}
+		caller = calls
+	} else {
+		client, err := ethclient.Dial(*rpcURL)
+		if err != nil {
+			logger.Fatalf("Failed to connect to the Ethereum client: %v", err)
+		}
+		caller = client
+		if *record != "" {
+			recorder = &recordingCaller{inner: client, calls: make(map[string]hexutil.Bytes)}
+			caller = recorder
+		}
+	}
+
+	ctx := context.Background()
+	source, err := newPairPriceSource(ctx, caller, common.HexToAddress(*quote), []common.Address{common.HexToAddress(*pair)}, *pairType)
+	if err != nil {
+		logger.Fatalf("Failed to set up price source: %v", err)
+	}
+	price, err := source.TokenPrice(ctx, common.HexToAddress(*token))
+	if err != nil {
+		logger.Fatalf("Failed to get price: %v", err)
+	}
+	fmt.Printf("1 token = %.12g ETH\n", price)
+	if recorder != nil {
+		if err := writeJSONFile(*record, recorder.calls); err != nil {
+			logger.Fatalf("Failed to write recording: %v", err)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+var (
+	testToken = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	testWETH  = common.HexToAddress(wethAddress)
+	testPair  = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+)
+
+// pairFixture is a recording of a pair between token0 and token1. Methods
+// without a value are absent from the recording and revert on replay.
+type pairFixture struct {
+	token0, token1       common.Address
+	decimals0, decimals1 uint8
+	reserve0, reserve1   *big.Int // V2
+	sqrtPriceX96, liq    *big.Int // V3
+}
+
+func (f pairFixture) recording(t *testing.T) replayCaller {
+	t.Helper()
+	r := make(replayCaller)
+	add := func(to common.Address, method string, values ...interface{}) {
+		out, err := pairABI.Methods[method].Outputs.Pack(values...)
+		if err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		r[callKey(&to, pairABI.Methods[method].ID)] = out
+	}
+	add(testPair, "token0", f.token0)
+	add(testPair, "token1", f.token1)
+	add(f.token0, "decimals", f.decimals0)
+	add(f.token1, "decimals", f.decimals1)
+	if f.reserve0 != nil {
+		add(testPair, "getReserves", f.reserve0, f.reserve1, uint32(0))
+	}
+	if f.sqrtPriceX96 != nil {
+		add(testPair, "slot0", f.sqrtPriceX96, big.NewInt(0), uint16(0), uint16(0), uint16(0), uint8(0), true)
+		add(testPair, "liquidity", f.liq)
+	}
+	return r
+}
+
+// units is n whole tokens of the given decimals.
+func units(n float64, decimals int) *big.Int {
+	v, _ := new(big.Float).Mul(big.NewFloat(n), new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))).Int(nil)
+	return v
+}
+
+// sqrtX96 is sqrt(ratio) * 2^96 for a raw token1/token0 ratio.
+func sqrtX96(ratio float64) *big.Int {
+	v, _ := new(big.Float).Mul(big.NewFloat(math.Sqrt(ratio)), new(big.Float).SetInt(new(big.Int).Lsh(big.NewInt(1), 96))).Int(nil)
+	return v
+}
+
+func priceOf(t *testing.T, f pairFixture, kind string) (float64, error) {
+	t.Helper()
+	s, err := newPairPriceSource(context.Background(), f.recording(t), testWETH, []common.Address{testPair}, kind)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.TokenPrice(context.Background(), testToken)
+}
+
+func TestPairPrice(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		fixture pairFixture
+		want    float64
+	}{
+		{"v2", pairFixture{token0: testToken, token1: testWETH, decimals0: 18, decimals1: 18,
+			reserve0: units(1000, 18), reserve1: units(2, 18)}, 0.002},
+		{"v2 inverted", pairFixture{token0: testWETH, token1: testToken, decimals0: 18, decimals1: 18,
+			reserve0: units(2, 18), reserve1: units(1000, 18)}, 0.002},
+		{"v2 6 decimals", pairFixture{token0: testToken, token1: testWETH, decimals0: 6, decimals1: 18,
+			reserve0: units(1000, 6), reserve1: units(2, 18)}, 0.002},
+		{"v2 inverted 8 decimals", pairFixture{token0: testWETH, token1: testToken, decimals0: 18, decimals1: 8,
+			reserve0: units(3, 18), reserve1: units(1500, 8)}, 0.002},
+		{"v3", pairFixture{token0: testToken, token1: testWETH, decimals0: 18, decimals1: 18,
+			sqrtPriceX96: sqrtX96(4), liq: big.NewInt(1e18)}, 4},
+		{"v3 inverted", pairFixture{token0: testWETH, token1: testToken, decimals0: 18, decimals1: 18,
+			sqrtPriceX96: sqrtX96(4), liq: big.NewInt(1e18)}, 0.25},
+		// One whole 6-decimal token for 4 WETH is a raw ratio of 4e12.
+		{"v3 6 decimals", pairFixture{token0: testToken, token1: testWETH, decimals0: 6, decimals1: 18,
+			sqrtPriceX96: sqrtX96(4e12), liq: big.NewInt(1e18)}, 4},
+		{"v3 inverted 6 decimals", pairFixture{token0: testWETH, token1: testToken, decimals0: 18, decimals1: 6,
+			sqrtPriceX96: sqrtX96(4e-12), liq: big.NewInt(1e18)}, 0.25},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			// The type is detected from the methods the pair answers.
+			got, err := priceOf(t, c.fixture, "auto")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(got-c.want) > c.want*1e-9 {
+				t.Fatalf("price %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestPairPriceNoLiquidity(t *testing.T) {
+	for name, f := range map[string]pairFixture{
+		"v2 empty reserve": {token0: testToken, token1: testWETH, decimals0: 18, decimals1: 18,
+			reserve0: units(1000, 18), reserve1: new(big.Int)},
+		"v3 no liquidity": {token0: testToken, token1: testWETH, decimals0: 18, decimals1: 18,
+			sqrtPriceX96: sqrtX96(4), liq: new(big.Int)},
+		"v3 uninitialized": {token0: testToken, token1: testWETH, decimals0: 18, decimals1: 18,
+			sqrtPriceX96: new(big.Int), liq: big.NewInt(1)},
+	} {
+		if _, err := priceOf(t, f, "auto"); !errors.Is(err, errNoLiquidity) {
+			t.Errorf("%s: got %v, want errNoLiquidity", name, err)
+		}
+	}
+}
+
+func TestPairPriceSourceErrors(t *testing.T) {
+	f := pairFixture{token0: testToken, token1: testWETH, decimals0: 18, decimals1: 18}
+	if _, err := newPairPriceSource(context.Background(), f.recording(t), testWETH, []common.Address{testPair}, "auto"); err == nil {
+		t.Error("pair answering neither getReserves nor slot0 accepted")
+	}
+	other := pairFixture{token0: testToken, token1: common.HexToAddress("0x01"), decimals0: 18, decimals1: 18, reserve0: big.NewInt(1), reserve1: big.NewInt(1)}
+	if _, err := newPairPriceSource(context.Background(), other.recording(t), testWETH, []common.Address{testPair}, "v2"); err == nil {
+		t.Error("pair not trading against the quote accepted")
+	}
+}
+
+func TestPriceRecordReplay(t *testing.T) {
+	f := pairFixture{token0: testToken, token1: testWETH, decimals0: 18, decimals1: 18,
+		reserve0: units(1000, 18), reserve1: units(2, 18)}
+	recorder := &recordingCaller{inner: f.recording(t), calls: make(map[string]hexutil.Bytes)}
+	s, err := newPairPriceSource(context.Background(), recorder, testWETH, []common.Address{testPair}, "v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := s.TokenPrice(context.Background(), testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "recording.json")
+	if err := writeJSONFile(path, recorder.calls); err != nil {
+		t.Fatal(err)
+	}
+	var replay replayCaller
+	if err := readJSONFile(path, &replay); err != nil {
+		t.Fatal(err)
+	}
+	s, err = newPairPriceSource(context.Background(), replay, testWETH, []common.Address{testPair}, "v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.TokenPrice(context.Background(), testToken); err != nil || got != want {
+		t.Fatalf("replayed price %v, %v; recorded %v", got, err, want)
+	}
+}
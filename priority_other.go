@@ -0,0 +1,9 @@
+//go:build !unix && !windows
+
+package main
+
+import "errors"
+
+func lowerPriority(n int) error {
+	return errors.New("changing the process priority is not supported on this platform")
+}
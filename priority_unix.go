@@ -0,0 +1,30 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// lowerPriority sets the nice value of the process to n. On Linux the
+// nice value belongs to each thread, so every thread is changed; threads
+// started later inherit it.
+func lowerPriority(n int) error {
+	entries, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return unix.Setpriority(unix.PRIO_PROCESS, 0, n)
+	}
+	for _, e := range entries {
+		tid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		if err := unix.Setpriority(unix.PRIO_PROCESS, tid, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
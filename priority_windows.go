@@ -0,0 +1,13 @@
+package main
+
+import "golang.org/x/sys/windows"
+
+// lowerPriority moves the process to a lower priority class: below normal
+// for nice values up to 9, idle from 10.
+func lowerPriority(n int) error {
+	class := uint32(windows.BELOW_NORMAL_PRIORITY_CLASS)
+	if n >= 10 {
+		class = windows.IDLE_PRIORITY_CLASS
+	}
+	return windows.SetPriorityClass(windows.CurrentProcess(), class)
+}
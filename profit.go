@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"Powerc20Worker/miner"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// priceSource provides the value of minted tokens.
+type priceSource interface {
+	// TokenPrice returns the price of one whole token in ETH.
+	TokenPrice(ctx context.Context, token common.Address) (float64, error)
+}
+
+// fixedPrice is an operator-supplied token price in ETH.
+type fixedPrice float64
+
+func (p fixedPrice) TokenPrice(ctx context.Context, token common.Address) (float64, error) {
+	return float64(p), nil
+}
+
+// profitEstimate is the expected economics of one mint, all values in ETH.
+type profitEstimate struct {
+	Reward          float64 // value of the tokens paid by one mint
+	GasCost         float64 // fee of the mine transaction at current prices
+	RunCost         float64 // operating cost until a solution is expected
+	ExpectedSeconds float64 // expected time to a solution at the measured rate
+}
+
+// Profit is the expected value of continuing to mine.
+func (e *profitEstimate) Profit() float64 {
+	return e.Reward - e.GasCost - e.RunCost
+}
+
+func (e *profitEstimate) String() string {
+	return fmt.Sprintf("reward %.6f ETH, gas %.6f ETH, running cost %.6f ETH over %s", e.Reward, e.GasCost, e.RunCost, formatSeconds(e.ExpectedSeconds))
+}
+
+// formatSeconds renders a possibly infinite duration in seconds.
+func formatSeconds(seconds float64) string {
+	if math.IsInf(seconds, 0) || math.IsNaN(seconds) || seconds > float64(math.MaxInt64/int64(time.Second)) {
+		return "∞"
+	}
+	return time.Duration(seconds * float64(time.Second)).Round(time.Second).String()
+}
+
+// profitModel decides whether mining a contract is worth it and pauses it
+// or holds its solutions while it is not.
+type profitModel struct {
+	client      *ethclient.Client
+	prices      priceSource
+	hashrate    func() float64
+	mode        string  // "pause" or "hold"
+	costPerHour float64 // ETH
+	minProfit   float64 // ETH
+	// resumeMargin is the share of the reward the expected profit must
+	// exceed minProfit by before an unprofitable contract resumes, so one
+	// close to the threshold does not flap.
+	resumeMargin float64
+
+	// mintGas is the gas a mine transaction uses, refined from receipts.
+	mintGas atomic.Uint64
+
+	mu        sync.Mutex
+	rates     map[common.Address]*rateSample
+	totalRate float64 // last non-zero hashrate of the miner
+}
+
+// rateSample is the hash count of a contract when it was last evaluated and
+// the last non-zero rate measured for it.
+type rateSample struct {
+	hashes uint64
+	at     time.Time
+	rate   float64
+}
+
+func newProfitModel(client *ethclient.Client, prices priceSource, hashrate func() float64, mode string, mintGas uint64, costPerHour, minProfit, resumeMargin float64) (*profitModel, error) {
+	if mode != "pause" && mode != "hold" {
+		return nil, fmt.Errorf("unknown profitability mode %q", mode)
+	}
+	if prices == nil {
+		return nil, errors.New("profitability needs a token price")
+	}
+	m := &profitModel{
+		client:       client,
+		prices:       prices,
+		hashrate:     hashrate,
+		mode:         mode,
+		costPerHour:  costPerHour,
+		minProfit:    minProfit,
+		resumeMargin: resumeMargin,
+		rates:        make(map[common.Address]*rateSample),
+	}
+	m.mintGas.Store(mintGas)
+	return m, nil
+}
+
+// observeGas records the gas used by a confirmed mine transaction.
+func (m *profitModel) observeGas(used uint64) {
+	if used > 0 {
+		m.mintGas.Store(used)
+	}
+}
+
+// weiToEther converts a wei amount to ETH as a float.
+func weiToEther(wei *big.Int) float64 {
+	f, _ := new(big.Float).Quo(new(big.Float).SetInt(wei), big.NewFloat(1e18)).Float64()
+	return f
+}
+
+// contractRate returns the hashrate spent on the contract at addr, which had
+// done hashes by now. A paused contract keeps the last rate measured while
+// it was mined, so its cost does not drop to zero and resume it. Until a
+// contract has been measured the last non-zero rate of the whole miner is
+// used.
+func (m *profitModel) contractRate(addr common.Address, hashes uint64, now time.Time) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if total := m.hashrate(); total > 0 {
+		m.totalRate = total
+	}
+	s := m.rates[addr]
+	if s == nil {
+		m.rates[addr] = &rateSample{hashes: hashes, at: now}
+		return m.totalRate
+	}
+	if elapsed := now.Sub(s.at).Seconds(); elapsed > 0 && hashes > s.hashes {
+		s.rate = float64(hashes-s.hashes) / elapsed
+	}
+	s.hashes, s.at = hashes, now
+	if s.rate > 0 {
+		return s.rate
+	}
+	return m.totalRate
+}
+
+// unprofitable returns why mining with estimate e does not pay, or "" if it
+// does. A contract that is already unprofitable must clear minProfit by
+// resumeMargin of the reward to resume.
+func (m *profitModel) unprofitable(e *profitEstimate, paused bool) string {
+	threshold := m.minProfit
+	if paused {
+		threshold += m.resumeMargin * e.Reward
+	}
+	if e.Profit() < threshold {
+		return fmt.Sprintf("expected profit %.6f ETH is below %.6f ETH (%s)", e.Profit(), threshold, e)
+	}
+	return ""
+}
+
+// estimate computes the expected economics of the next mint on site.
+func (m *profitModel) estimate(ctx context.Context, site *miner.Contract) (*profitEstimate, error) {
+	reward, target, decimals := site.Reward(), site.Target(), site.Decimals()
+	if reward == nil || target == nil {
+		return nil, errors.New("mint reward or target not known yet")
+	}
+
+	price, err := m.prices.TokenPrice(ctx, site.Address())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token price: %w", err)
+	}
+	tokens, _ := new(big.Float).Quo(new(big.Float).SetInt(reward), new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))).Float64()
+
+	head, err := m.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest header: %v", err)
+	}
+	tip, err := m.client.SuggestGasTipCap(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to suggest gas tip: %v", err)
+	}
+	gasPrice := new(big.Int).Set(tip)
+	if head.BaseFee != nil {
+		gasPrice.Add(gasPrice, head.BaseFee)
+	}
+	gasCost := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(m.mintGas.Load()))
+
+	e := &profitEstimate{
+		Reward:          tokens * price,
+		GasCost:         weiToEther(gasCost),
+		ExpectedSeconds: math.Inf(1),
+	}
+	if rate := m.contractRate(site.Address(), site.Hashes(), time.Now()); rate > 0 {
+		e.ExpectedSeconds = miner.ExpectedHashes(target) / rate
+		e.RunCost = m.costPerHour * e.ExpectedSeconds / 3600
+	}
+	return e, nil
+}
+
+// evaluate refreshes the profitability of every site and calls onChange
+// when any of them flips.
+func (m *profitModel) evaluate(ctx context.Context, sites []*miner.Contract, onChange func()) {
+	changed := false
+	for _, site := range sites {
+		e, err := m.estimate(ctx, site)
+		if errors.Is(err, errNoLiquidity) {
+			profitLog.Warnf("Cannot value tokens of %s: %v", site.Name(), err)
+			continue
+		}
+		if err != nil {
+			profitLog.Debugf("Cannot estimate profitability of %s: %v", site.Name(), err)
+			continue
+		}
+		reason := m.unprofitable(e, site.Unprofitable() != "")
+		was := site.SetUnprofitable(reason)
+
+		switch {
+		case was == "" && reason != "":
+			withEvent(profitLog, "unprofitable", "contract", site.Address()).Warnf("Mining %s is unprofitable, %s: %s", site.Name(), m.action(), reason)
+			changed = true
+		case was != "" && reason == "":
+			withEvent(profitLog, "profitable", "contract", site.Address()).Infof("Mining %s is profitable again, resuming: expected profit %.6f ETH (%s)", site.Name(), e.Profit(), e)
+			changed = true
+		}
+	}
+	if changed {
+		onChange()
+	}
+}
+
+func (m *profitModel) action() string {
+	if m.mode == "hold" {
+		return "holding solutions"
+	}
+	return "pausing"
+}
+
+// run re-evaluates profitability every interval.
+func (m *profitModel) run(ctx context.Context, sites []*miner.Contract, interval time.Duration, onChange func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		m.evaluate(ctx, sites, onChange)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// parseTokenPrice parses -tokenPrice; an empty value means no price.
+func parseTokenPrice(s string) (priceSource, error) {
+	if s == "" {
+		return nil, nil
+	}
+	price, err := strconv.ParseFloat(s, 64)
+	if err != nil || price < 0 {
+		return nil, fmt.Errorf("invalid token price %q", s)
+	}
+	return fixedPrice(price), nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestContractRateKeptWhilePaused(t *testing.T) {
+	total := 0.0
+	m, err := newProfitModel(nil, fixedPrice(1), func() float64 { return total }, "pause", 100000, 1, 0, 0.05)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := common.HexToAddress("0x0a"), common.HexToAddress("0x0b")
+	start := time.Unix(1700000000, 0)
+
+	total = 3000
+	if rate := m.contractRate(a, 0, start); rate != 3000 {
+		t.Fatalf("unmeasured contract: rate %v, want the miner's 3000", rate)
+	}
+	m.contractRate(b, 0, start)
+	// a gets a third of the hashes, b the rest.
+	if rate := m.contractRate(a, 10000, start.Add(10*time.Second)); rate != 1000 {
+		t.Fatalf("rate of a %v, want 1000", rate)
+	}
+	if rate := m.contractRate(b, 20000, start.Add(10*time.Second)); rate != 2000 {
+		t.Fatalf("rate of b %v, want 2000", rate)
+	}
+	// Paused, a does no hashes and the miner's rate drops, yet its cost
+	// is still based on the rate it had.
+	total = 0
+	if rate := m.contractRate(a, 10000, start.Add(20*time.Second)); rate != 1000 {
+		t.Fatalf("paused contract: rate %v, want the last measured 1000", rate)
+	}
+}
+
+func TestUnprofitableHysteresis(t *testing.T) {
+	m, err := newProfitModel(nil, fixedPrice(1), func() float64 { return 0 }, "pause", 100000, 1, 0.01, 0.05)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Reward 1 ETH: pausing below 0.01 ETH, resuming only above 0.06 ETH.
+	for _, c := range []struct {
+		profit float64
+		paused bool
+		want   bool
+	}{
+		{0.005, false, true},
+		{0.02, false, false},
+		{0.02, true, true},
+		{0.059, true, true},
+		{0.061, true, false},
+	} {
+		e := &profitEstimate{Reward: 1, GasCost: 1 - c.profit}
+		if got := m.unprofitable(e, c.paused) != ""; got != c.want {
+			t.Errorf("profit %v, paused %v: unprofitable %v, want %v", c.profit, c.paused, got, c.want)
+		}
+	}
+}
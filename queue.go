@@ -0,0 +1,490 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"Powerc20Worker/miner"
+
+	"github.com/ethereum/go-ethereum"
+	gethabi "github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// queuedSolution is a found nonce waiting to be submitted, together with
+// the job it solves.
+type queuedSolution struct {
+	Contract   common.Address `json:"contract"`
+	Sender     common.Address `json:"sender"`
+	Challenge  *hexutil.Big   `json:"challenge"`
+	Difficulty *hexutil.Big   `json:"difficulty"`
+	Nonce      *hexutil.Big   `json:"nonce"`
+	Digest     common.Hash    `json:"digest"`
+	FoundAt    time.Time      `json:"foundAt"`
+	// TxHash is the mine transaction sent for the solution and not yet
+	// confirmed when the miner stopped; it is followed up on the next start.
+	TxHash *common.Hash `json:"txHash,omitempty"`
+}
+
+// solutionQueue is a file-backed list of solutions waiting for submission.
+// It is rewritten on every change so that solutions survive a restart.
+type solutionQueue struct {
+	path   string
+	mu     sync.Mutex
+	items  []*queuedSolution
+	notify chan struct{}
+}
+
+// loadSolutionQueue opens the queue stored at path. An empty path keeps the
+// queue in memory only.
+func loadSolutionQueue(path string) (*solutionQueue, error) {
+	q := &solutionQueue{path: path, notify: make(chan struct{}, 1)}
+	if path != "" {
+		if err := readJSONFile(path, &q.items); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to load solution queue: %v", err)
+		}
+	}
+	return q, nil
+}
+
+// save persists the queue; the caller must hold q.mu.
+func (q *solutionQueue) save() {
+	if q.path == "" {
+		return
+	}
+	if err := writeJSONFile(q.path, q.items); err != nil {
+		submitLog.Errorf("Failed to persist solution queue: %v", err)
+	}
+}
+
+// push adds a solution and wakes the submitter.
+func (q *solutionQueue) push(s *queuedSolution) {
+	q.mu.Lock()
+	q.items = append(q.items, s)
+	q.save()
+	q.mu.Unlock()
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// remove drops s from the queue.
+func (q *solutionQueue) remove(s *queuedSolution) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, item := range q.items {
+		if item == s {
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			q.save()
+			return
+		}
+	}
+}
+
+// update persists a change to one of the queued solutions.
+func (q *solutionQueue) update(s *queuedSolution, change func(*queuedSolution)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	change(s)
+	q.save()
+}
+
+// pending returns a copy of the queued solutions, oldest first.
+func (q *solutionQueue) pending() []*queuedSolution {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]*queuedSolution(nil), q.items...)
+}
+
+// Len returns the number of queued solutions.
+func (q *solutionQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// submitter drains the solution queue whenever fees are acceptable,
+// re-validating every solution against the contract first.
+type submitter struct {
+	client      *ethclient.Client
+	auth        *bind.TransactOpts
+	queue       *solutionQueue
+	sites       map[common.Address]*miner.Contract
+	profit      *profitModel
+	seller      *seller        // sells part of every mint, nil to keep the tokens
+	policy      *signingPolicy // settled with the fee of every receipt, may be nil
+	maxGasPrice *big.Int       // wei, nil for no limit
+	interval    time.Duration
+
+	waiting  bool        // whether the last pass was deferred because of fees
+	stopping atomic.Bool // set on shutdown: no new transactions are sent
+
+	sendMu sync.Mutex // held while a transaction is signed and sent
+
+	mu        sync.Mutex
+	inflight  []*pendingTx
+	confirmed int
+	reverted  int
+}
+
+// pendingTx is a sent transaction waiting for its receipt.
+type pendingTx struct {
+	Hash     common.Hash    `json:"hash"`
+	Contract common.Address `json:"contract"`
+	Kind     string         `json:"kind"`
+	MaxFee   string         `json:"maxFee"` // ETH
+	SentAt   time.Time      `json:"sentAt"`
+}
+
+// track records tx as in flight until the returned function is called
+// with its receipt, or nil if it was not mined. The receipt settles the
+// fee the signing policy reserved for tx.
+func (s *submitter) track(tx *pendingTx) func(*types.Receipt) {
+	s.mu.Lock()
+	s.inflight = append(s.inflight, tx)
+	s.mu.Unlock()
+	return func(receipt *types.Receipt) {
+		if receipt != nil && s.policy != nil {
+			s.policy.settle(receipt)
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for i, item := range s.inflight {
+			if item == tx {
+				s.inflight = append(s.inflight[:i], s.inflight[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// pendingTxs returns the transactions sent but not yet mined.
+func (s *submitter) pendingTxs() []*pendingTx {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*pendingTx(nil), s.inflight...)
+}
+
+// stop makes the submitter send no further transactions; the ones in
+// flight are still followed until run's context is done.
+func (s *submitter) stop() {
+	s.stopping.Store(true)
+}
+
+// setMaxGasPrice changes the -maxGasPrice limit.
+func (s *submitter) setMaxGasPrice(limit *big.Int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxGasPrice = limit
+}
+
+// outcomes returns how many mine transactions were confirmed and reverted.
+func (s *submitter) outcomes() (confirmed, reverted int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.confirmed, s.reverted
+}
+
+// run processes the queue every interval and whenever a solution is added.
+// It returns errSignerRejected if the signer refuses a transaction.
+func (s *submitter) run(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if err := s.processSafe(ctx); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-s.queue.notify:
+		}
+	}
+}
+
+// supervise runs the submitter until ctx is done, restarting it with
+// backoff after a panic or an error other than errSignerRejected, which is
+// sent on errs because retrying cannot fix it.
+func (s *submitter) supervise(ctx context.Context, backoff time.Duration, errs chan<- error) {
+	delay := backoff
+	for {
+		err := s.run(ctx)
+		if err == nil {
+			return
+		}
+		if errors.Is(err, errSignerRejected) {
+			select {
+			case errs <- err:
+			case <-ctx.Done():
+			}
+			return
+		}
+		withEvent(submitLog, "submitter_failed").Errorf("Submitter failed, restarting in %s: %v", delay, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, time.Minute)
+	}
+}
+
+// processSafe is process with a panic returned as an error that carries
+// the stack.
+func (s *submitter) processSafe(ctx context.Context) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("panic: %v\n%s", v, debug.Stack())
+		}
+	}()
+	return s.process(ctx)
+}
+
+// gasPrice returns the price a transaction sent now would pay per gas.
+func (s *submitter) gasPrice(ctx context.Context) (*big.Int, error) {
+	head, err := s.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	tip, err := s.client.SuggestGasTipCap(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if head.BaseFee == nil {
+		return s.client.SuggestGasPrice(ctx)
+	}
+	return tip.Add(tip, head.BaseFee), nil
+}
+
+func (s *submitter) process(ctx context.Context) error {
+	items := s.queue.pending()
+	if len(items) == 0 || s.stopping.Load() {
+		return nil
+	}
+	// Transactions sent before a restart are followed up first; they need
+	// no gas check.
+	for _, item := range items {
+		if item.TxHash == nil {
+			continue
+		}
+		if site := s.sites[item.Contract]; site != nil {
+			keep, err := s.follow(ctx, site, item)
+			if err != nil {
+				return err
+			}
+			if !keep {
+				s.queue.remove(item)
+			}
+		}
+	}
+	s.mu.Lock()
+	limit := s.maxGasPrice
+	s.mu.Unlock()
+	if limit != nil {
+		price, err := s.gasPrice(ctx)
+		if err != nil {
+			submitLog.Warnf("Failed to get gas price: %v", err)
+			return nil
+		}
+		if price.Cmp(limit) > 0 {
+			if !s.waiting {
+				withEvent(submitLog, "gas_hold").Infof("Gas price %s gwei is above %s gwei, holding %d solution(s)", formatGwei(price), formatGwei(limit), len(items))
+			}
+			s.waiting = true
+			return nil
+		}
+		if s.waiting {
+			withEvent(submitLog, "gas_ok").Infof("Gas price %s gwei is acceptable again, submitting", formatGwei(price))
+		}
+		s.waiting = false
+	}
+
+	for _, item := range items {
+		if ctx.Err() != nil || s.stopping.Load() {
+			return nil
+		}
+		site := s.sites[item.Contract]
+		if site == nil || item.TxHash != nil {
+			continue // solution for a contract that is not being mined, or already sent
+		}
+		if site.Unprofitable() != "" && !site.PausesUnprofitable() {
+			continue // held until mining is profitable again
+		}
+		if reason, err := s.validate(ctx, site, item); err != nil {
+			submitLog.Warnf("Failed to validate queued solution for %s: %v", site.Name(), err)
+			continue
+		} else if reason != "" {
+			withEvent(submitLog, "solution_stale", "contract", site.Address(), "challenge", item.Challenge.ToInt(), "nonce", item.Nonce.ToInt()).Warnf("Discarding stale solution %v for %s: %s", item.Nonce, site.Name(), reason)
+			metrics.add("powerc20_solutions_stale_total", 1, "contract", site.Address().Hex())
+			s.queue.remove(item)
+			continue
+		}
+		keep, err := s.submit(ctx, site, item)
+		if err != nil {
+			return err
+		}
+		if !keep {
+			s.queue.remove(item)
+		}
+	}
+	return nil
+}
+
+// validate checks a queued solution against the contract's current state.
+// It returns a non-empty reason if the solution can no longer succeed.
+func (s *submitter) validate(ctx context.Context, site *miner.Contract, item *queuedSolution) (string, error) {
+	job := site.CurrentJob()
+	if job == nil {
+		return "", errors.New("no current job")
+	}
+	exhausted := site.Exhausted()
+	if exhausted != "" {
+		return exhausted, nil
+	}
+	if item.Sender != s.auth.From {
+		return fmt.Sprintf("found for %s, submitting as %s", item.Sender.Hex(), s.auth.From.Hex()), nil
+	}
+	if job.Challenge.Cmp(item.Challenge.ToInt()) != 0 {
+		return fmt.Sprintf("challenge changed from %d to %d", item.Challenge.ToInt(), job.Challenge), nil
+	}
+	if miner.SolutionDigest(site.Scheme(), job, item.Sender, item.Nonce.ToInt()).Big().Cmp(site.Scheme().Target(job)) >= 0 {
+		return fmt.Sprintf("no longer meets difficulty %d", job.Difficulty), nil
+	}
+	if checker, ok := site.Scheme().(miner.NonceChecker); ok {
+		used, err := checker.NonceUsed(ctx, s.client, site.Address(), item.Sender, item.Nonce.ToInt())
+		if err != nil {
+			return "", err
+		}
+		if used {
+			return "nonce already used", nil
+		}
+	}
+	return "", nil
+}
+
+// submit sends the transaction for item and waits for its receipt. It
+// reports whether the solution should stay queued, which is only the case
+// when the transaction could not be sent.
+func (s *submitter) submit(ctx context.Context, site *miner.Contract, item *queuedSolution) (bool, error) {
+	job := site.CurrentJob()
+	data, err := site.Scheme().SubmitData(job, item.Nonce.ToInt(), item.Digest)
+	if err != nil {
+		submitLog.Errorf("Failed to encode solution: %v", err)
+		return false, nil
+	}
+	withEvent(submitLog, "submitting", "contract", site.Address(), "challenge", item.Challenge.ToInt(), "nonce", item.Nonce.ToInt()).Infof("Submitting mining transaction with nonce to %s...", site.Name())
+	s.sendMu.Lock()
+	tx, err := bind.NewBoundContract(site.Address(), gethabi.ABI{}, s.client, s.client, s.client).RawTransact(s.auth, data)
+	s.sendMu.Unlock()
+	if errors.Is(err, errSignerRejected) {
+		return true, err
+	}
+	if errors.Is(err, errPolicyRejected) {
+		submitLog.Warnf("Mine transaction for %s was not signed: %v", site.Name(), err)
+		return true, nil
+	}
+	if err != nil {
+		submitLog.Errorf("Failed to submit mine transaction: %v", err)
+		return true, nil
+	}
+	metrics.add("powerc20_transactions_submitted_total", 1, "contract", site.Address().Hex(), "kind", "mine")
+	withEvent(submitLog, "tx_submitted", "contract", site.Address(), "challenge", item.Challenge.ToInt(), "nonce", item.Nonce.ToInt(), "tx_hash", tx.Hash()).Infof("Mining transaction sent to %s, waiting for receipt...", site.Name())
+	// Remember the transaction so that a restart follows it up instead of
+	// sending the solution again.
+	hash := tx.Hash()
+	s.queue.update(item, func(item *queuedSolution) { item.TxHash = &hash })
+	return s.await(ctx, site, item, tx)
+}
+
+// follow picks up the transaction a previous run sent for item. A
+// transaction the node no longer knows is forgotten so that the solution is
+// validated and sent again.
+func (s *submitter) follow(ctx context.Context, site *miner.Contract, item *queuedSolution) (bool, error) {
+	tx, _, err := s.client.TransactionByHash(ctx, *item.TxHash)
+	if errors.Is(err, ethereum.NotFound) {
+		withEvent(submitLog, "tx_dropped", "contract", site.Address(), "tx_hash", *item.TxHash).Warnf("Mining transaction %s for %s is unknown to the node, submitting the solution again", item.TxHash.Hex(), site.Name())
+		s.queue.update(item, func(item *queuedSolution) { item.TxHash = nil })
+		return true, nil
+	}
+	if err != nil {
+		submitLog.Warnf("Failed to look up mining transaction %s: %v", item.TxHash.Hex(), err)
+		return true, nil
+	}
+	withEvent(submitLog, "tx_resumed", "contract", site.Address(), "tx_hash", tx.Hash()).Infof("Following up mining transaction %s for %s sent before the restart", tx.Hash().Hex(), site.Name())
+	return s.await(ctx, site, item, tx)
+}
+
+// await waits for the receipt of the mine transaction tx sent for item.
+// It reports whether item should stay queued, which it does when waiting
+// was cut short, so that the transaction is followed up later.
+func (s *submitter) await(ctx context.Context, site *miner.Contract, item *queuedSolution, tx *types.Transaction) (bool, error) {
+	txLog := withEvent(submitLog, "tx_submitted", "contract", site.Address(), "challenge", item.Challenge.ToInt(), "nonce", item.Nonce.ToInt(), "tx_hash", tx.Hash())
+	done := s.track(&pendingTx{Hash: tx.Hash(), Contract: site.Address(), Kind: "mine", MaxFee: formatEther(maxFee(tx)), SentAt: time.Now()})
+	receipt, err := bind.WaitMined(ctx, s.client, tx)
+	done(receipt)
+	if err != nil {
+		if ctx.Err() != nil {
+			withEvent(submitLog, "tx_handed_off", "contract", site.Address(), "tx_hash", tx.Hash()).Warnf("Stopped waiting for mining transaction %s, it is followed up on the next start", tx.Hash().Hex())
+		} else {
+			submitLog.Errorf("Failed to mine the transaction %s: %v", tx.Hash().Hex(), err)
+		}
+		return true, nil
+	}
+	site.RequestRefresh()
+	recordReceipt("mine", site.Address(), receipt)
+	if s.profit != nil {
+		s.profit.observeGas(receipt.GasUsed)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		s.mu.Lock()
+		s.reverted++
+		s.mu.Unlock()
+		txLog.WithField("event", "tx_reverted").Errorf("Mining transaction reverted, Transaction Hash: %s", receipt.TxHash.Hex())
+		return false, nil
+	}
+	s.mu.Lock()
+	s.confirmed++
+	s.mu.Unlock()
+	reward, decimals := site.Reward(), site.Decimals()
+	if reward != nil {
+		tokens, _ := new(big.Float).Quo(new(big.Float).SetInt(reward), new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))).Float64()
+		metrics.add("powerc20_tokens_minted_total", tokens, "contract", site.Address().Hex())
+	}
+	txLog.WithField("event", "tx_confirmed").Infof("Mining transaction successfully confirmed, Transaction Hash: %s", receipt.TxHash.Hex())
+	if s.seller != nil {
+		s.seller.schedule(site)
+	}
+	return false, nil
+}
+
+// formatGwei renders wei as gwei for log messages.
+func formatGwei(wei *big.Int) string {
+	return new(big.Rat).SetFrac(wei, big.NewInt(1e9)).FloatString(2)
+}
+
+// parseGwei converts a decimal gwei amount to wei; an empty value means no
+// limit and returns nil.
+func parseGwei(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok || r.Sign() <= 0 {
+		return nil, fmt.Errorf("%q is not a valid gwei amount", s)
+	}
+	r.Mul(r, new(big.Rat).SetInt(big.NewInt(1e9)))
+	return new(big.Int).Quo(r.Num(), r.Denom()), nil
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+
+	"Powerc20Worker/miner"
+
+	gethabi "github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/crypto/sha3"
+)
+
+var selftestLog = newSubsystemLogger("selftest")
+
+// keccakVectors are published Keccak-256 digests, checking the hash
+// function itself.
+var keccakVectors = []struct {
+	input  string
+	digest string
+}{
+	{"", "0xc5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470"},
+	{"abc", "0x4e03657aea45a94fc7d47ba826c8d667c0d1e6e33a64a036ec44f58fa12d6c45"},
+}
+
+// preimageVectors are digests of keccak256(abi.encodePacked(challenge,
+// sender, nonce)) as the PoWERC20 contract computes them, covering zero,
+// short and full-width values. They were computed with an independent
+// Keccak implementation, not with this code.
+var preimageVectors = []struct {
+	challenge string
+	sender    string
+	nonce     string
+	digest    string
+}{
+	{"0x0", "0x0000000000000000000000000000000000000000", "0x0", "0x7733ef1f65c467ebbbb75072ade6f3677cc49a146089f0a95abd1e4015c837b9"},
+	{"0x1", "0x0000000000000000000000000000000000000001", "0x1", "0xe31382b762a33e568e1e9ef38d64f4a2b4dbb51ec0f79ec41779fc5be79ead32"},
+	{"0x2a", "0xca9b78435Be8267922E7Ac5cDE70401e7502c9cc", "0xdeadbeef", "0xc8495a03909dfc421ec5d7614f0dbf43957e29134fe5ffaa5246effa3d9d85af"},
+	{"0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", "0xffffffffffffffffffffffffffffffffffffffff", "0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", "0x9bf5833ddf4a8b9c5aed264abd3b0848061fa53cf2b3031c110c8f689c366294"},
+	{"0x8f5e2b6a0c39e3d1b7a24f6c85d90e13a7b4c2d6e8f01a3b5c7d9e1f2a4b6c8d", "0x1E4481159013D3Aa8dF7623Fc9B26daE5bcC0a73", "0x100000000000000000000000000000000", "0x9667dc981ff52e4eedfa1556f6ae6050e5508cc35292f4362453012f13879fa4"},
+}
+
+// encodePacked is a reference implementation of Solidity's
+// abi.encodePacked for the static types preimages are built from. It is
+// deliberately written against the ABI type system rather than shared with
+// the schemes so that the two can be compared.
+func encodePacked(args gethabi.Arguments, values ...interface{}) ([]byte, error) {
+	if len(args) != len(values) {
+		return nil, fmt.Errorf("%d values for %d arguments", len(values), len(args))
+	}
+	var out []byte
+	for i, arg := range args {
+		switch arg.Type.T {
+		case gethabi.UintTy:
+			v, ok := values[i].(*big.Int)
+			if !ok || v.Sign() < 0 || v.BitLen() > arg.Type.Size {
+				return nil, fmt.Errorf("argument %d: %v is not a uint%d", i, values[i], arg.Type.Size)
+			}
+			out = append(out, math.PaddedBigBytes(v, arg.Type.Size/8)...)
+		case gethabi.AddressTy:
+			v, ok := values[i].(common.Address)
+			if !ok {
+				return nil, fmt.Errorf("argument %d: %v is not an address", i, values[i])
+			}
+			out = append(out, v.Bytes()...)
+		case gethabi.FixedBytesTy:
+			v, ok := values[i].([32]byte)
+			if !ok || arg.Type.Size != 32 {
+				return nil, fmt.Errorf("argument %d: only bytes32 is supported", i)
+			}
+			out = append(out, v[:]...)
+		default:
+			return nil, fmt.Errorf("argument %d: unsupported type %s", i, arg.Type)
+		}
+	}
+	return out, nil
+}
+
+func mustType(t string) gethabi.Type {
+	typ, err := gethabi.NewType(t, "", nil)
+	if err != nil {
+		panic(err)
+	}
+	return typ
+}
+
+// referencePreimage packs the preimage of scheme the way its contract
+// would, independently of scheme.Preimage.
+func referencePreimage(scheme miner.Scheme, job *miner.Job, sender common.Address, nonce *big.Int) ([]byte, error) {
+	uint256 := gethabi.Argument{Type: mustType("uint256")}
+	address := gethabi.Argument{Type: mustType("address")}
+	switch s := scheme.(type) {
+	case *miner.PoWERC20Scheme:
+		return encodePacked(gethabi.Arguments{uint256, address, uint256}, job.Challenge, sender, nonce)
+	case *miner.ABIScheme:
+		var args gethabi.Arguments
+		var values []interface{}
+		for _, field := range s.Config().Preimage {
+			switch field {
+			case "challenge":
+				args, values = append(args, uint256), append(values, job.Challenge)
+			case "sender":
+				args, values = append(args, address), append(values, sender)
+			case "sender32":
+				// abi.encode pads an address to a full word.
+				args, values = append(args, uint256), append(values, new(big.Int).SetBytes(sender.Bytes()))
+			case "nonce":
+				args, values = append(args, uint256), append(values, nonce)
+			}
+		}
+		return encodePacked(args, values...)
+	}
+	return nil, fmt.Errorf("no reference packing for scheme %s", scheme.Name())
+}
+
+// referenceDigest hashes data with a fresh Keccak-256 state.
+func referenceDigest(data []byte) common.Hash {
+	h := sha3.NewLegacyKeccak256()
+	h.Write(data)
+	return common.BytesToHash(h.Sum(nil))
+}
+
+func randomWord(bits int) (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), uint(bits)))
+}
+
+// checkVectors checks the hash function and the PoWERC20 packing against
+// the golden vectors.
+func checkVectors(scheme miner.Scheme) error {
+	for _, v := range keccakVectors {
+		if got := crypto.Keccak256Hash([]byte(v.input)); got.Hex() != v.digest {
+			return fmt.Errorf("keccak256(%q) = %s, expected %s", v.input, got.Hex(), v.digest)
+		}
+	}
+	for i, v := range preimageVectors {
+		job := &miner.Job{Challenge: math.MustParseBig256(v.challenge), Difficulty: new(big.Int)}
+		sender := common.HexToAddress(v.sender)
+		nonce := math.MustParseBig256(v.nonce)
+		if got := miner.SolutionDigest(scheme, job, sender, nonce); got != common.HexToHash(v.digest) {
+			return fmt.Errorf("vector %d: digest %s, expected %s", i, got.Hex(), v.digest)
+		}
+	}
+	return nil
+}
+
+// checkScheme compares scheme's preimage and digest with the reference for
+// n random inputs, including values that need left padding.
+func checkScheme(scheme miner.Scheme, n int) error {
+	for i := 0; i < n; i++ {
+		// Vary the width so that short values, which need padding, are
+		// covered as often as full-width ones.
+		challenge, err := randomWord(1 + i%256)
+		if err != nil {
+			return err
+		}
+		nonce, err := randomWord(1 + (i*7)%256)
+		if err != nil {
+			return err
+		}
+		var sender common.Address
+		if _, err := rand.Read(sender[:]); err != nil {
+			return err
+		}
+		job := &miner.Job{Challenge: challenge, Difficulty: new(big.Int)}
+		want, err := referencePreimage(scheme, job, sender, nonce)
+		if err != nil {
+			return err
+		}
+		got := scheme.Preimage(job, sender, nonce)
+		if string(got) != string(want) {
+			return fmt.Errorf("challenge %#x, sender %s, nonce %#x: preimage %x, expected %x", challenge, sender.Hex(), nonce, got, want)
+		}
+		if digest, ref := miner.SolutionDigest(scheme, job, sender, nonce), referenceDigest(want); digest != ref {
+			return fmt.Errorf("challenge %#x, sender %s, nonce %#x: digest %s, expected %s", challenge, sender.Hex(), nonce, digest.Hex(), ref.Hex())
+		}
+	}
+	return nil
+}
+
+// checkHashers compares every hashing backend with SolutionDigest for n
+// random inputs of scheme. Batches vary in size so that multi-buffer
+// backends are also checked with partly filled vectors.
+func checkHashers(scheme miner.Scheme, n int) error {
+	for i, batch := 0, 1; i < n; i, batch = i+batch, batch%17+1 {
+		challenge, err := randomWord(1 + i%256)
+		if err != nil {
+			return err
+		}
+		var sender common.Address
+		if _, err := rand.Read(sender[:]); err != nil {
+			return err
+		}
+		nonces, got := make([][32]byte, batch), make([]common.Hash, batch)
+		for j := range nonces {
+			if _, err := rand.Read(nonces[j][:]); err != nil {
+				return err
+			}
+		}
+		job := &miner.Job{Challenge: challenge, Difficulty: new(big.Int)}
+		template, offset, err := miner.NonceTemplate(scheme, job, sender)
+		if err != nil {
+			return err
+		}
+		for _, h := range miner.Hashers() {
+			nh, err := h.Prepare(template, offset)
+			if err != nil {
+				return fmt.Errorf("%s: %v", h.Name(), err)
+			}
+			nh.Hash(nonces, got)
+			for j, nonce := range nonces {
+				if want := miner.SolutionDigest(scheme, job, sender, new(big.Int).SetBytes(nonce[:])); got[j] != want {
+					return fmt.Errorf("%s: challenge %#x, sender %s, nonce %x: digest %s, expected %s", h.Name(), challenge, sender.Hex(), nonce, got[j].Hex(), want.Hex())
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// runSelftest implements the `selftest` subcommand, which checks that the
+// miner hashes exactly what the contracts verify before any gas is spent.
+func runSelftest(args []string) {
+	fs := flag.NewFlagSet("selftest", flag.ExitOnError)
+	n := fs.Int("n", 10000, "Random inputs compared with the reference packing per scheme")
+	extra := fs.String("scheme", "", "Also check this scheme config file")
+	parseCommand(fs, args)
+
+	powerc20, err := miner.NewPoWERC20Scheme()
+	if err != nil {
+		selftestLog.Fatalf("Failed to load the PoWERC20 scheme: %v", err)
+	}
+	failed := false
+	report := func(name string, err error) {
+		if err != nil {
+			failed = true
+			selftestLog.Errorf("FAIL %s: %v", name, err)
+			return
+		}
+		selftestLog.Infof("ok   %s", name)
+	}
+	report("golden vectors", checkVectors(powerc20))
+
+	schemes := []string{"powerc20", "eip918"}
+	if *extra != "" {
+		schemes = append(schemes, *extra)
+	}
+	for _, name := range schemes {
+		scheme, err := miner.LoadScheme(name)
+		if err != nil {
+			report(name, err)
+			continue
+		}
+		report(fmt.Sprintf("%s preimage (%d random inputs)", scheme.Name(), *n), checkScheme(scheme, *n))
+		report(fmt.Sprintf("%s hashers (%d random inputs)", scheme.Name(), *n), checkHashers(scheme, *n))
+	}
+	if failed {
+		selftestLog.Error("Self test failed, do not mine with this build")
+		os.Exit(1)
+	}
+	selftestLog.Info("Self test passed")
+}
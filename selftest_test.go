@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"math/big"
+	"testing"
+
+	"Powerc20Worker/miner"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// testSchemes returns the built-in schemes and custom ones covering the
+// other preimage layouts.
+func testSchemes(t *testing.T) []miner.Scheme {
+	t.Helper()
+	powerc20, err := miner.LoadScheme("powerc20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eip918, err := miner.LoadScheme("eip918")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schemes := []miner.Scheme{powerc20, eip918}
+	for name, preimage := range map[string][]string{
+		"sender32":    {"challenge", "sender32", "nonce"},
+		"nonce-first": {"nonce", "sender", "challenge"},
+	} {
+		cfg := miner.EIP918Config
+		cfg.Name, cfg.Preimage = name, preimage
+		scheme, err := miner.NewABIScheme(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		schemes = append(schemes, scheme)
+	}
+	return schemes
+}
+
+func TestCheckVectors(t *testing.T) {
+	scheme, err := miner.LoadScheme("powerc20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkVectors(scheme); err != nil {
+		t.Fatal(err)
+	}
+	// The vectors tell a different packing apart.
+	cfg := miner.EIP918Config
+	cfg.Preimage = []string{"challenge", "sender32", "nonce"}
+	other, err := miner.NewABIScheme(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkVectors(other); err == nil {
+		t.Fatal("vectors accepted a padded sender")
+	}
+}
+
+// TestReferencePreimageTemplate compares the independent reference packing
+// with NonceTemplate filled in with random nonces, for every scheme.
+func TestReferencePreimageTemplate(t *testing.T) {
+	for _, scheme := range testSchemes(t) {
+		t.Run(scheme.Name(), func(t *testing.T) {
+			for i := 0; i < 500; i++ {
+				challenge, err := randomWord(1 + i%256)
+				if err != nil {
+					t.Fatal(err)
+				}
+				nonce, err := randomWord(1 + (i*13)%256)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var sender common.Address
+				rand.Read(sender[:])
+				job := &miner.Job{Challenge: challenge, Difficulty: new(big.Int)}
+
+				template, offset, err := miner.NonceTemplate(scheme, job, sender)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := bytes.Clone(template)
+				nonce.FillBytes(got[offset : offset+32])
+				want, err := referencePreimage(scheme, job, sender, nonce)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Fatalf("challenge %#x, sender %s, nonce %#x: template gives %x, reference %x", challenge, sender.Hex(), nonce, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckSchemeAndHashers(t *testing.T) {
+	for _, scheme := range testSchemes(t) {
+		if err := checkScheme(scheme, 1000); err != nil {
+			t.Errorf("%s: %v", scheme.Name(), err)
+		}
+		if err := checkHashers(scheme, 300); err != nil {
+			t.Errorf("%s: %v", scheme.Name(), err)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"Powerc20Worker/abi"
+	"Powerc20Worker/miner"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// routerABI covers the Uniswap V2 router function used to sell tokens.
+var routerABI = mustParseABI(`[
+	{"type":"function","name":"swapExactTokensForETH","stateMutability":"nonpayable","inputs":[{"name":"amountIn","type":"uint256"},{"name":"amountOutMin","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}],"outputs":[{"name":"amounts","type":"uint256[]"}]}
+]`)
+
+// seller swaps part of every mint to ETH through a Uniswap V2 router.
+type seller struct {
+	client      *ethclient.Client
+	auth        *bind.TransactOpts
+	router      common.Address
+	weth        common.Address
+	pairs       map[common.Address]common.Address // V2 pair per token
+	percent     float64                           // share of each mint to sell
+	slippageBps int64                             // tolerated drop from the reserve quote
+	deadline    time.Duration
+
+	// track records a sent transaction as pending until the returned
+	// function is called with its receipt, or nil if it was not mined.
+	track func(*pendingTx) func(*types.Receipt)
+	// sendMu is held while a transaction is signed and sent. It is shared
+	// with the submitter so that mints and sales never pick the same nonce.
+	sendMu *sync.Mutex
+
+	sales chan *miner.Contract // mints waiting to be sold
+}
+
+// newSeller checks the sell settings. Every token to sell needs a V2 pair
+// against weth so that the minimum output can be computed from reserves.
+func newSeller(ctx context.Context, client *ethclient.Client, auth *bind.TransactOpts, router, weth common.Address, pairs []common.Address, percent, slippage float64) (*seller, error) {
+	if percent <= 0 || percent > 100 {
+		return nil, fmt.Errorf("sell percentage %g is not between 0 and 100", percent)
+	}
+	if slippage < 0 || slippage >= 100 {
+		return nil, fmt.Errorf("slippage %g%% is not between 0 and 100", slippage)
+	}
+	s := &seller{
+		client:      client,
+		auth:        auth,
+		router:      router,
+		weth:        weth,
+		pairs:       make(map[common.Address]common.Address),
+		percent:     percent,
+		slippageBps: int64(slippage * 100),
+		deadline:    10 * time.Minute,
+		track:       func(*pendingTx) func(*types.Receipt) { return func(*types.Receipt) {} },
+		sendMu:      new(sync.Mutex),
+		sales:       make(chan *miner.Contract, 16),
+	}
+	for _, pair := range pairs {
+		out, err := callPair(ctx, client, pair, "token0")
+		if err != nil {
+			return nil, err
+		}
+		token0 := out[0].(common.Address)
+		if out, err = callPair(ctx, client, pair, "token1"); err != nil {
+			return nil, err
+		}
+		token1 := out[0].(common.Address)
+		switch weth {
+		case token0:
+			s.pairs[token1] = pair
+		case token1:
+			s.pairs[token0] = pair
+		default:
+			return nil, fmt.Errorf("pair %s does not trade against %s", pair.Hex(), weth.Hex())
+		}
+	}
+	return s, nil
+}
+
+// quote returns the ETH a V2 pair pays for amountIn of token, including the
+// 0.3% pool fee.
+func (s *seller) quote(ctx context.Context, token common.Address, amountIn *big.Int) (*big.Int, error) {
+	pair, ok := s.pairs[token]
+	if !ok {
+		return nil, fmt.Errorf("no sell pair configured for %s", token.Hex())
+	}
+	out, err := callPair(ctx, s.client, pair, "token0")
+	if err != nil {
+		return nil, err
+	}
+	token0 := out[0].(common.Address)
+	if out, err = callPair(ctx, s.client, pair, "getReserves"); err != nil {
+		return nil, err
+	}
+	reserveIn, reserveOut := out[0].(*big.Int), out[1].(*big.Int)
+	if token0 != token {
+		reserveIn, reserveOut = reserveOut, reserveIn
+	}
+	if reserveIn.Sign() == 0 || reserveOut.Sign() == 0 {
+		return nil, errNoLiquidity
+	}
+	withFee := new(big.Int).Mul(amountIn, big.NewInt(997))
+	num := new(big.Int).Mul(withFee, reserveOut)
+	den := new(big.Int).Add(new(big.Int).Mul(reserveIn, big.NewInt(1000)), withFee)
+	return num.Quo(num, den), nil
+}
+
+// ensureAllowance approves the router for amount of token if needed.
+func (s *seller) ensureAllowance(ctx context.Context, site *miner.Contract, amount *big.Int) error {
+	token, err := abi.NewPoWERC20(site.Address(), s.client)
+	if err != nil {
+		return err
+	}
+	allowance, err := token.Allowance(&bind.CallOpts{Context: ctx}, s.auth.From, s.router)
+	if err != nil {
+		return fmt.Errorf("failed to get allowance: %v", err)
+	}
+	if allowance.Cmp(amount) >= 0 {
+		return nil
+	}
+	withEvent(sellLog, "approve", "contract", site.Address()).Infof("Approving router %s to spend %s of %s...", s.router.Hex(), amount, site.Name())
+	opts := *s.auth
+	opts.Context = ctx
+	s.sendMu.Lock()
+	tx, err := token.Approve(&opts, s.router, amount)
+	s.sendMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to approve router: %w", err)
+	}
+	metrics.add("powerc20_transactions_submitted_total", 1, "contract", site.Address().Hex(), "kind", "approve")
+	done := s.track(&pendingTx{Hash: tx.Hash(), Contract: site.Address(), Kind: "approve", MaxFee: formatEther(maxFee(tx)), SentAt: time.Now()})
+	receipt, err := bind.WaitMined(ctx, s.client, tx)
+	done(receipt)
+	if err != nil {
+		return fmt.Errorf("failed to mine approval %s: %v", tx.Hash().Hex(), err)
+	}
+	recordReceipt("approve", site.Address(), receipt)
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return fmt.Errorf("approval %s reverted", tx.Hash().Hex())
+	}
+	withEvent(sellLog, "approved", "contract", site.Address(), "tx_hash", tx.Hash()).Infof("Router approved, Transaction Hash: %s", tx.Hash().Hex())
+	return nil
+}
+
+// schedule queues a sale of one mint on site for run. It never blocks the
+// submitter: when too many sales are waiting the mint is kept instead.
+func (s *seller) schedule(site *miner.Contract) {
+	select {
+	case s.sales <- site:
+	default:
+		sellLog.Warnf("Not selling %s: %d sales are already waiting", site.Name(), cap(s.sales))
+	}
+}
+
+// run sells the scheduled mints one at a time until ctx is done.
+func (s *seller) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case site := <-s.sales:
+			s.sell(ctx, site)
+		}
+	}
+}
+
+// sell swaps the configured share of one mint on site to ETH. Failures,
+// including a signer refusing the swap, are only logged: the mint has
+// already confirmed, and a failed sale must never stop mining.
+func (s *seller) sell(ctx context.Context, site *miner.Contract) {
+	reward := site.Reward()
+	if reward == nil {
+		sellLog.Warnf("Not selling %s: mint reward is unknown", site.Name())
+		return
+	}
+	amount := new(big.Int).Mul(reward, big.NewInt(int64(s.percent*100)))
+	amount.Quo(amount, big.NewInt(10000))
+	if amount.Sign() == 0 {
+		return
+	}
+	if err := s.trade(ctx, site, amount); err != nil {
+		sellLog.Errorf("Failed to sell %s: %v", site.Name(), err)
+	}
+}
+
+func (s *seller) trade(ctx context.Context, site *miner.Contract, amount *big.Int) error {
+	expected, err := s.quote(ctx, site.Address(), amount)
+	if err != nil {
+		return fmt.Errorf("failed to quote: %w", err)
+	}
+	minOut := new(big.Int).Mul(expected, big.NewInt(10000-s.slippageBps))
+	minOut.Quo(minOut, big.NewInt(10000))
+	if minOut.Sign() == 0 {
+		return fmt.Errorf("%s tokens are worth nothing at current reserves", amount)
+	}
+
+	if err := s.ensureAllowance(ctx, site, amount); err != nil {
+		return err
+	}
+
+	deadline := big.NewInt(time.Now().Add(s.deadline).Unix())
+	data, err := routerABI.Pack("swapExactTokensForETH", amount, minOut, []common.Address{site.Address(), s.weth}, s.auth.From, deadline)
+	if err != nil {
+		return err
+	}
+	// Simulate the swap first so that a trade that would revert or miss the
+	// minimum never costs gas.
+	result, err := s.client.CallContract(ctx, ethereum.CallMsg{From: s.auth.From, To: &s.router, Data: data}, nil)
+	if err != nil {
+		return fmt.Errorf("swap simulation failed: %v", err)
+	}
+	amounts, err := routerABI.Unpack("swapExactTokensForETH", result)
+	if err != nil {
+		return fmt.Errorf("failed to decode swap simulation: %v", err)
+	}
+	simulated := amounts[0].([]*big.Int)
+	if len(simulated) == 0 || simulated[len(simulated)-1].Cmp(minOut) < 0 {
+		return fmt.Errorf("simulated swap pays less than the minimum of %s ETH", formatEther(minOut))
+	}
+	received := simulated[len(simulated)-1]
+
+	withEvent(sellLog, "sell", "contract", site.Address()).Infof("Selling %s of %s for at least %s ETH (quoted %s, simulated %s, slippage %.2f%%)...",
+		amount, site.Name(), formatEther(minOut), formatEther(expected), formatEther(received), float64(s.slippageBps)/100)
+	opts := *s.auth
+	opts.Context = ctx
+	s.sendMu.Lock()
+	tx, err := bind.NewBoundContract(s.router, routerABI, s.client, s.client, s.client).RawTransact(&opts, data)
+	s.sendMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to send swap: %w", err)
+	}
+	metrics.add("powerc20_transactions_submitted_total", 1, "contract", site.Address().Hex(), "kind", "swap")
+	done := s.track(&pendingTx{Hash: tx.Hash(), Contract: s.router, Kind: "swap", MaxFee: formatEther(maxFee(tx)), SentAt: time.Now()})
+	receipt, err := bind.WaitMined(ctx, s.client, tx)
+	done(receipt)
+	if err != nil {
+		return fmt.Errorf("failed to mine swap %s: %v", tx.Hash().Hex(), err)
+	}
+	recordReceipt("swap", site.Address(), receipt)
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return fmt.Errorf("swap reverted, Transaction Hash: %s", receipt.TxHash.Hex())
+	}
+	fee := new(big.Int).Mul(receipt.EffectiveGasPrice, new(big.Int).SetUint64(receipt.GasUsed))
+	withEvent(sellLog, "sold", "contract", site.Address(), "tx_hash", receipt.TxHash).Infof("Sold %s of %s, gas %s ETH, Transaction Hash: %s", amount, site.Name(), formatEther(fee), receipt.TxHash.Hex())
+	return nil
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"Powerc20Worker/abi"
+	"Powerc20Worker/miner"
+
+	gethabi "github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// simPair is a Uniswap V2 pair on the simulated chain. Its reserves only
+// change through a simRouter.
+type simPair struct {
+	token0, token1     common.Address
+	reserve0, reserve1 *big.Int
+}
+
+func (p *simPair) abi() *gethabi.ABI { return &pairABI }
+
+func (p *simPair) call(c *simChain, method *gethabi.Method, sender common.Address, args []interface{}, commit bool) ([]interface{}, error) {
+	switch method.Name {
+	case "token0":
+		return []interface{}{p.token0}, nil
+	case "token1":
+		return []interface{}{p.token1}, nil
+	case "getReserves":
+		return []interface{}{p.reserve0, p.reserve1, uint32(0)}, nil
+	}
+	return nil, simRevert("unsupported method " + method.Name)
+}
+
+// simRouter is a Uniswap V2 router that sells tokens for ETH through
+// simPairs. skimBps is kept from every output, like a router that pays less
+// than the reserves quote.
+type simRouter struct {
+	address common.Address
+	weth    common.Address
+	pairs   map[common.Address]common.Address // token to pair
+	skimBps int64
+	swaps   [][]interface{} // arguments of every committed swap
+}
+
+func (r *simRouter) abi() *gethabi.ABI { return &routerABI }
+
+func (r *simRouter) call(c *simChain, method *gethabi.Method, sender common.Address, args []interface{}, commit bool) ([]interface{}, error) {
+	if method.Name != "swapExactTokensForETH" {
+		return nil, simRevert("unsupported method " + method.Name)
+	}
+	amountIn, minOut, path, to, deadline := args[0].(*big.Int), args[1].(*big.Int), args[2].([]common.Address), args[3].(common.Address), args[4].(*big.Int)
+	if deadline.Int64() < time.Now().Unix() {
+		return nil, simRevert("EXPIRED")
+	}
+	if len(path) != 2 || path[1] != r.weth || c.tokens[path[0]] == nil {
+		return nil, simRevert("INVALID_PATH")
+	}
+	pairAddr := r.pairs[path[0]]
+	pair := c.contracts[pairAddr].(*simPair)
+	reserveIn, reserveOut := &pair.reserve0, &pair.reserve1
+	if pair.token0 != path[0] {
+		reserveIn, reserveOut = reserveOut, reserveIn
+	}
+	withFee := new(big.Int).Mul(amountIn, big.NewInt(997))
+	out := new(big.Int).Mul(withFee, *reserveOut)
+	out.Quo(out, new(big.Int).Add(new(big.Int).Mul(*reserveIn, big.NewInt(1000)), withFee))
+	out.Mul(out, big.NewInt(10000-r.skimBps))
+	out.Quo(out, big.NewInt(10000))
+	if out.Cmp(minOut) < 0 {
+		return nil, simRevert("INSUFFICIENT_OUTPUT_AMOUNT")
+	}
+	transferFrom := c.abi.Methods["transferFrom"]
+	if _, err := c.tokens[path[0]].call(&transferFrom, r.address, []interface{}{sender, pairAddr, amountIn}, commit); err != nil {
+		return nil, err
+	}
+	if commit {
+		*reserveIn = new(big.Int).Add(*reserveIn, amountIn)
+		*reserveOut = new(big.Int).Sub(*reserveOut, out)
+		c.balances[to] = new(big.Int).Add(bigOrZero(c.balances[to]), out)
+		r.swaps = append(r.swaps, args)
+	}
+	return []interface{}{[]*big.Int{amountIn, out}}, nil
+}
+
+// simMarket is a router with one pair for token on a simulated chain.
+type simMarket struct {
+	router *simRouter
+	pair   common.Address
+}
+
+// newSimMarket installs a pair holding tokens of token and eth of weth, in
+// that order unless inverted, and a router that trades through it.
+func newSimMarket(chain *simChain, token common.Address, tokens, eth *big.Int, inverted bool) *simMarket {
+	weth := common.HexToAddress(wethAddress)
+	pair := &simPair{token0: token, token1: weth, reserve0: tokens, reserve1: eth}
+	if inverted {
+		pair = &simPair{token0: weth, token1: token, reserve0: eth, reserve1: tokens}
+	}
+	m := &simMarket{pair: chain.install(pair)}
+	m.router = &simRouter{weth: weth, pairs: map[common.Address]common.Address{token: m.pair}}
+	m.router.address = chain.install(m.router)
+	return m
+}
+
+// credit gives account amount of token.
+func (c *simChain) credit(token, account common.Address, amount *big.Int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens[token].balances[account] = amount
+}
+
+// sellAccount is a funded account holding tokens of token on chain.
+func sellAccount(t *testing.T, chain *simChain, token common.Address, tokens *big.Int) *bind.TransactOpts {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := bind.NewKeyedTransactorWithChainID(key, big.NewInt(simChainID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.fund(auth.From, big.NewInt(1e18))
+	chain.credit(token, auth.From, tokens)
+	return auth
+}
+
+// sellSite returns token as mined by account once its mint reward is known.
+func sellSite(t *testing.T, chain *simChain, token, account common.Address) *miner.Contract {
+	t.Helper()
+	scheme, err := miner.LoadScheme("powerc20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine, err := miner.New(miner.Options{
+		Backend:      chain.dial(),
+		Scheme:       scheme,
+		Contracts:    []miner.ContractSpec{{Address: token, Decimals: 18}},
+		Sender:       account,
+		PollInterval: 10 * time.Millisecond,
+		Logger:       schedLog,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Stop()
+	site := engine.Contracts()[0]
+	for deadline := time.Now().Add(10 * time.Second); site.Reward() == nil; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("mint reward was not read")
+		}
+	}
+	return site
+}
+
+func ether(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), big.NewInt(1e18))
+}
+
+func TestSellerQuote(t *testing.T) {
+	chain, err := newSimChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := chain.dial()
+	token := chain.deploy("sell", 60, 1)
+	amount := ether(10)
+	// 10 tokens into 1000 tokens and 10 ETH, less the 0.3% fee:
+	// 10 * 997 * 10 / (1000 * 1000 + 10 * 997) ETH.
+	want := big.NewInt(98715803439706129)
+	for _, inverted := range []bool{false, true} {
+		market := newSimMarket(chain, token, ether(1000), ether(10), inverted)
+		s, err := newSeller(context.Background(), client, nil, market.router.address, common.HexToAddress(wethAddress), []common.Address{market.pair}, 100, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := s.quote(context.Background(), token, amount)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Cmp(want) != 0 {
+			t.Errorf("inverted %v: quote %v, want %v", inverted, got, want)
+		}
+	}
+
+	empty := newSimMarket(chain, token, new(big.Int), ether(10), false)
+	s, err := newSeller(context.Background(), client, nil, empty.router.address, common.HexToAddress(wethAddress), []common.Address{empty.pair}, 100, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.quote(context.Background(), token, amount); !errors.Is(err, errNoLiquidity) {
+		t.Errorf("empty pair: got %v, want errNoLiquidity", err)
+	}
+	if _, err := s.quote(context.Background(), common.Address{0xaa}, amount); err == nil || !strings.Contains(err.Error(), "no sell pair") {
+		t.Errorf("unknown token: got %v, want a missing pair error", err)
+	}
+}
+
+func TestNewSeller(t *testing.T) {
+	chain, err := newSimChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := chain.dial()
+	token := chain.deploy("sell", 60, 1)
+	other := chain.install(&simPair{token0: token, token1: common.Address{0xee}, reserve0: ether(1), reserve1: ether(1)})
+	market := newSimMarket(chain, token, ether(1), ether(1), false)
+	weth := common.HexToAddress(wethAddress)
+	for _, c := range []struct {
+		name              string
+		pair              common.Address
+		percent, slippage float64
+		want              string
+	}{
+		{"valid", market.pair, 50, 0.5, ""},
+		{"no percent", market.pair, 0, 1, "sell percentage"},
+		{"over 100 percent", market.pair, 101, 1, "sell percentage"},
+		{"negative slippage", market.pair, 100, -1, "slippage"},
+		{"full slippage", market.pair, 100, 100, "slippage"},
+		{"pair without weth", other, 100, 1, "does not trade against"},
+	} {
+		s, err := newSeller(context.Background(), client, nil, market.router.address, weth, []common.Address{c.pair}, c.percent, c.slippage)
+		if c.want == "" {
+			if err != nil {
+				t.Errorf("%s: %v", c.name, err)
+			} else if s.slippageBps != int64(c.slippage*100) || s.pairs[token] != market.pair {
+				t.Errorf("%s: slippage %d bps and pairs %v", c.name, s.slippageBps, s.pairs)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: got %v, want an error containing %q", c.name, err, c.want)
+		}
+	}
+}
+
+func TestSellerSell(t *testing.T) {
+	// Half of a 1000 token mint into 1,000,000 tokens and 100 ETH quotes
+	// 500 * 997 * 100 / (1,000,000 * 1000 + 500 * 997) ETH.
+	quoted := big.NewInt(49825162156664902)
+	for _, c := range []struct {
+		name     string
+		skimBps  int64 // taken by the router below the quote
+		slippage float64
+		minOut   *big.Int // 0 if the swap must not be sent
+	}{
+		{"at quote", 0, 1, big.NewInt(49326910535098252)}, // quoted less 100 bps
+		{"within slippage", 50, 1, big.NewInt(49326910535098252)},
+		{"no slippage", 0, 0, quoted},
+		{"simulation below minimum", 150, 1, nil},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			chain, err := newSimChain()
+			if err != nil {
+				t.Fatal(err)
+			}
+			client := chain.dial()
+			token := chain.deploy("sell", 60, 1)
+			auth := sellAccount(t, chain, token, ether(1000))
+			market := newSimMarket(chain, token, ether(1_000_000), ether(100), false)
+			market.router.skimBps = c.skimBps
+			site := sellSite(t, chain, token, auth.From)
+
+			s, err := newSeller(context.Background(), client, auth, market.router.address, common.HexToAddress(wethAddress), []common.Address{market.pair}, 50, c.slippage)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var kinds []string
+			s.track = func(tx *pendingTx) func(*types.Receipt) {
+				kinds = append(kinds, tx.Kind)
+				return func(*types.Receipt) {}
+			}
+			before, err := client.BalanceAt(context.Background(), auth.From, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.sell(context.Background(), site)
+
+			caller, err := abi.NewPoWERC20Caller(token, client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			balance, err := caller.BalanceOf(&bind.CallOpts{}, auth.From)
+			if err != nil {
+				t.Fatal(err)
+			}
+			after, err := client.BalanceAt(context.Background(), auth.From, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fees := new(big.Int).Mul(big.NewInt(int64(len(kinds))*simGasUsed), new(big.Int).Add(simBaseFee, simTip))
+			gained := new(big.Int).Sub(after, before)
+			gained.Add(gained, fees)
+
+			if c.minOut == nil {
+				// The approval is sent, but the swap never leaves the
+				// simulation.
+				if strings.Join(kinds, ",") != "approve" || len(market.router.swaps) != 0 {
+					t.Fatalf("sent %v with %d swaps, want only the approval", kinds, len(market.router.swaps))
+				}
+				if balance.Cmp(ether(1000)) != 0 || gained.Sign() != 0 {
+					t.Errorf("balance %v and %v wei gained after a refused sale", balance, gained)
+				}
+				return
+			}
+			if strings.Join(kinds, ",") != "approve,swap" || len(market.router.swaps) != 1 {
+				t.Fatalf("sent %v with %d swaps, want an approval and a swap", kinds, len(market.router.swaps))
+			}
+			swap := market.router.swaps[0]
+			if amountIn := swap[0].(*big.Int); amountIn.Cmp(ether(500)) != 0 {
+				t.Errorf("sold %v, want half the mint", amountIn)
+			}
+			if minOut := swap[1].(*big.Int); minOut.Cmp(c.minOut) != 0 {
+				t.Errorf("minimum output %v, want %v", minOut, c.minOut)
+			}
+			if balance.Cmp(ether(500)) != 0 {
+				t.Errorf("kept %v tokens, want half the mint", balance)
+			}
+			received := new(big.Int).Mul(quoted, big.NewInt(10000-c.skimBps))
+			received.Quo(received, big.NewInt(10000))
+			if gained.Cmp(received) != 0 {
+				t.Errorf("received %v wei, want %v", gained, received)
+			}
+		})
+	}
+}
+
+func TestSellerSchedule(t *testing.T) {
+	s := &seller{sales: make(chan *miner.Contract, 2)}
+	// Scheduling never blocks the submitter, even with nothing selling.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 5; i++ {
+			s.schedule(&miner.Contract{})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("schedule blocked")
+	}
+	if len(s.sales) != 2 {
+		t.Errorf("%d sales waiting, want 2", len(s.sales))
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// isStopSignal reports whether sig asks the miner to exit.
+func isStopSignal(sig os.Signal) bool {
+	return sig != reloadSignal && sig != statsSignal
+}
+
+// shutdown stops hashing, gives transactions in flight up to timeout to be
+// mined and then hands them off: their solutions stay in the queue file
+// with the transaction hash and are followed up on the next start. A
+// second stop signal stops waiting at once.
+func shutdown(ctrl *controller, timeout time.Duration, signals <-chan os.Signal, errorChan <-chan error, handOff func(), submitterDone <-chan struct{}) {
+	ctrl.tuner.disable()
+	ctrl.engine.Stop()
+	if ctrl.sub == nil {
+		return
+	}
+	ctrl.sub.stop()
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	logged := -1
+wait:
+	for {
+		pending := len(ctrl.sub.pendingTxs())
+		if pending == 0 {
+			break
+		}
+		if pending != logged {
+			withEvent(logger, "shutdown_waiting").Infof("Waiting up to %s for %d pending transaction(s), interrupt again to stop waiting", timeout, pending)
+			logged = pending
+		}
+		select {
+		case <-deadline.C:
+			break wait
+		case sig := <-signals:
+			if isStopSignal(sig) {
+				break wait
+			}
+		case err := <-errorChan:
+			logger.Errorf("Submission failed during shutdown: %v", err)
+		case <-ticker.C:
+		}
+	}
+	handOff()
+	for done := false; !done; {
+		select {
+		case <-submitterDone:
+			done = true
+		case err := <-errorChan:
+			logger.Errorf("Submission failed during shutdown: %v", err)
+		}
+	}
+
+	queued := ctrl.queue.pending()
+	sent := 0
+	for _, item := range queued {
+		if item.TxHash != nil {
+			sent++
+		}
+	}
+	switch {
+	case len(queued) == 0:
+	case queueFile == "":
+		withEvent(logger, "queue_lost").Warnf("%d queued solution(s) are lost because -queueFile is empty", len(queued))
+	default:
+		withEvent(logger, "queue_saved").Infof("%d solution(s) saved in %s, %d of them with a transaction to follow up on the next start", len(queued), queueFile, sent)
+	}
+}
+
+// printSessionSummary writes what this run achieved to w.
+func printSessionSummary(w io.Writer, ctrl *controller) {
+	st := ctrl.status()
+	uptime := time.Since(ctrl.started)
+	fmt.Fprintln(w, "Session summary:")
+	row := func(name, format string, args ...interface{}) {
+		fmt.Fprintf(w, "  %-18s %s\n", name, fmt.Sprintf(format, args...))
+	}
+	row("Uptime", "%s", uptime.Round(time.Second))
+	row("Hashes", "%d, average %s", st.Hashes, strings.TrimSpace(formatRate(float64(st.Hashes)/uptime.Seconds())))
+	row("Solutions found", "%d, %.2f expected", st.Luck.Found, st.Luck.Expected)
+	if ctrl.sub != nil {
+		confirmed, reverted := ctrl.sub.outcomes()
+		row("Transactions", "%d confirmed, %d reverted", confirmed, reverted)
+		row("Queued", "%d solution(s)", len(st.Queued))
+	}
+	for _, cs := range st.Contracts {
+		row(truncate(cs.Name, 18), "%d hashes", cs.Hashes)
+	}
+}
+
+// logStats logs the current state, on statsSignal.
+func logStats(ctrl *controller) {
+	st := ctrl.status()
+	withEvent(logger, "stats", "workers", st.Workers, "hashrate", st.Hashrate, "hashes", st.Hashes, "found", st.Luck.Found, "queued", len(st.Queued), "pending_txs", len(st.PendingTxs)).Infof("Stats: up %s, %d workers at %s, %d hashes, %d solution(s) found, %d queued, %d pending transaction(s)",
+		st.Uptime, st.Workers, strings.TrimSpace(formatRate(st.Hashrate)), st.Hashes, st.Luck.Found, len(st.Queued), len(st.PendingTxs))
+	for i, cs := range st.Contracts {
+		effort := "-"
+		if i < len(st.Luck.Current) {
+			effort = fmt.Sprintf("%.0f%%", st.Luck.Current[i]*100)
+		}
+		withEvent(logger, "stats_contract", "contract", cs.Address, "workers", cs.Workers, "hashes", cs.Hashes).Infof("Stats: %s %s, %d workers, %d hashes, effort %s", cs.Name, cs.State, cs.Workers, cs.Hashes, effort)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"Powerc20Worker/miner"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestShutdownHandsOffPendingTransactions(t *testing.T) {
+	chain, err := newSimChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := crypto.PubkeyToAddress(key.PublicKey)
+	chain.fund(account, big.NewInt(1e18))
+	token := chain.deploy("sim", 6, 10)
+	// Transactions are accepted but never mined.
+	chain.mu.Lock()
+	chain.holdReceipts = true
+	chain.mu.Unlock()
+
+	ctrl := testController(t, chain, token, account)
+	queue, err := loadSolutionQueue(filepath.Join(t.TempDir(), "solutions.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := bind.NewKeyedTransactorWithChainID(key, big.NewInt(simChainID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	site := ctrl.sites[0]
+	sub := &submitter{client: chain.dial(), auth: auth, queue: queue, sites: map[common.Address]*miner.Contract{token: site}, interval: 50 * time.Millisecond}
+	ctrl.queue, ctrl.sub = queue, sub
+
+	subCtx, handOff := context.WithCancel(context.Background())
+	defer handOff()
+	submitterDone := make(chan struct{})
+	errs := make(chan error, 1)
+	go func() {
+		defer close(submitterDone)
+		sub.supervise(subCtx, 50*time.Millisecond, errs)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := ctrl.engine.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Queue the first solution and wait for its transaction to be sent.
+	for sent := false; !sent; {
+		select {
+		case ev := <-ctrl.engine.Events():
+			if ev.Type != miner.SolutionEvent || queue.Len() > 0 {
+				continue
+			}
+			sol := ev.Solution
+			queue.push(&queuedSolution{
+				Contract:   token,
+				Sender:     account,
+				Challenge:  (*hexutil.Big)(sol.Job.Challenge),
+				Difficulty: (*hexutil.Big)(sol.Job.Difficulty),
+				Nonce:      (*hexutil.Big)(sol.Nonce),
+				Digest:     sol.Digest,
+				FoundAt:    time.Now(),
+			})
+		case <-time.After(20 * time.Millisecond):
+			sent = len(sub.pendingTxs()) > 0
+		case <-ctx.Done():
+			t.Fatal("no transaction was sent in time")
+		}
+	}
+	hash := sub.pendingTxs()[0].Hash
+
+	const timeout = 300 * time.Millisecond
+	start := time.Now()
+	shutdown(ctrl, timeout, make(chan os.Signal), errs, handOff, submitterDone)
+	if elapsed := time.Since(start); elapsed < timeout {
+		t.Errorf("shutdown returned after %s, before the %s timeout", elapsed, timeout)
+	}
+
+	// The queue file keeps the solution with its transaction, so that the
+	// next start follows it up instead of mining it again.
+	reloaded, err := loadSolutionQueue(queue.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := reloaded.pending()
+	if len(items) != 1 || items[0].TxHash == nil || *items[0].TxHash != hash {
+		t.Fatalf("queue file holds %+v, want the solution with transaction %s", items, hash.Hex())
+	}
+}
+
+func TestLogStatsWithoutLuck(t *testing.T) {
+	chain, err := newSimChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctrl := testController(t, chain, chain.deploy("sim", 60, 1), common.Address{0x01})
+	// A luck tracker without the contract, as before its first sample.
+	if ctrl.luck, err = newLuckTracker(nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	subsystemLoggers["main"].SetOutput(&out)
+	t.Cleanup(func() { subsystemLoggers["main"].SetOutput(os.Stderr) })
+	logStats(ctrl)
+	if !strings.Contains(out.String(), "effort -") {
+		t.Errorf("stats logged %q, want an unknown effort", out.String())
+	}
+}
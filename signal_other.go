@@ -0,0 +1,17 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// There is no SIGHUP or SIGUSR1 to reload -config or log the stats with.
+var reloadSignal, statsSignal os.Signal
+
+// notifySignals delivers the signals the miner handles to c.
+func notifySignals(c chan<- os.Signal) {
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+}
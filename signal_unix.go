@@ -0,0 +1,20 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// reloadSignal re-reads -config and statsSignal logs the current stats.
+var (
+	reloadSignal os.Signal = syscall.SIGHUP
+	statsSignal  os.Signal = syscall.SIGUSR1
+)
+
+// notifySignals delivers the signals the miner handles to c.
+func notifySignals(c chan<- os.Signal) {
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, reloadSignal, statsSignal)
+}
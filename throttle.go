@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"Powerc20Worker/miner"
+)
+
+// parseDutyCycle parses -dutyCycle, ON/PERIOD such as 300ms/1s.
+func parseDutyCycle(value string) (on, period time.Duration, err error) {
+	a, b, ok := strings.Cut(value, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("expected ON/PERIOD such as 300ms/1s, got %q", value)
+	}
+	if on, err = time.ParseDuration(a); err != nil {
+		return 0, 0, err
+	}
+	if period, err = time.ParseDuration(b); err != nil {
+		return 0, 0, err
+	}
+	if on <= 0 || period <= 0 || on > period {
+		return 0, 0, fmt.Errorf("expected 0 < ON <= PERIOD, got %q", value)
+	}
+	return on, period, nil
+}
+
+// buildThrottle turns -cpuBudget, -dutyCycle and -schedule into a
+// throttle; cpus is the number of CPUs the budget is a percentage of.
+func buildThrottle(budget float64, duty, schedule string, cpus int) (miner.Throttle, error) {
+	var t miner.Throttle
+	if budget < 0 || budget > 100 {
+		return t, fmt.Errorf("invalid -cpuBudget %g, expected 0 to 100", budget)
+	}
+	if budget > 0 && budget < 100 {
+		t.Cores = budget / 100 * float64(cpus)
+	}
+	if duty != "" {
+		on, period, err := parseDutyCycle(duty)
+		if err != nil {
+			return t, fmt.Errorf("invalid -dutyCycle: %v", err)
+		}
+		if on < period {
+			t.On, t.Period = on, period
+		}
+	}
+	windows, err := miner.ParseWindows(schedule)
+	if err != nil {
+		return t, fmt.Errorf("invalid -schedule: %v", err)
+	}
+	t.Windows = windows
+	return t, nil
+}
+
+// budgetWorkers caps an automatic worker count at the cores of the
+// budget: more workers would only take turns.
+func budgetWorkers(workers int, t miner.Throttle) int {
+	if t.Cores > 0 {
+		workers = min(workers, int(math.Ceil(t.Cores)))
+	}
+	return max(workers, 1)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"Powerc20Worker/miner"
+)
+
+var tuneLog = newSubsystemLogger("tune")
+
+// retuneChecks is how many consecutive -retuneInterval windows throughput
+// must be off the calibrated rate before the worker count is tuned again.
+const retuneChecks = 3
+
+// workerTuner implements -workerCount auto: it calibrates the worker count
+// once the miner is hashing and again whenever throughput drifts away from
+// the calibrated rate, for example because of noisy neighbours. It is idle
+// while disabled by a fixed worker count.
+type workerTuner struct {
+	engine   *miner.Miner
+	max      atomic.Int64
+	interval time.Duration // 0 calibrates once
+	drop     float64       // fraction of the calibrated rate
+
+	enabled atomic.Bool
+	retune  chan struct{}
+
+	mu     sync.Mutex // held while calibrating
+	cancel context.CancelFunc
+	cmu    sync.Mutex // guards cancel
+}
+
+func newWorkerTuner(engine *miner.Miner, max int, enabled bool, interval time.Duration, dropPercent float64) *workerTuner {
+	t := &workerTuner{
+		engine:   engine,
+		interval: interval,
+		drop:     dropPercent / 100,
+		retune:   make(chan struct{}, 1),
+	}
+	t.max.Store(int64(max))
+	t.enabled.Store(enabled)
+	return t
+}
+
+// setMax changes the largest worker count calibrations try.
+func (t *workerTuner) setMax(max int) {
+	t.max.Store(int64(max))
+}
+
+// enable turns tuning back on and calibrates again.
+func (t *workerTuner) enable() {
+	t.enabled.Store(true)
+	select {
+	case t.retune <- struct{}{}:
+	default:
+	}
+}
+
+// disable stops tuning, for example because the worker count was set by
+// hand, and waits for a running calibration to give up.
+func (t *workerTuner) disable() {
+	t.enabled.Store(false)
+	t.cmu.Lock()
+	if t.cancel != nil {
+		t.cancel()
+	}
+	t.cmu.Unlock()
+	t.mu.Lock()
+	t.mu.Unlock()
+}
+
+// calibrate runs one calibration unless tuning was disabled meanwhile.
+func (t *workerTuner) calibrate(ctx context.Context) (miner.TuneResult, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.enabled.Load() {
+		return miner.TuneResult{}, context.Canceled
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	t.cmu.Lock()
+	t.cancel = cancel
+	t.cmu.Unlock()
+	max := int(t.max.Load())
+	withEvent(tuneLog, "tune_started").Infof("Calibrating the worker count, up to %d workers", max)
+	return t.engine.Tune(ctx, miner.TuneOptions{Max: max})
+}
+
+func formatTuneRates(rates map[int]float64) string {
+	counts := make([]int, 0, len(rates))
+	for n := range rates {
+		counts = append(counts, n)
+	}
+	sort.Ints(counts)
+	parts := make([]string, len(counts))
+	for i, n := range counts {
+		parts[i] = fmt.Sprintf("%d=%.0f K/s", n, rates[n]/1000)
+	}
+	return strings.Join(parts, " ")
+}
+
+// run calibrates and then compares the hashrate with the calibrated one,
+// averaged over each interval, until ctx is done.
+func (t *workerTuner) run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	var (
+		baseline float64 // 0 until calibrated
+		workers  int
+		sum      float64
+		samples  int
+		ticks    int
+		off      int
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.retune:
+			baseline = 0
+		case <-ticker.C:
+		}
+		if !t.enabled.Load() {
+			baseline = 0
+			continue
+		}
+		if baseline == 0 {
+			// Calibrating makes no sense while nothing is hashed, the
+			// rates would all be zero.
+			if !t.engine.Busy() {
+				continue
+			}
+			res, err := t.calibrate(ctx)
+			if err != nil {
+				if ctx.Err() == nil && t.enabled.Load() {
+					tuneLog.Debugf("Calibration interrupted, trying again: %v", err)
+				}
+				continue
+			}
+			baseline, workers = res.Rate, res.Workers
+			sum, samples, ticks, off = 0, 0, 0, 0
+			withEvent(tuneLog, "workers_tuned", "workers", res.Workers).Infof("Tuned to %d workers at %.0f K/s (%s)", res.Workers, res.Rate/1000, formatTuneRates(res.Rates))
+			continue
+		}
+		if t.interval <= 0 {
+			continue
+		}
+		// Only count seconds in which every worker hashed; pauses and
+		// waits for a job say nothing about the machine.
+		if t.engine.Busy() && t.engine.Workers() == workers {
+			sum += t.engine.Hashrate()
+			samples++
+		}
+		ticks++
+		if time.Duration(ticks)*time.Second < t.interval {
+			continue
+		}
+		if samples > ticks/2 {
+			avg := sum / float64(samples)
+			// A rise only matters when more workers could use it.
+			if avg < baseline*(1-t.drop) || (int64(workers) < t.max.Load() && avg > baseline*(1+t.drop)) {
+				off++
+				tuneLog.Debugf("Hashrate %.0f K/s is off the calibrated %.0f K/s (%d/%d)", avg/1000, baseline/1000, off, retuneChecks)
+			} else {
+				off = 0
+			}
+			if off >= retuneChecks {
+				withEvent(tuneLog, "throughput_changed").Infof("Hashrate moved from %.0f K/s to %.0f K/s, tuning the worker count again", baseline/1000, avg/1000)
+				baseline = 0
+			}
+		}
+		sum, samples, ticks = 0, 0, 0
+	}
+}
+
+// parseWorkerCount parses -workerCount: a positive number, or auto for
+// AvailableCPUs with tuning.
+func parseWorkerCount(value string) (n int, auto bool, err error) {
+	if value == "auto" {
+		return miner.AvailableCPUs(), true, nil
+	}
+	if n, err = strconv.Atoi(value); err != nil || n <= 0 {
+		return 0, false, fmt.Errorf("expected auto or a positive number, got %q", value)
+	}
+	return n, false, nil
+}
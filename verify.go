@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"Powerc20Worker/abi"
+	"Powerc20Worker/miner"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// errUnverifiedContract is returned when the contract's runtime code is not
+// on the allowlist of verified builds.
+var errUnverifiedContract = errors.New("contract code is not a verified build")
+
+// knownCodeHashes lists keccak256 hashes of runtime bytecode of PoWERC20
+// builds that have been reviewed. Only add hashes that were checked against
+// published, verified source; users can trust further builds with
+// -codeHashAllowlist.
+var knownCodeHashes = map[common.Hash]string{}
+
+// knownDeployment is a PoWERC20 deployment trusted by its address on one
+// chain.
+type knownDeployment struct {
+	Name    string
+	ChainID int64
+	// CodeHash is the reviewed runtime code hash. While it is zero the
+	// deployment is trusted by address alone, provided every probe passes;
+	// once set, any other code at the address is refused.
+	CodeHash common.Hash
+}
+
+// knownDeployments are the deployments the miner accepts without an
+// allowlist entry, so that a run with the default -contractAddress works
+// out of the box.
+var knownDeployments = map[common.Address]knownDeployment{
+	common.HexToAddress(defaultContractAddress): {Name: "PoWERC20 default deployment", ChainID: 1},
+}
+
+// knownBuild returns the name of the known deployment at addr on chainID
+// if code hash matches it, or a problem if the address is known but holds
+// other code.
+func knownBuild(chainID *big.Int, addr common.Address, hash common.Hash) (build, problem string) {
+	d, ok := knownDeployments[addr]
+	if !ok || chainID == nil || chainID.Cmp(big.NewInt(d.ChainID)) != 0 {
+		return "", ""
+	}
+	if d.CodeHash != (common.Hash{}) && d.CodeHash != hash {
+		return "", fmt.Sprintf("code hash %s differs from the reviewed %s of %s", hash.Hex(), d.CodeHash.Hex(), d.Name)
+	}
+	return d.Name, ""
+}
+
+// allowlistEntry is one element of the JSON file passed to
+// -codeHashAllowlist.
+type allowlistEntry struct {
+	CodeHash common.Hash `json:"codeHash"`
+	Name     string      `json:"name"`
+}
+
+// loadCodeHashAllowlist merges the built-in allowlist with the entries in
+// path, if any.
+func loadCodeHashAllowlist(path string) (map[common.Hash]string, error) {
+	allowlist := make(map[common.Hash]string, len(knownCodeHashes))
+	for hash, name := range knownCodeHashes {
+		allowlist[hash] = name
+	}
+	if path == "" {
+		return allowlist, nil
+	}
+	var entries []allowlistEntry
+	if err := readJSONFile(path, &entries); err != nil {
+		return nil, fmt.Errorf("failed to read code hash allowlist: %v", err)
+	}
+	for _, e := range entries {
+		if e.CodeHash == (common.Hash{}) {
+			return nil, fmt.Errorf("allowlist entry %q has no code hash", e.Name)
+		}
+		allowlist[e.CodeHash] = e.Name
+	}
+	return allowlist, nil
+}
+
+// contractReport is the outcome of verifyContract.
+type contractReport struct {
+	CodeHash common.Hash
+	CodeSize int
+	Build    string // name of the allowlisted build, empty if unknown
+	Problems []string
+}
+
+// Verified reports whether the code is allowlisted and every probe passed.
+func (r *contractReport) Verified() bool {
+	return r.Build != "" && len(r.Problems) == 0
+}
+
+// verifyContract fetches the runtime code at addr, looks its hash up in
+// allowlist and probes the functions scheme depends on. Problems with the
+// contract are collected in the report; the error is only set when the node
+// could not be queried.
+func verifyContract(ctx context.Context, client *ethclient.Client, scheme miner.Scheme, addr, from common.Address, allowlist map[common.Hash]string) (*contractReport, error) {
+	code, err := client.CodeAt(ctx, addr, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch contract code: %v", err)
+	}
+	report := &contractReport{
+		CodeHash: crypto.Keccak256Hash(code),
+		CodeSize: len(code),
+		Build:    allowlist[crypto.Keccak256Hash(code)],
+	}
+	if len(code) == 0 {
+		report.Problems = append(report.Problems, "no code deployed at address")
+		return report, nil
+	}
+	if report.Build == "" {
+		chainID, err := client.ChainID(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get chain ID: %v", err)
+		}
+		build, problem := knownBuild(chainID, addr, report.CodeHash)
+		report.Build = build
+		if problem != "" {
+			report.Problems = append(report.Problems, problem)
+		}
+	}
+
+	// A Solidity dispatcher compares the calldata selector against a PUSH4
+	// of every external function, so each selector must appear in the code.
+	for _, method := range scheme.Methods() {
+		push := append([]byte{0x63}, method.ID...)
+		if !bytes.Contains(code, push) {
+			report.Problems = append(report.Problems, fmt.Sprintf("dispatcher has no entry for %s()", method.RawName))
+		}
+	}
+
+	job, err := scheme.FetchJob(ctx, client, addr, from)
+	if err != nil {
+		report.Problems = append(report.Problems, err.Error())
+		return report, nil
+	}
+	if job.Challenge.Sign() == 0 {
+		report.Problems = append(report.Problems, "challenge is zero")
+	}
+	if scheme.Target(job).Sign() == 0 {
+		report.Problems = append(report.Problems, fmt.Sprintf("difficulty %v gives an unreachable target", job.Difficulty))
+	}
+	if _, ok := scheme.(*miner.PoWERC20Scheme); ok {
+		if job.Difficulty.Cmp(big.NewInt(255)) > 0 {
+			report.Problems = append(report.Problems, fmt.Sprintf("difficulty() returned %v, expected 1-255", job.Difficulty))
+		}
+		contract, err := abi.NewPoWERC20Caller(addr, client)
+		if err != nil {
+			return nil, err
+		}
+		opts := &bind.CallOpts{Context: ctx, From: from}
+		if _, err := contract.MinedNonces(opts, from, big.NewInt(0)); err != nil {
+			report.Problems = append(report.Problems, fmt.Sprintf("minedNonces() failed: %v", err))
+		}
+		if _, err := contract.MiningTimes(opts, from); err != nil {
+			report.Problems = append(report.Problems, fmt.Sprintf("miningTimes() failed: %v", err))
+		}
+	}
+	// Submitting an arbitrary nonce must revert; a contract that accepts
+	// any nonce is not checking proof of work.
+	nonce := big.NewInt(0)
+	data, err := scheme.SubmitData(job, nonce, miner.SolutionDigest(scheme, job, from, nonce))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := client.CallContract(ctx, ethereum.CallMsg{From: from, To: &addr, Data: data}, nil); err == nil {
+		report.Problems = append(report.Problems, "submitting an invalid nonce did not revert")
+	}
+	return report, nil
+}
+
+// checkContract runs verifyContract and logs the outcome. It fails with
+// errUnverifiedContract unless allowUnverified is set.
+func checkContract(ctx context.Context, client *ethclient.Client, scheme miner.Scheme, addr, from common.Address, allowlistFile string, allowUnverified bool) error {
+	allowlist, err := loadCodeHashAllowlist(allowlistFile)
+	if err != nil {
+		return err
+	}
+	report, err := verifyContract(ctx, client, scheme, addr, from, allowlist)
+	if err != nil {
+		return err
+	}
+	for _, problem := range report.Problems {
+		verifyLog.Warnf("Contract check: %s", problem)
+	}
+	if report.Verified() {
+		verifyLog.Infof("Contract code %s matches verified build %s", report.CodeHash.Hex(), report.Build)
+		return nil
+	}
+	if report.Build == "" {
+		verifyLog.Warnf("Contract code hash %s is not on the allowlist", report.CodeHash.Hex())
+	}
+	if allowUnverified {
+		verifyLog.Warn("Mining an unverified contract because -allowUnverifiedContract is set")
+		return nil
+	}
+	return errUnverifiedContract
+}
+
+// runVerify implements the `verify` subcommand, which prints the code hash of
+// a contract and the result of the probes so it can be reviewed and added to
+// an allowlist.
+func runVerify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	rpcURL := fs.String("rpc", infuraURL, "Ethereum RPC endpoint")
+	contract := fs.String("contractAddress", contractAddress, "Address of the Ethereum contract")
+	allowlistFile := fs.String("codeHashAllowlist", "", "JSON file with additional trusted code hashes")
+	schemeName := fs.String("scheme", "powerc20", "Contract family: powerc20, eip918 or the path of a JSON scheme config")
+	parseCommand(fs, args)
+
+	scheme, err := miner.LoadScheme(*schemeName)
+	if err != nil {
+		verifyLog.Fatalf("Failed to load mining scheme: %v", err)
+	}
+
+	client, err := ethclient.Dial(*rpcURL)
+	if err != nil {
+		verifyLog.Fatalf("Failed to connect to the Ethereum client: %v", err)
+	}
+	allowlist, err := loadCodeHashAllowlist(*allowlistFile)
+	if err != nil {
+		verifyLog.Fatalf("%v", err)
+	}
+	report, err := verifyContract(context.Background(), client, scheme, common.HexToAddress(*contract), common.Address{}, allowlist)
+	if err != nil {
+		verifyLog.Fatalf("Failed to verify contract: %v", err)
+	}
+	build := report.Build
+	if build == "" {
+		build = "unknown"
+	}
+	fmt.Fprintf(os.Stdout, "Contract:  %s\nCode size: %d bytes\nCode hash: %s\nBuild:     %s\n", *contract, report.CodeSize, report.CodeHash.Hex(), build)
+	if len(report.Problems) > 0 {
+		fmt.Fprintf(os.Stdout, "Problems:\n  %s\n", strings.Join(report.Problems, "\n  "))
+	}
+	if !report.Verified() {
+		os.Exit(1)
+	}
+}
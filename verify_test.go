@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"Powerc20Worker/miner"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+func TestVerifySimulatedToken(t *testing.T) {
+	chain, err := newSimChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := chain.deploy("sim", 8, 1)
+	client := chain.dial()
+	scheme, _ := miner.LoadScheme("powerc20")
+
+	allowlist := filepath.Join(t.TempDir(), "allowlist.json")
+	if err := chain.writeAllowlist(allowlist); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkContract(context.Background(), client, scheme, addr, common.Address{}, allowlist, false); err != nil {
+		t.Fatalf("allowlisted simulated token rejected: %v", err)
+	}
+	if err := checkContract(context.Background(), client, scheme, addr, common.Address{}, "", false); err != errUnverifiedContract {
+		t.Fatalf("unlisted code: got %v, want errUnverifiedContract", err)
+	}
+	missing := common.HexToAddress("0x000000000000000000000000000000000000dEaD")
+	report, err := verifyContract(context.Background(), client, scheme, missing, common.Address{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Verified() || len(report.Problems) == 0 {
+		t.Fatalf("address without code verified: %+v", report)
+	}
+}
+
+// TestDefaultContractVerified checks that the default deployment passes
+// verification with the built-in allowlist alone. It needs a mainnet node,
+// given with POWERC20_MAINNET_RPC.
+func TestDefaultContractVerified(t *testing.T) {
+	url := os.Getenv("POWERC20_MAINNET_RPC")
+	if url == "" {
+		t.Skip("POWERC20_MAINNET_RPC is not set")
+	}
+	client, err := ethclient.Dial(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheme, _ := miner.LoadScheme("powerc20")
+	report, err := verifyContract(context.Background(), client, scheme, common.HexToAddress(contractAddress), common.Address{}, knownCodeHashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Verified() {
+		t.Fatalf("default contract (code hash %s) not verified: build %q, problems %v", report.CodeHash.Hex(), report.Build, report.Problems)
+	}
+}
+
+func TestKnownDeployment(t *testing.T) {
+	addr := common.HexToAddress(defaultContractAddress)
+	known, ok := knownDeployments[addr]
+	if !ok || known.ChainID != 1 {
+		t.Fatalf("default contract %s is not a known mainnet deployment: %+v", addr.Hex(), known)
+	}
+	chain, err := newSimChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.deployAt(addr, "sim", 8, 1)
+	other := chain.deploy("other", 8, 1)
+	client := chain.dial()
+	scheme, _ := miner.LoadScheme("powerc20")
+	check := func(addr common.Address) error {
+		return checkContract(context.Background(), client, scheme, addr, common.Address{}, "", false)
+	}
+
+	// The simulated chain is not mainnet, so the address alone is not
+	// trusted there.
+	if err := check(addr); err != errUnverifiedContract {
+		t.Fatalf("default address on another chain: got %v, want errUnverifiedContract", err)
+	}
+
+	defer func() { knownDeployments[addr] = known }()
+	sim := known
+	sim.ChainID = simChainID
+	knownDeployments[addr] = sim
+	if err := check(addr); err != nil {
+		t.Fatalf("default deployment refused without flags: %v", err)
+	}
+	if err := check(other); err != errUnverifiedContract {
+		t.Fatalf("same code at another address: got %v, want errUnverifiedContract", err)
+	}
+
+	// A pinned hash admits only that code.
+	code, err := client.CodeAt(context.Background(), addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.CodeHash = crypto.Keccak256Hash(code)
+	knownDeployments[addr] = sim
+	if err := check(addr); err != nil {
+		t.Fatalf("pinned code refused: %v", err)
+	}
+	sim.CodeHash = common.HexToHash("0x01")
+	knownDeployments[addr] = sim
+	if err := check(addr); err != errUnverifiedContract {
+		t.Fatalf("code differing from the pinned hash: got %v, want errUnverifiedContract", err)
+	}
+}